@@ -1,6 +1,6 @@
 import React, { useState, useEffect } from 'react';
 import { Heart, MessageCircle, Repeat, Share, MoreVertical } from 'lucide-react';
-import { repost, toggleLike, deletePost, getUserInfo, editPost, checkIfLiked, checkIfReposted } from '../../utils/api';
+import { repost, undoRepost, toggleLike, deletePost, getUserInfo, editPost, checkIfLiked, checkIfReposted } from '../../utils/api';
 import PostOptions from './PostOptions';
 import CommentModal from './CommentModal';
 import QuoteModal from './QuoteModal';
@@ -74,7 +74,7 @@ function Comment({ comment, formatDate, onCommentAdded }: CommentProps) {
     setLikesCount(prev => newLikedState ? prev + 1 : prev - 1);
 
     try {
-      await toggleLike(Number(comment.id));
+      await toggleLike(Number(comment.id), !newLikedState);
     } catch (error) {
       console.error('Error toggling like:', error);
       setIsLiked(!newLikedState);
@@ -121,7 +121,7 @@ function Comment({ comment, formatDate, onCommentAdded }: CommentProps) {
     setRepostsCount(prev => Math.max(0, prev - 1));
 
     try {
-      await repost(Number(comment.id));
+      await undoRepost(Number(comment.id));
       setShowRepostOptions(false);
     } catch (error) {
       console.error('Error undoing repost:', error);
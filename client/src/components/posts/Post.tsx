@@ -4,6 +4,7 @@ import { formatDistanceToNow } from 'date-fns';
 import { MessageSquare, Repeat, Heart, Share, MoreVertical } from 'lucide-react';
 import {
   repost,
+  undoRepost,
   toggleLike,
   deletePost,
   getUserInfo,
@@ -174,7 +175,7 @@ function Post({ post, onRepost, onEdit, onDelete, disableNavigation = false }: P
       setIsLiked(!prevState);
       setLikesCount(count => prevState ? count - 1 : count + 1);
 
-      await toggleLike(Number(targetId));
+      await toggleLike(Number(targetId), prevState);
 
       const [currentLikeStatus, currentCount] = await Promise.all([
         checkIfLiked(Number(targetId)),
@@ -241,7 +242,7 @@ function Post({ post, onRepost, onEdit, onDelete, disableNavigation = false }: P
       setIsReposted(false);
       setRepostsCount(count => Math.max(0, count - 1));
 
-      await repost(Number(targetId));
+      await undoRepost(Number(targetId));
       onRepost?.();
 
       const currentCount = await getRepostsCount(Number(targetId));
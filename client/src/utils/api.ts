@@ -382,10 +382,10 @@ function processPost(post: any): any {
   };
 }
 
-export async function toggleLike(id: number): Promise<any> {
+export async function toggleLike(id: number, liked: boolean): Promise<any> {
   try {
     const response = await fetch(`http://localhost:8080/api/posts/${id}/like`, {
-      method: 'POST',
+      method: liked ? 'DELETE' : 'PUT',
       headers: { 'Content-Type': 'application/json' },
       credentials: 'include',
     });
@@ -405,7 +405,7 @@ export async function repost(id: number, quote?: string): Promise<any> {
     const userInfo = await getUserInfo();
     
     const response = await fetch(`http://localhost:8080/api/posts/${id}/repost`, {
-      method: 'POST',
+      method: quote ? 'POST' : 'PUT',
       headers: { 
         'Content-Type': 'application/json',
         'Authorization': `Bearer ${getToken()}`
@@ -434,6 +434,23 @@ export async function repost(id: number, quote?: string): Promise<any> {
   }
 }
 
+export async function undoRepost(id: number): Promise<any> {
+  try {
+    const response = await fetch(`http://localhost:8080/api/posts/${id}/repost`, {
+      method: 'DELETE',
+      headers: { 'Authorization': `Bearer ${getToken()}` },
+      credentials: 'include',
+    });
+
+    if (!response.ok) throw new Error('Failed to undo repost');
+
+    return response.json();
+  } catch (error) {
+    console.error('Error undoing repost:', error);
+    throw error;
+  }
+}
+
 export async function createPost(body: string): Promise<any> {
   try {
     const response = await fetch('http://localhost:8080/api/posts/create', {
@@ -589,7 +606,7 @@ export async function repostPost(postId: string): Promise<any> {
     const userInfo = await getUserInfo();
     
     const response = await fetch(`http://localhost:8080/api/posts/${postId}/repost`, {
-      method: 'POST',
+      method: 'PUT',
       headers: { 
         'Content-Type': 'application/json',
         'Authorization': `Bearer ${getToken()}`
@@ -5,6 +5,7 @@ import {
   getPostById, 
   getUserInfo, 
   repost, 
+  undoRepost, 
   toggleLike, 
   deletePost, 
   editPost, 
@@ -401,14 +402,14 @@ function PostDetailPage() {
             setLikesCount(prevCount => previousLikeState ? prevCount - 1 : prevCount + 1);
 
             if (post.is_repost && (post.quote === null || post.quote === undefined || post.quote === "")) {
-                await toggleLike(Number(post.parent_id));
+                await toggleLike(Number(post.parent_id), previousLikeState);
                 
                 const currentLikeStatus = await checkIfLiked(Number(post.parent_id));
                 const currentLikesCount = await getLikesCount(Number(post.parent_id));
                 setIsLiked(currentLikeStatus);
                 setLikesCount(currentLikesCount);
             } else {
-                await toggleLike(Number(post.id));
+                await toggleLike(Number(post.id), previousLikeState);
                 
                 const currentLikeStatus = await checkIfLiked(Number(post.id));
                 const currentLikesCount = await getLikesCount(Number(post.id));
@@ -479,9 +480,9 @@ function PostDetailPage() {
             setRepostsCount(prev => Math.max(0, prev - 1));
 
             if (post.is_repost) {
-                await repost(Number(post.parent_id));
+                await undoRepost(Number(post.parent_id));
             } else {
-                await repost(Number(post.id));
+                await undoRepost(Number(post.id));
             }
             setShowRepostOptions(false);
         } catch (error) {
@@ -87,3 +87,19 @@ func AuthMiddleware(db *gorm.DB) gin.HandlerFunc {
 		c.Next()
 	}
 }
+
+// OptionalAuthMiddleware identifies the user like AuthMiddleware when a valid token is present,
+// but lets anonymous requests through so public endpoints can tailor responses to the viewer.
+func OptionalAuthMiddleware(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		tokenString, err := c.Cookie("Authorization")
+		if err == nil && tokenString != "" {
+			if user, errToken := getUserFromToken(db, tokenString); errToken == nil {
+				c.Set("userID", user.ID)
+				c.Set("username", user.Username)
+				c.Set("nickname", user.Nickname)
+			}
+		}
+		c.Next()
+	}
+}
@@ -1,5 +1,7 @@
 package constants
 
+import "time"
+
 const Empty = ""
 const EmailRegexPatterns = `^[a-zA-Z0-9._%+\-]+@[a-zA-Z0-9.\-]+\.[a-zA-Z]{2,}$`
 
@@ -19,3 +21,105 @@ const ErrNoPost = "no post found"
 
 const SearchedWordLen = 3
 const MaxAgeRouter = 12
+
+const InitialURLHashtags = "/hashtags"
+const InitialURLExplore = "/explore"
+
+const MaxHashtagLen = 100
+const TrendingDefaultWindow = "1h"
+const TrendingMinWindow = 15 * time.Minute
+const TrendingMaxWindow = 7 * 24 * time.Hour
+const TrendingBaselineWindows = 6
+const TrendingMinCount = 2
+const TrendingDefaultLimit = 10
+const TrendingMaxLimit = 50
+
+const MaxPostLength = 280
+const URLWeightedLength = 23
+const UTF16SurrogateThreshold = 0x10000
+
+const MaxMessageLength = 10000
+const MaxLinksPerPost = 5
+const MaxLinksPerMessage = 10
+const DuplicatePostWindow = 24 * time.Hour
+
+const UnfurlUserAgent = "x-clone-unfurl/1.0"
+const UnfurlMaxBodyBytes = 512 << 10
+const UnfurlDialTimeout = 2 * time.Second
+const UnfurlRequestTimeout = 5 * time.Second
+const UnfurlMaxIdleConns = 10
+const UnfurlMaxRedirects = 3
+const UnfurlCacheTTL = 24 * time.Hour
+const UnfurlErrorCacheTTL = 10 * time.Minute
+
+const InitialURLBookmarks = "/bookmarks"
+
+const DefaultPageSize = 20
+const MaxPageSize = 100
+
+const ImpressionWindow = time.Hour
+const ImpressionFlushInterval = 5 * time.Second
+const ImpressionBatchSize = 500
+const ImpressionSeenMax = 100_000
+const ShutdownTimeout = 10 * time.Second
+const AnalyticsDefaultHours = 24
+const AnalyticsMaxHours = 7 * 24
+
+const ReconcileDefaultInterval = 24 * time.Hour
+const ReconcileBatchSize = 1000
+const HashtagBackfillBatchSize = 500
+
+const MaxPostStateIDs = 100
+
+const InitialURLLists = "/lists"
+const MaxListNameLength = 25
+const MaxListDescriptionLength = 100
+const MaxListMembers = 5000
+
+const InitialURLCommunities = "/communities"
+const MaxCommunityNameLength = 30
+const MaxCommunityDescriptionLength = 160
+const MaxCommunityRules = 10
+const MaxCommunityRuleTitleLength = 60
+const MaxCommunityRuleDescriptionLength = 300
+
+const InitialURLTimeline = "/timeline"
+const FanOutMaxFollowers = 10000
+const TimelineBackfillSize = 200
+
+const ForYouWindow = 72 * time.Hour
+const ForYouCandidatesPerSource = 200
+const ForYouAffinityWindow = 30 * 24 * time.Hour
+const ForYouMaxPerAuthor = 2
+const ForYouMaxResults = 200
+const ForYouSnapshotTTL = 10 * time.Minute
+const ForYouSnapshotMaxViewers = 10000
+
+const InitialURLMutes = "/mutes"
+const MaxMutedPhraseLength = 100
+const MaxMutedWords = 200
+
+const LiveHeartbeatInterval = 25 * time.Second
+const LiveSubscriberBuffer = 64
+const LiveSentPostsMax = 1000
+
+const DefaultFrontendURL = "http://localhost:5173"
+const FeedMaxItems = 50
+const FeedTitleLength = 80
+const FeedMaxAge = 5 * time.Minute
+
+const InitialURLFederation = "/ap"
+const WebFingerPath = "/.well-known/webfinger"
+const FederationKeyBits = 2048
+const FederationHTTPTimeout = 10 * time.Second
+const FederationMaxBodyBytes = 1 << 20
+const FederationSignatureMaxSkew = time.Hour
+const FederationKeyRefetchInterval = 5 * time.Minute
+const FederationKeyRefetchMaxKeys = 10_000
+const FederationOutboxSize = 20
+const DeliveryPollInterval = 10 * time.Second
+const DeliveryBatchSize = 20
+const DeliveryMaxAttempts = 8
+const DeliveryRetryBase = time.Minute
+
+const NewPostsMaxCount = 100
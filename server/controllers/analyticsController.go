@@ -0,0 +1,100 @@
+package controllers
+
+import (
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"net/http"
+	"strconv"
+	"x-clone/server/constants"
+	"x-clone/server/mappers"
+	"x-clone/server/models"
+	"x-clone/server/services/analytics"
+	"x-clone/server/services/user"
+)
+
+// GetPostAnalyticsHandler GET /posts/:postid/analytics?hours=24, only available to the author of the post.
+func GetPostAnalyticsHandler(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, _ := user.GetUserIDFromContext(c)
+		postID, atoiErr := strconv.Atoi(c.Param("postid"))
+		if atoiErr != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid post ID"})
+			return
+		}
+
+		hours, err := strconv.Atoi(c.DefaultQuery("hours", strconv.Itoa(constants.AnalyticsDefaultHours)))
+		if err != nil || hours <= 0 || hours > constants.AnalyticsMaxHours {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid hours parameter"})
+			return
+		}
+
+		post, err := user.GetSimplePostByID(db, uint(postID))
+		if err != nil {
+			if err.Error() == constants.ErrNoPost {
+				c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+			return
+		}
+		if post.UserID != userID {
+			c.JSON(http.StatusForbidden, gin.H{"error": user.ErrNotPostOwner.Error()})
+			return
+		}
+
+		stats, err := analytics.GetPostStats(db, post.ID, hours)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load post analytics"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"analytics": stats})
+	}
+}
+
+// RecordProfileClickHandler POST /posts/:postid/profile-click, sent when a viewer opens a profile from a post.
+func RecordProfileClickHandler(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		postID, atoiErr := strconv.Atoi(c.Param("postid"))
+		if atoiErr != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid post ID"})
+			return
+		}
+
+		var post models.Post
+		if err := db.Select("id", "user_id").First(&post, postID).Error; err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": constants.ErrNoPost})
+			return
+		}
+
+		if viewerID, _ := user.GetUserIDFromContext(c); viewerID != post.UserID {
+			analytics.RecordProfileClick(db, viewerKey(c), post.ID)
+		}
+
+		c.JSON(http.StatusOK, gin.H{"message": "profile click recorded"})
+	}
+}
+
+// recordImpressions counts the posts as seen by the viewer, leaving out their own posts.
+// A repost is an impression of the post it shares.
+func recordImpressions(c *gin.Context, db *gorm.DB, posts []mappers.PostResponse) {
+	viewerID, _ := user.GetUserIDFromContext(c)
+
+	postIDs := make([]uint, 0, len(posts))
+	for _, post := range posts {
+		postID, authorID := post.ID, post.UserID
+		if post.Kind == models.KindRepost && post.ParentPost != nil {
+			postID, authorID = post.ParentPost.ID, post.ParentPost.UserID
+		}
+		if authorID != viewerID {
+			postIDs = append(postIDs, postID)
+		}
+	}
+
+	analytics.RecordImpressions(db, viewerKey(c), postIDs)
+}
+
+func viewerKey(c *gin.Context) string {
+	viewerID, _ := user.GetUserIDFromContext(c)
+	return analytics.ViewerKey(viewerID, c.ClientIP(), c.Request.UserAgent())
+}
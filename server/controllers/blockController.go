@@ -0,0 +1,65 @@
+package controllers
+
+import (
+	"errors"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"net/http"
+	"x-clone/server/constants"
+	"x-clone/server/mappers"
+	"x-clone/server/services/block"
+	"x-clone/server/services/user"
+)
+
+// BlockUserHandler POST /profile/block/:username, also removes the follows between both users.
+func BlockUserHandler(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, _ := user.GetUserIDFromContext(c)
+		username, _ := user.GetUsernameIDFromContext(c)
+
+		if err := block.BlockUser(db, userID, username, c.Param("username")); err != nil {
+			sendBlockError(c, err, "Failed to block user")
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"message": "blocked successfully", "blocked": true})
+	}
+}
+
+func UnblockUserHandler(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, _ := user.GetUserIDFromContext(c)
+
+		if err := block.UnblockUser(db, userID, c.Param("username")); err != nil {
+			sendBlockError(c, err, "Failed to unblock user")
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"message": "unblocked successfully", "blocked": false})
+	}
+}
+
+func GetBlockedUsersHandler(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, _ := user.GetUserIDFromContext(c)
+
+		users, err := block.GetBlockedUsers(db, userID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load blocked users"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"users": mappers.MapUsersToResponses(users)})
+	}
+}
+
+func sendBlockError(c *gin.Context, err error, fallback string) {
+	switch {
+	case errors.Is(err, block.ErrCannotBlockSelf):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case err.Error() == constants.ErrNoUser:
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fallback})
+	}
+}
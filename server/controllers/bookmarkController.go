@@ -0,0 +1,197 @@
+package controllers
+
+import (
+	"errors"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"net/http"
+	"strconv"
+	"x-clone/server/constants"
+	"x-clone/server/services/bookmark"
+	"x-clone/server/services/user"
+)
+
+func AddBookmarkHandler(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, err := user.GetUserIDFromContext(c)
+		if err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Authentication required"})
+			return
+		}
+
+		postID, err := strconv.ParseUint(c.Param("postid"), 10, 32)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid post ID"})
+			return
+		}
+
+		// The folder is optional, so an empty body is accepted
+		var req struct {
+			FolderID *uint `json:"folder_id"`
+		}
+		if c.Request.ContentLength > 0 {
+			if errJSON := c.ShouldBindJSON(&req); errJSON != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid JSON payload"})
+				return
+			}
+		}
+
+		if errBookmark := bookmark.AddBookmark(db, userID, uint(postID), req.FolderID); errBookmark != nil {
+			switch {
+			case errBookmark.Error() == constants.ErrNoPost, errors.Is(errBookmark, bookmark.ErrNoFolder):
+				c.JSON(http.StatusNotFound, gin.H{"error": errBookmark.Error()})
+			default:
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to bookmark post"})
+			}
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"message": "bookmarked successfully", "bookmarked": true})
+	}
+}
+
+func RemoveBookmarkHandler(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, err := user.GetUserIDFromContext(c)
+		if err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Authentication required"})
+			return
+		}
+
+		postID, err := strconv.ParseUint(c.Param("postid"), 10, 32)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid post ID"})
+			return
+		}
+
+		if errRemove := bookmark.RemoveBookmark(db, userID, uint(postID)); errRemove != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to remove bookmark"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"message": "bookmark removed successfully", "bookmarked": false})
+	}
+}
+
+// GetBookmarksHandler GET /bookmarks?folder_id=1&limit=20&cursor=42.
+func GetBookmarksHandler(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, err := user.GetUserIDFromContext(c)
+		if err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Authentication required"})
+			return
+		}
+
+		limit, cursor, err := parsePagination(c)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		var folderID *uint
+		if rawFolderID := c.Query("folder_id"); rawFolderID != constants.Empty {
+			parsedFolderID, errParse := strconv.ParseUint(rawFolderID, 10, 32)
+			if errParse != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid folder ID"})
+				return
+			}
+			id := uint(parsedFolderID)
+			folderID = &id
+		}
+
+		rawPosts, nextCursor, err := bookmark.GetBookmarkedPosts(db, userID, folderID, limit, cursor)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+			return
+		}
+
+		posts, err := processPostsForViewer(c, db, rawPosts)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"posts":       posts,
+			"next_cursor": nextCursor,
+		})
+	}
+}
+
+func GetBookmarkFoldersHandler(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, err := user.GetUserIDFromContext(c)
+		if err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Authentication required"})
+			return
+		}
+
+		folders, err := bookmark.GetFolders(db, userID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load bookmark folders"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"folders": folders})
+	}
+}
+
+func CreateBookmarkFolderHandler(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, err := user.GetUserIDFromContext(c)
+		if err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Authentication required"})
+			return
+		}
+
+		var req struct {
+			Name string `json:"name" binding:"required"`
+		}
+		if errJSON := c.ShouldBindJSON(&req); errJSON != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Folder name is required"})
+			return
+		}
+
+		folder, err := bookmark.CreateFolder(db, userID, req.Name)
+		if err != nil {
+			switch {
+			case errors.Is(err, bookmark.ErrInvalidFolderName):
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			case errors.Is(err, bookmark.ErrFolderNameTaken):
+				c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+			default:
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create bookmark folder"})
+			}
+			return
+		}
+
+		c.JSON(http.StatusCreated, gin.H{"message": "Folder created successfully", "folder": folder})
+	}
+}
+
+func DeleteBookmarkFolderHandler(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, err := user.GetUserIDFromContext(c)
+		if err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Authentication required"})
+			return
+		}
+
+		folderID, err := strconv.ParseUint(c.Param("folderid"), 10, 32)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid folder ID"})
+			return
+		}
+
+		if errDelete := bookmark.DeleteFolder(db, userID, uint(folderID)); errDelete != nil {
+			if errors.Is(errDelete, bookmark.ErrNoFolder) {
+				c.JSON(http.StatusNotFound, gin.H{"error": errDelete.Error()})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete bookmark folder"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"message": "Folder deleted successfully"})
+	}
+}
@@ -0,0 +1,296 @@
+package controllers
+
+import (
+	"errors"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"net/http"
+	"strconv"
+	"x-clone/server/constants"
+	"x-clone/server/models"
+	"x-clone/server/services/community"
+	"x-clone/server/services/user"
+)
+
+type communityRuleRequest struct {
+	Title       string `json:"title"`
+	Description string `json:"description"`
+}
+
+func CreateCommunityHandler(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, _ := user.GetUserIDFromContext(c)
+
+		var req struct {
+			Name        string                 `json:"name" binding:"required"`
+			Description string                 `json:"description"`
+			Rules       []communityRuleRequest `json:"rules"`
+		}
+		if errJSON := c.ShouldBindJSON(&req); errJSON != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Community name is required"})
+			return
+		}
+
+		created, err := community.CreateCommunity(db, userID, req.Name, req.Description, toCommunityRules(req.Rules))
+		if err != nil {
+			sendCommunityError(c, err, "Failed to create community")
+			return
+		}
+
+		c.JSON(http.StatusCreated, gin.H{"message": "Community created successfully", "community": created})
+	}
+}
+
+// GetCommunityHandler GET /communities/:communityid, the role of the viewer is empty when they are not a member.
+func GetCommunityHandler(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		communityID, ok := parseCommunityID(c)
+		if !ok {
+			return
+		}
+
+		found, err := community.GetCommunity(db, communityID)
+		if err != nil {
+			sendCommunityError(c, err, "Failed to load community")
+			return
+		}
+
+		var role models.CommunityRole
+		if viewerID, _ := user.GetUserIDFromContext(c); viewerID != 0 {
+			if role, err = community.GetRole(db, viewerID, communityID); err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load community"})
+				return
+			}
+		}
+
+		c.JSON(http.StatusOK, gin.H{"community": found, "role": role})
+	}
+}
+
+// UpdateCommunityRulesHandler PUT /communities/:communityid/rules, replaces every rule in the given order.
+func UpdateCommunityRulesHandler(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		communityID, ok := parseCommunityID(c)
+		if !ok {
+			return
+		}
+
+		var req struct {
+			Rules []communityRuleRequest `json:"rules"`
+		}
+		if errJSON := c.ShouldBindJSON(&req); errJSON != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid JSON payload"})
+			return
+		}
+
+		userID, _ := user.GetUserIDFromContext(c)
+		rules, err := community.UpdateRules(db, userID, communityID, toCommunityRules(req.Rules))
+		if err != nil {
+			sendCommunityError(c, err, "Failed to update community rules")
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"message": "rules updated successfully", "rules": rules})
+	}
+}
+
+func JoinCommunityHandler(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		communityID, ok := parseCommunityID(c)
+		if !ok {
+			return
+		}
+
+		userID, _ := user.GetUserIDFromContext(c)
+		if err := community.Join(db, userID, communityID); err != nil {
+			sendCommunityError(c, err, "Failed to join community")
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"message": "joined successfully", "member": true})
+	}
+}
+
+func LeaveCommunityHandler(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		communityID, ok := parseCommunityID(c)
+		if !ok {
+			return
+		}
+
+		userID, _ := user.GetUserIDFromContext(c)
+		if err := community.Leave(db, userID, communityID); err != nil {
+			sendCommunityError(c, err, "Failed to leave community")
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"message": "left successfully", "member": false})
+	}
+}
+
+func GetCommunityMembersHandler(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		communityID, ok := parseCommunityID(c)
+		if !ok {
+			return
+		}
+
+		members, err := community.GetMembers(db, communityID)
+		if err != nil {
+			sendCommunityError(c, err, "Failed to load community members")
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"members": members})
+	}
+}
+
+// UpdateCommunityRoleHandler PUT /communities/:communityid/members/:username/role, only for the owner.
+func UpdateCommunityRoleHandler(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		communityID, ok := parseCommunityID(c)
+		if !ok {
+			return
+		}
+
+		var req struct {
+			Role models.CommunityRole `json:"role" binding:"required"`
+		}
+		if errJSON := c.ShouldBindJSON(&req); errJSON != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Role is required"})
+			return
+		}
+
+		userID, _ := user.GetUserIDFromContext(c)
+		if err := community.SetRole(db, userID, communityID, c.Param("username"), req.Role); err != nil {
+			sendCommunityError(c, err, "Failed to update member role")
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"message": "role updated successfully", "role": req.Role})
+	}
+}
+
+// GetCommunityTimelineHandler GET /communities/:communityid/timeline?limit=20&cursor=42. since_id and since leave
+// out the posts the client already has.
+func GetCommunityTimelineHandler(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		communityID, ok := parseCommunityID(c)
+		if !ok {
+			return
+		}
+
+		limit, cursor, err := parsePagination(c)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		since, err := parseSince(c)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		viewerID, _ := user.GetUserIDFromContext(c)
+		rawPosts, nextCursor, err := community.GetTimeline(db, viewerID, communityID, limit, cursor, since)
+		if err != nil {
+			sendCommunityError(c, err, "Internal server error")
+			return
+		}
+
+		posts, err := processPostsForViewer(c, db, rawPosts)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"posts":       posts,
+			"next_cursor": nextCursor,
+		})
+	}
+}
+
+// RemoveCommunityPostHandler DELETE /communities/:communityid/posts/:postid, lets moderators remove any post
+// of their community, replies included.
+func RemoveCommunityPostHandler(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		communityID, ok := parseCommunityID(c)
+		if !ok {
+			return
+		}
+		postID, atoiErr := strconv.Atoi(c.Param("postid"))
+		if atoiErr != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid post ID"})
+			return
+		}
+
+		userID, _ := user.GetUserIDFromContext(c)
+		canModerate, err := community.CanModerate(db, userID, communityID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+			return
+		}
+		if !canModerate {
+			c.JSON(http.StatusForbidden, gin.H{"error": community.ErrNotModerator.Error()})
+			return
+		}
+
+		post, err := user.GetSimplePostByID(db, uint(postID))
+		if err != nil {
+			if err.Error() == constants.ErrNoPost {
+				c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+			return
+		}
+		if post.CommunityID == nil || *post.CommunityID != communityID {
+			c.JSON(http.StatusNotFound, gin.H{"error": constants.ErrNoPost})
+			return
+		}
+
+		if err := removePost(db, post); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to remove post"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"message": "post removed successfully"})
+	}
+}
+
+func toCommunityRules(rules []communityRuleRequest) []models.CommunityRule {
+	converted := make([]models.CommunityRule, len(rules))
+	for i, rule := range rules {
+		converted[i] = models.CommunityRule{Title: rule.Title, Description: rule.Description}
+	}
+	return converted
+}
+
+func parseCommunityID(c *gin.Context) (uint, bool) {
+	communityID, err := strconv.ParseUint(c.Param("communityid"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid community ID"})
+		return 0, false
+	}
+	return uint(communityID), true
+}
+
+// sendCommunityError maps the errors of the community service to responses, falling back to a 500 with
+// the given message.
+func sendCommunityError(c *gin.Context, err error, fallback string) {
+	switch {
+	case errors.Is(err, community.ErrInvalidName), errors.Is(err, community.ErrDescriptionTooLong),
+		errors.Is(err, community.ErrInvalidRules), errors.Is(err, community.ErrInvalidRole),
+		errors.Is(err, community.ErrOwnerCannotLeave):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, community.ErrNoCommunity), errors.Is(err, community.ErrNoMember):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case errors.Is(err, community.ErrNotModerator), errors.Is(err, community.ErrNotOwner):
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+	case errors.Is(err, community.ErrNameTaken):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fallback})
+	}
+}
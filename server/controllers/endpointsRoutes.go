@@ -80,6 +80,18 @@ var CreateRepostEndpoint = models.Endpoint{
 	HandlerFunction: CreateRepostHandler,
 }
 
+var RepostEndpoint = models.Endpoint{
+	Method:          models.PUT,
+	Path:            constants.InitialURLPosts + "/:postid/repost",
+	HandlerFunction: RepostHandler,
+}
+
+var UnrepostEndpoint = models.Endpoint{
+	Method:          models.DELETE,
+	Path:            constants.InitialURLPosts + "/:postid/repost",
+	HandlerFunction: UnrepostHandler,
+}
+
 var GetAllPostsByUsernameEndpoint = models.Endpoint{
 	Method:          models.GET,
 	Path:            constants.InitialURLPosts + "/user/:username",
@@ -104,10 +116,23 @@ var DeletePostEndpoint = models.Endpoint{
 	HandlerFunction: DeletePostHandler,
 }
 
-var ToggleLikeEndPoint = models.Endpoint{
+// LikePostAliasEndpoint keeps POST working for older clients as a deprecated alias of LikePostEndpoint.
+var LikePostAliasEndpoint = models.Endpoint{
 	Method:          models.POST,
 	Path:            constants.InitialURLPosts + "/:postid/like",
-	HandlerFunction: ToggleLikeHandler,
+	HandlerFunction: LikePostHandler,
+}
+
+var LikePostEndpoint = models.Endpoint{
+	Method:          models.PUT,
+	Path:            constants.InitialURLPosts + "/:postid/like",
+	HandlerFunction: LikePostHandler,
+}
+
+var UnlikePostEndpoint = models.Endpoint{
+	Method:          models.DELETE,
+	Path:            constants.InitialURLPosts + "/:postid/like",
+	HandlerFunction: UnlikePostHandler,
 }
 
 // Querystring parameters
@@ -228,6 +253,372 @@ var CountCommentsEndpoint = models.Endpoint{
 	HandlerFunction: CountCommentsHandler,
 }
 
+var GetHashtagPostsEndpoint = models.Endpoint{
+	Method:          models.GET,
+	Path:            constants.InitialURLHashtags + "/:tag",
+	HandlerFunction: GetHashtagPostsHandler,
+}
+
+var GetTrendingHashtagsEndpoint = models.Endpoint{
+	Method:          models.GET,
+	Path:            constants.InitialURLExplore + "/trending",
+	HandlerFunction: GetTrendingHashtagsHandler,
+}
+
+var GetMentionsEndpoint = models.Endpoint{
+	Method:          models.GET,
+	Path:            constants.InitialURLPosts + "/mentions",
+	HandlerFunction: GetMentionsHandler,
+}
+
+var AddBookmarkEndpoint = models.Endpoint{
+	Method:          models.POST,
+	Path:            constants.InitialURLPosts + "/:postid/bookmark",
+	HandlerFunction: AddBookmarkHandler,
+}
+
+var RemoveBookmarkEndpoint = models.Endpoint{
+	Method:          models.DELETE,
+	Path:            constants.InitialURLPosts + "/:postid/bookmark",
+	HandlerFunction: RemoveBookmarkHandler,
+}
+
+var GetBookmarksEndpoint = models.Endpoint{
+	Method:          models.GET,
+	Path:            constants.InitialURLBookmarks,
+	HandlerFunction: GetBookmarksHandler,
+}
+
+var GetBookmarkFoldersEndpoint = models.Endpoint{
+	Method:          models.GET,
+	Path:            constants.InitialURLBookmarks + "/folders",
+	HandlerFunction: GetBookmarkFoldersHandler,
+}
+
+var CreateBookmarkFolderEndpoint = models.Endpoint{
+	Method:          models.POST,
+	Path:            constants.InitialURLBookmarks + "/folders",
+	HandlerFunction: CreateBookmarkFolderHandler,
+}
+
+var DeleteBookmarkFolderEndpoint = models.Endpoint{
+	Method:          models.DELETE,
+	Path:            constants.InitialURLBookmarks + "/folders/:folderid",
+	HandlerFunction: DeleteBookmarkFolderHandler,
+}
+
+var PinPostEndpoint = models.Endpoint{
+	Method:          models.POST,
+	Path:            constants.InitialURLPosts + "/:postid/pin",
+	HandlerFunction: PinPostHandler,
+}
+
+var UnpinPostEndpoint = models.Endpoint{
+	Method:          models.DELETE,
+	Path:            constants.InitialURLPosts + "/:postid/pin",
+	HandlerFunction: UnpinPostHandler,
+}
+
+var UpdateReplyAudienceEndpoint = models.Endpoint{
+	Method:          models.PUT,
+	Path:            constants.InitialURLPosts + "/:postid/reply-audience",
+	HandlerFunction: UpdateReplyAudienceHandler,
+}
+
+var GetPostAnalyticsEndpoint = models.Endpoint{
+	Method:          models.GET,
+	Path:            constants.InitialURLPosts + "/:postid/analytics",
+	HandlerFunction: GetPostAnalyticsHandler,
+}
+
+var RecordProfileClickEndpoint = models.Endpoint{
+	Method:          models.POST,
+	Path:            constants.InitialURLPosts + "/:postid/profile-click",
+	HandlerFunction: RecordProfileClickHandler,
+}
+
+var GetPostStatesEndpoint = models.Endpoint{
+	Method:          models.GET,
+	Path:            constants.InitialURLPosts + "/state",
+	HandlerFunction: GetPostStatesHandler,
+}
+
+var AddPostLabelEndpoint = models.Endpoint{
+	Method:          models.POST,
+	Path:            constants.InitialURLPosts + "/:postid/labels",
+	HandlerFunction: AddPostLabelHandler,
+}
+
+var RemovePostLabelEndpoint = models.Endpoint{
+	Method:          models.DELETE,
+	Path:            constants.InitialURLPosts + "/:postid/labels/:label",
+	HandlerFunction: RemovePostLabelHandler,
+}
+
+var UpdateSensitiveContentEndpoint = models.Endpoint{
+	Method:          models.PUT,
+	Path:            constants.InitialURLProfile + "/sensitive-content",
+	HandlerFunction: UpdateSensitiveContentHandler,
+}
+
+var CreateListEndpoint = models.Endpoint{
+	Method:          models.POST,
+	Path:            constants.InitialURLLists,
+	HandlerFunction: CreateListHandler,
+}
+
+var GetMyListsEndpoint = models.Endpoint{
+	Method:          models.GET,
+	Path:            constants.InitialURLLists,
+	HandlerFunction: GetMyListsHandler,
+}
+
+var GetUserListsEndpoint = models.Endpoint{
+	Method:          models.GET,
+	Path:            constants.InitialURLProfile + "/:username/lists",
+	HandlerFunction: GetUserListsHandler,
+}
+
+var GetListEndpoint = models.Endpoint{
+	Method:          models.GET,
+	Path:            constants.InitialURLLists + "/:listid",
+	HandlerFunction: GetListHandler,
+}
+
+var DeleteListEndpoint = models.Endpoint{
+	Method:          models.DELETE,
+	Path:            constants.InitialURLLists + "/:listid",
+	HandlerFunction: DeleteListHandler,
+}
+
+var GetListMembersEndpoint = models.Endpoint{
+	Method:          models.GET,
+	Path:            constants.InitialURLLists + "/:listid/members",
+	HandlerFunction: GetListMembersHandler,
+}
+
+var AddListMemberEndpoint = models.Endpoint{
+	Method:          models.PUT,
+	Path:            constants.InitialURLLists + "/:listid/members/:username",
+	HandlerFunction: AddListMemberHandler,
+}
+
+var RemoveListMemberEndpoint = models.Endpoint{
+	Method:          models.DELETE,
+	Path:            constants.InitialURLLists + "/:listid/members/:username",
+	HandlerFunction: RemoveListMemberHandler,
+}
+
+var SubscribeListEndpoint = models.Endpoint{
+	Method:          models.PUT,
+	Path:            constants.InitialURLLists + "/:listid/subscription",
+	HandlerFunction: SubscribeListHandler,
+}
+
+var UnsubscribeListEndpoint = models.Endpoint{
+	Method:          models.DELETE,
+	Path:            constants.InitialURLLists + "/:listid/subscription",
+	HandlerFunction: UnsubscribeListHandler,
+}
+
+var GetListTimelineEndpoint = models.Endpoint{
+	Method:          models.GET,
+	Path:            constants.InitialURLLists + "/:listid/timeline",
+	HandlerFunction: GetListTimelineHandler,
+}
+
+var CreateCommunityEndpoint = models.Endpoint{
+	Method:          models.POST,
+	Path:            constants.InitialURLCommunities,
+	HandlerFunction: CreateCommunityHandler,
+}
+
+var GetCommunityEndpoint = models.Endpoint{
+	Method:          models.GET,
+	Path:            constants.InitialURLCommunities + "/:communityid",
+	HandlerFunction: GetCommunityHandler,
+}
+
+var UpdateCommunityRulesEndpoint = models.Endpoint{
+	Method:          models.PUT,
+	Path:            constants.InitialURLCommunities + "/:communityid/rules",
+	HandlerFunction: UpdateCommunityRulesHandler,
+}
+
+var JoinCommunityEndpoint = models.Endpoint{
+	Method:          models.PUT,
+	Path:            constants.InitialURLCommunities + "/:communityid/membership",
+	HandlerFunction: JoinCommunityHandler,
+}
+
+var LeaveCommunityEndpoint = models.Endpoint{
+	Method:          models.DELETE,
+	Path:            constants.InitialURLCommunities + "/:communityid/membership",
+	HandlerFunction: LeaveCommunityHandler,
+}
+
+var GetCommunityMembersEndpoint = models.Endpoint{
+	Method:          models.GET,
+	Path:            constants.InitialURLCommunities + "/:communityid/members",
+	HandlerFunction: GetCommunityMembersHandler,
+}
+
+var UpdateCommunityRoleEndpoint = models.Endpoint{
+	Method:          models.PUT,
+	Path:            constants.InitialURLCommunities + "/:communityid/members/:username/role",
+	HandlerFunction: UpdateCommunityRoleHandler,
+}
+
+var GetCommunityTimelineEndpoint = models.Endpoint{
+	Method:          models.GET,
+	Path:            constants.InitialURLCommunities + "/:communityid/timeline",
+	HandlerFunction: GetCommunityTimelineHandler,
+}
+
+var RemoveCommunityPostEndpoint = models.Endpoint{
+	Method:          models.DELETE,
+	Path:            constants.InitialURLCommunities + "/:communityid/posts/:postid",
+	HandlerFunction: RemoveCommunityPostHandler,
+}
+
+var GetHomeTimelineEndpoint = models.Endpoint{
+	Method:          models.GET,
+	Path:            constants.InitialURLTimeline + "/home",
+	HandlerFunction: GetHomeTimelineHandler,
+}
+
+var StreamHomeTimelineEndpoint = models.Endpoint{
+	Method:          models.GET,
+	Path:            constants.InitialURLTimeline + "/home/stream",
+	HandlerFunction: StreamHomeTimelineHandler,
+}
+
+var CountNewPostsEndpoint = models.Endpoint{
+	Method:          models.GET,
+	Path:            constants.InitialURLTimeline + "/new-count",
+	HandlerFunction: CountNewPostsHandler,
+}
+
+var GetForYouTimelineEndpoint = models.Endpoint{
+	Method:          models.GET,
+	Path:            constants.InitialURLTimeline + "/for-you",
+	HandlerFunction: GetForYouTimelineHandler,
+}
+
+var BlockUserEndpoint = models.Endpoint{
+	Method:          models.POST,
+	Path:            constants.InitialURLProfile + "/block/:username",
+	HandlerFunction: BlockUserHandler,
+}
+
+var UnblockUserEndpoint = models.Endpoint{
+	Method:          models.DELETE,
+	Path:            constants.InitialURLProfile + "/unblock/:username",
+	HandlerFunction: UnblockUserHandler,
+}
+
+var GetBlockedUsersEndpoint = models.Endpoint{
+	Method:          models.GET,
+	Path:            constants.InitialURLProfile + "/blocked",
+	HandlerFunction: GetBlockedUsersHandler,
+}
+
+var GetMutesEndpoint = models.Endpoint{
+	Method:          models.GET,
+	Path:            constants.InitialURLMutes,
+	HandlerFunction: GetMutesHandler,
+}
+
+var MuteAccountEndpoint = models.Endpoint{
+	Method:          models.POST,
+	Path:            constants.InitialURLMutes + "/accounts/:username",
+	HandlerFunction: MuteAccountHandler,
+}
+
+var UnmuteAccountEndpoint = models.Endpoint{
+	Method:          models.DELETE,
+	Path:            constants.InitialURLMutes + "/accounts/:username",
+	HandlerFunction: UnmuteAccountHandler,
+}
+
+var MuteWordEndpoint = models.Endpoint{
+	Method:          models.POST,
+	Path:            constants.InitialURLMutes + "/words",
+	HandlerFunction: MuteWordHandler,
+}
+
+var UnmuteWordEndpoint = models.Endpoint{
+	Method:          models.DELETE,
+	Path:            constants.InitialURLMutes + "/words/:wordid",
+	HandlerFunction: UnmuteWordHandler,
+}
+
+var MuteConversationEndpoint = models.Endpoint{
+	Method:          models.POST,
+	Path:            constants.InitialURLMutes + "/conversations/:postid",
+	HandlerFunction: MuteConversationHandler,
+}
+
+var UnmuteConversationEndpoint = models.Endpoint{
+	Method:          models.DELETE,
+	Path:            constants.InitialURLMutes + "/conversations/:postid",
+	HandlerFunction: UnmuteConversationHandler,
+}
+
+var GetUserRSSFeedEndpoint = models.Endpoint{
+	Method:          models.GET,
+	Path:            constants.InitialURLProfile + "/:username/feed.rss",
+	HandlerFunction: GetUserRSSFeedHandler,
+}
+
+var GetUserAtomFeedEndpoint = models.Endpoint{
+	Method:          models.GET,
+	Path:            constants.InitialURLProfile + "/:username/feed.atom",
+	HandlerFunction: GetUserAtomFeedHandler,
+}
+
+var WebFingerEndpoint = models.Endpoint{
+	Method:          models.GET,
+	Path:            constants.WebFingerPath,
+	HandlerFunction: WebFingerHandler,
+}
+
+var GetActorEndpoint = models.Endpoint{
+	Method:          models.GET,
+	Path:            constants.InitialURLFederation + "/users/:userid",
+	HandlerFunction: GetActorHandler,
+}
+
+var GetOutboxEndpoint = models.Endpoint{
+	Method:          models.GET,
+	Path:            constants.InitialURLFederation + "/users/:userid/outbox",
+	HandlerFunction: GetOutboxHandler,
+}
+
+var GetFollowersCollectionEndpoint = models.Endpoint{
+	Method:          models.GET,
+	Path:            constants.InitialURLFederation + "/users/:userid/followers",
+	HandlerFunction: GetFollowersCollectionHandler,
+}
+
+var UserInboxEndpoint = models.Endpoint{
+	Method:          models.POST,
+	Path:            constants.InitialURLFederation + "/users/:userid/inbox",
+	HandlerFunction: InboxHandler,
+}
+
+var SharedInboxEndpoint = models.Endpoint{
+	Method:          models.POST,
+	Path:            constants.InitialURLFederation + "/inbox",
+	HandlerFunction: InboxHandler,
+}
+
+var GetNoteEndpoint = models.Endpoint{
+	Method:          models.GET,
+	Path:            constants.InitialURLFederation + "/posts/:postid",
+	HandlerFunction: GetNoteHandler,
+}
+
 var PublicEndpoints = []models.Endpoint{
 	UserSignUpEndpoint,
 	UserLoginEndpoint,
@@ -242,6 +633,20 @@ var PublicEndpoints = []models.Endpoint{
 	CountLikesEndpoint,
 	CountCommentsEndpoint,
 	SearchEndpoint,
+	GetHashtagPostsEndpoint,
+	GetTrendingHashtagsEndpoint,
+	RecordProfileClickEndpoint,
+	GetPostStatesEndpoint,
+	GetUserListsEndpoint,
+	GetListEndpoint,
+	GetListMembersEndpoint,
+	GetListTimelineEndpoint,
+	GetCommunityEndpoint,
+	GetCommunityMembersEndpoint,
+	GetCommunityTimelineEndpoint,
+	GetForYouTimelineEndpoint,
+	GetUserRSSFeedEndpoint,
+	GetUserAtomFeedEndpoint,
 }
 
 var PrivateEndpoints = []models.Endpoint{
@@ -254,12 +659,16 @@ var PrivateEndpoints = []models.Endpoint{
 	CreatePostEndpoint,
 	EditPostEndpoint,
 	DeletePostEndpoint,
-	ToggleLikeEndPoint,
+	LikePostAliasEndpoint,
+	LikePostEndpoint,
+	UnlikePostEndpoint,
 	SendDirectMessageEndpoint,
 	ListConversationsEndpoint,
 	GetConversationMessagesEndpoint,
 	UserLogoutEndpoint,
 	CreateRepostEndpoint,
+	RepostEndpoint,
+	UnrepostEndpoint,
 	GetUserInfoEndpoint,
 	UpdateUsernameEndpoint,
 	CheckIfReposted,
@@ -268,4 +677,56 @@ var PrivateEndpoints = []models.Endpoint{
 	GetAllRepliesEndpoint,
 	PrivateSearchEndpoint,
 	PostsWLikesEndpoint,
+	GetMentionsEndpoint,
+	AddBookmarkEndpoint,
+	RemoveBookmarkEndpoint,
+	GetBookmarksEndpoint,
+	GetBookmarkFoldersEndpoint,
+	CreateBookmarkFolderEndpoint,
+	DeleteBookmarkFolderEndpoint,
+	PinPostEndpoint,
+	UnpinPostEndpoint,
+	UpdateReplyAudienceEndpoint,
+	GetPostAnalyticsEndpoint,
+	AddPostLabelEndpoint,
+	RemovePostLabelEndpoint,
+	UpdateSensitiveContentEndpoint,
+	CreateListEndpoint,
+	GetMyListsEndpoint,
+	DeleteListEndpoint,
+	AddListMemberEndpoint,
+	RemoveListMemberEndpoint,
+	SubscribeListEndpoint,
+	UnsubscribeListEndpoint,
+	CreateCommunityEndpoint,
+	UpdateCommunityRulesEndpoint,
+	JoinCommunityEndpoint,
+	LeaveCommunityEndpoint,
+	UpdateCommunityRoleEndpoint,
+	RemoveCommunityPostEndpoint,
+	GetHomeTimelineEndpoint,
+	StreamHomeTimelineEndpoint,
+	CountNewPostsEndpoint,
+	BlockUserEndpoint,
+	UnblockUserEndpoint,
+	GetBlockedUsersEndpoint,
+	GetMutesEndpoint,
+	MuteAccountEndpoint,
+	UnmuteAccountEndpoint,
+	MuteWordEndpoint,
+	UnmuteWordEndpoint,
+	MuteConversationEndpoint,
+	UnmuteConversationEndpoint,
+}
+
+// FederationEndpoints are served outside /api and without authentication, at the addresses other servers
+// expect; inbox requests are authenticated by their signature instead.
+var FederationEndpoints = []models.Endpoint{
+	WebFingerEndpoint,
+	GetActorEndpoint,
+	GetOutboxEndpoint,
+	GetFollowersCollectionEndpoint,
+	UserInboxEndpoint,
+	SharedInboxEndpoint,
+	GetNoteEndpoint,
 }
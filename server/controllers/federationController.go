@@ -0,0 +1,161 @@
+package controllers
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"x-clone/server/constants"
+	"x-clone/server/services/federation"
+	"x-clone/server/services/httpsig"
+)
+
+// WebFingerHandler GET /.well-known/webfinger?resource=acct:user@domain, how other servers find local accounts.
+func WebFingerHandler(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		resource := c.Query("resource")
+		if resource == constants.Empty {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Missing resource"})
+			return
+		}
+
+		finger, err := federation.GetWebFinger(db, resource)
+		if err != nil {
+			sendFederationError(c, err)
+			return
+		}
+		sendActivityJSON(c, http.StatusOK, "application/jrd+json", finger)
+	}
+}
+
+// GetActorHandler GET /ap/users/:userid, the actor of a local user.
+func GetActorHandler(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, ok := federationParam(c, "userid")
+		if !ok {
+			return
+		}
+		actor, err := federation.GetActor(db, userID)
+		if err != nil {
+			sendFederationError(c, err)
+			return
+		}
+		sendActivityJSON(c, http.StatusOK, federation.ContentType, actor)
+	}
+}
+
+// GetOutboxHandler GET /ap/users/:userid/outbox, the latest activities of a local user.
+func GetOutboxHandler(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, ok := federationParam(c, "userid")
+		if !ok {
+			return
+		}
+		outbox, err := federation.GetOutbox(db, userID)
+		if err != nil {
+			sendFederationError(c, err)
+			return
+		}
+		sendActivityJSON(c, http.StatusOK, federation.ContentType, outbox)
+	}
+}
+
+// GetFollowersCollectionHandler GET /ap/users/:userid/followers, the number of followers of a local user.
+func GetFollowersCollectionHandler(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, ok := federationParam(c, "userid")
+		if !ok {
+			return
+		}
+		followers, err := federation.GetFollowers(db, userID)
+		if err != nil {
+			sendFederationError(c, err)
+			return
+		}
+		sendActivityJSON(c, http.StatusOK, federation.ContentType, followers)
+	}
+}
+
+// GetNoteHandler GET /ap/posts/:postid, a local post as a note.
+func GetNoteHandler(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		postID, ok := federationParam(c, "postid")
+		if !ok {
+			return
+		}
+		note, err := federation.GetNote(db, postID)
+		if err != nil {
+			sendFederationError(c, err)
+			return
+		}
+		sendActivityJSON(c, http.StatusOK, federation.ContentType, note)
+	}
+}
+
+// InboxHandler POST /ap/users/:userid/inbox and POST /ap/inbox receive the signed activities of other servers.
+// The shared inbox takes the activities meant for several local users at once.
+func InboxHandler(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !federation.Enabled() {
+			c.JSON(http.StatusNotFound, gin.H{"error": federation.ErrDisabled.Error()})
+			return
+		}
+
+		body, err := io.ReadAll(io.LimitReader(c.Request.Body, constants.FederationMaxBodyBytes+1))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to read the activity"})
+			return
+		}
+		if len(body) > constants.FederationMaxBodyBytes {
+			c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": "Activity is too large"})
+			return
+		}
+
+		if err := federation.HandleInbox(db, c.Request, body); err != nil {
+			sendFederationError(c, err)
+			return
+		}
+		c.Status(http.StatusAccepted)
+	}
+}
+
+func federationParam(c *gin.Context, name string) (uint, bool) {
+	id, err := strconv.ParseUint(c.Param(name), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": federation.ErrNoActor.Error()})
+		return 0, false
+	}
+	return uint(id), true
+}
+
+// sendActivityJSON writes a document with the media type other servers expect, which c.JSON cannot set.
+func sendActivityJSON(c *gin.Context, status int, contentType string, document interface{}) {
+	body, err := json.Marshal(document)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return
+	}
+	c.Data(status, contentType, body)
+}
+
+func sendFederationError(c *gin.Context, err error) {
+	var syntaxErr *json.SyntaxError
+	var typeErr *json.UnmarshalTypeError
+	switch {
+	case errors.Is(err, federation.ErrDisabled), errors.Is(err, federation.ErrNoActor),
+		errors.Is(err, federation.ErrNoObject):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case errors.Is(err, httpsig.ErrNoSignature), errors.Is(err, httpsig.ErrInvalidSignature),
+		errors.Is(err, federation.ErrActorMismatch), errors.Is(err, federation.ErrRemoteFetch):
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+	case errors.As(err, &syntaxErr), errors.As(err, &typeErr):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid activity"})
+	default:
+		log.Println("Federation error:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+	}
+}
@@ -0,0 +1,87 @@
+package controllers
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"net/http"
+	"strings"
+	"x-clone/server/constants"
+	"x-clone/server/models"
+	"x-clone/server/services/feed"
+)
+
+// GetUserRSSFeedHandler GET /profile/:username/feed.rss, the latest posts of a user for feed readers.
+func GetUserRSSFeedHandler(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		serveUserFeed(c, db, feed.FormatRSS)
+	}
+}
+
+// GetUserAtomFeedHandler GET /profile/:username/feed.atom, the Atom counterpart of GetUserRSSFeedHandler.
+func GetUserAtomFeedHandler(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		serveUserFeed(c, db, feed.FormatAtom)
+	}
+}
+
+// serveUserFeed renders the feed of a user. Feed readers poll, so the feed can be cached for FeedMaxAge and
+// is not sent again while its ETag, a hash of its content, still matches.
+func serveUserFeed(c *gin.Context, db *gorm.DB, format feed.Format) {
+	username := c.Param("username")
+
+	var author models.User
+	if err := db.Where("username = ?", username).First(&author).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": constants.ErrNoUser})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return
+	}
+
+	posts, err := feed.GetLatestPosts(db, author.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return
+	}
+
+	scheme := "http"
+	if c.Request.TLS != nil || c.GetHeader("X-Forwarded-Proto") == "https" {
+		scheme = "https"
+	}
+	selfURL := fmt.Sprintf("%s://%s%s", scheme, c.Request.Host, c.Request.URL.Path)
+
+	body, err := feed.BuildUserFeed(format, author, posts, selfURL)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to build feed"})
+		return
+	}
+
+	sum := sha256.Sum256(body)
+	etag := `"` + hex.EncodeToString(sum[:]) + `"`
+	c.Header("ETag", etag)
+	c.Header("Cache-Control", fmt.Sprintf("public, max-age=%d", int(constants.FeedMaxAge.Seconds())))
+	if len(posts) > 0 {
+		c.Header("Last-Modified", posts[0].CreatedAt.UTC().Format(http.TimeFormat))
+	}
+	if matchesETag(c.GetHeader("If-None-Match"), etag) {
+		c.Status(http.StatusNotModified)
+		return
+	}
+
+	c.Data(http.StatusOK, format.ContentType(), body)
+}
+
+func matchesETag(ifNoneMatch, etag string) bool {
+	for _, candidate := range strings.Split(ifNoneMatch, ",") {
+		candidate = strings.TrimPrefix(strings.TrimSpace(candidate), "W/")
+		if candidate == etag || candidate == "*" {
+			return true
+		}
+	}
+	return false
+}
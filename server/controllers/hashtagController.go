@@ -0,0 +1,80 @@
+package controllers
+
+import (
+	"errors"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"net/http"
+	"strconv"
+	"time"
+	"x-clone/server/constants"
+	"x-clone/server/services/hashtag"
+	"x-clone/server/services/user"
+)
+
+// GetHashtagPostsHandler GET /hashtags/:tag?limit=20&cursor=42, the posts using a tag, newest first. since_id and
+// since leave out the posts the client already has.
+func GetHashtagPostsHandler(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		limit, cursor, err := parsePagination(c)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		since, err := parseSince(c)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		viewerID, _ := user.GetUserIDFromContext(c)
+		rawPosts, nextCursor, err := hashtag.GetPostsByHashtag(db, viewerID, c.Param("tag"), limit, cursor, since)
+		if err != nil {
+			if errors.Is(err, hashtag.ErrInvalidHashtag) {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+			return
+		}
+
+		posts, err := processPostsForViewer(c, db, rawPosts)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"posts":       posts,
+			"next_cursor": nextCursor,
+		})
+	}
+}
+
+// GetTrendingHashtagsHandler GET /explore/trending?window=1h&limit=10.
+func GetTrendingHashtagsHandler(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		window, err := time.ParseDuration(c.DefaultQuery("window", constants.TrendingDefaultWindow))
+		if err != nil || window < constants.TrendingMinWindow || window > constants.TrendingMaxWindow {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid window parameter"})
+			return
+		}
+
+		limit, err := strconv.Atoi(c.DefaultQuery("limit", strconv.Itoa(constants.TrendingDefaultLimit)))
+		if err != nil || limit <= 0 || limit > constants.TrendingMaxLimit {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid limit parameter"})
+			return
+		}
+
+		trends, err := hashtag.GetTrendingHashtags(db, window, limit)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to compute trending hashtags"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"window": window.String(),
+			"trends": trends,
+		})
+	}
+}
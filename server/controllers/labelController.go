@@ -0,0 +1,123 @@
+package controllers
+
+import (
+	"errors"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"net/http"
+	"strconv"
+	"x-clone/server/constants"
+	"x-clone/server/models"
+	"x-clone/server/services/label"
+	"x-clone/server/services/user"
+)
+
+// AddPostLabelHandler POST /posts/:postid/labels, lets a moderator add a content warning to any post.
+func AddPostLabelHandler(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		postID, ok := moderatedPostID(c, db)
+		if !ok {
+			return
+		}
+
+		var req struct {
+			Label models.ContentLabel `json:"label" binding:"required"`
+		}
+		if errJSON := c.ShouldBindJSON(&req); errJSON != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Label is required"})
+			return
+		}
+		labels, err := label.NormalizeLabels([]models.ContentLabel{req.Label})
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		moderatorID, _ := user.GetUserIDFromContext(c)
+		if err := label.AddLabels(db, postID, moderatorID, true, labels); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to label post"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"message": "post labeled successfully", "label": labels[0]})
+	}
+}
+
+// RemovePostLabelHandler DELETE /posts/:postid/labels/:label, lets a moderator remove a content warning.
+func RemovePostLabelHandler(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		postID, ok := moderatedPostID(c, db)
+		if !ok {
+			return
+		}
+
+		labels, err := label.NormalizeLabels([]models.ContentLabel{models.ContentLabel(c.Param("label"))})
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		if err := label.RemoveLabel(db, postID, labels[0]); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to remove label"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"message": "label removed successfully"})
+	}
+}
+
+// UpdateSensitiveContentHandler PUT /profile/sensitive-content, sets how the viewer wants labeled posts shown.
+func UpdateSensitiveContentHandler(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, _ := user.GetUserIDFromContext(c)
+
+		var req struct {
+			Preference models.SensitivePreference `json:"preference" binding:"required"`
+		}
+		if errJSON := c.ShouldBindJSON(&req); errJSON != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Preference is required"})
+			return
+		}
+
+		if err := label.SetPreference(db, userID, req.Preference); err != nil {
+			if errors.Is(err, label.ErrInvalidPreference) {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update sensitive content preference"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"message": "preference updated successfully", "sensitive_content": req.Preference})
+	}
+}
+
+// moderatedPostID checks that the viewer is a moderator and that the post exists, writing the error response
+// otherwise.
+func moderatedPostID(c *gin.Context, db *gorm.DB) (uint, bool) {
+	userID, _ := user.GetUserIDFromContext(c)
+	isModerator, err := label.IsModerator(db, userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return 0, false
+	}
+	if !isModerator {
+		c.JSON(http.StatusForbidden, gin.H{"error": label.ErrNotModerator.Error()})
+		return 0, false
+	}
+
+	postID, atoiErr := strconv.Atoi(c.Param("postid"))
+	if atoiErr != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid post ID"})
+		return 0, false
+	}
+	if _, err := user.GetSimplePostByID(db, uint(postID)); err != nil {
+		if err.Error() == constants.ErrNoPost {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return 0, false
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return 0, false
+	}
+	return uint(postID), true
+}
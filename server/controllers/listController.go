@@ -0,0 +1,264 @@
+package controllers
+
+import (
+	"errors"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"net/http"
+	"strconv"
+	"x-clone/server/mappers"
+	"x-clone/server/models"
+	"x-clone/server/services/list"
+	"x-clone/server/services/user"
+)
+
+func CreateListHandler(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, _ := user.GetUserIDFromContext(c)
+
+		var req struct {
+			Name        string `json:"name" binding:"required"`
+			Description string `json:"description"`
+			Private     bool   `json:"private"`
+		}
+		if errJSON := c.ShouldBindJSON(&req); errJSON != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "List name is required"})
+			return
+		}
+
+		created, err := list.CreateList(db, userID, req.Name, req.Description, req.Private)
+		if err != nil {
+			sendListError(c, err, "Failed to create list")
+			return
+		}
+
+		c.JSON(http.StatusCreated, gin.H{"message": "List created successfully", "list": created})
+	}
+}
+
+// GetMyListsHandler GET /lists, returns the lists owned by the viewer and the ones they subscribed to.
+func GetMyListsHandler(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, _ := user.GetUserIDFromContext(c)
+
+		owned, err := list.GetListsOfOwner(db, userID, userID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load lists"})
+			return
+		}
+		subscribed, err := list.GetSubscribedLists(db, userID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load lists"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"lists": owned, "subscribed": subscribed})
+	}
+}
+
+// GetUserListsHandler GET /profile/:username/lists, private lists are only returned to their owner.
+func GetUserListsHandler(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var owner models.User
+		if err := db.Where("username = ?", c.Param("username")).First(&owner).Error; err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+			return
+		}
+
+		viewerID, _ := user.GetUserIDFromContext(c)
+		lists, err := list.GetListsOfOwner(db, viewerID, owner.ID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load lists"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"lists": lists})
+	}
+}
+
+func GetListHandler(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		listID, ok := parseListID(c)
+		if !ok {
+			return
+		}
+
+		viewerID, _ := user.GetUserIDFromContext(c)
+		found, err := list.GetList(db, viewerID, listID)
+		if err != nil {
+			sendListError(c, err, "Failed to load list")
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"list": found})
+	}
+}
+
+func DeleteListHandler(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		listID, ok := parseListID(c)
+		if !ok {
+			return
+		}
+
+		userID, _ := user.GetUserIDFromContext(c)
+		if err := list.DeleteList(db, userID, listID); err != nil {
+			sendListError(c, err, "Failed to delete list")
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"message": "List deleted successfully"})
+	}
+}
+
+func GetListMembersHandler(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		listID, ok := parseListID(c)
+		if !ok {
+			return
+		}
+
+		viewerID, _ := user.GetUserIDFromContext(c)
+		members, err := list.GetMembers(db, viewerID, listID)
+		if err != nil {
+			sendListError(c, err, "Failed to load list members")
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"members": mappers.MapUsersToResponses(members)})
+	}
+}
+
+func AddListMemberHandler(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		listID, ok := parseListID(c)
+		if !ok {
+			return
+		}
+
+		userID, _ := user.GetUserIDFromContext(c)
+		if err := list.AddMember(db, userID, listID, c.Param("username")); err != nil {
+			sendListError(c, err, "Failed to add list member")
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"message": "member added successfully"})
+	}
+}
+
+func RemoveListMemberHandler(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		listID, ok := parseListID(c)
+		if !ok {
+			return
+		}
+
+		userID, _ := user.GetUserIDFromContext(c)
+		if err := list.RemoveMember(db, userID, listID, c.Param("username")); err != nil {
+			sendListError(c, err, "Failed to remove list member")
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"message": "member removed successfully"})
+	}
+}
+
+func SubscribeListHandler(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		listID, ok := parseListID(c)
+		if !ok {
+			return
+		}
+
+		userID, _ := user.GetUserIDFromContext(c)
+		if err := list.Subscribe(db, userID, listID); err != nil {
+			sendListError(c, err, "Failed to subscribe to list")
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"message": "subscribed successfully", "subscribed": true})
+	}
+}
+
+func UnsubscribeListHandler(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		listID, ok := parseListID(c)
+		if !ok {
+			return
+		}
+
+		userID, _ := user.GetUserIDFromContext(c)
+		if err := list.Unsubscribe(db, userID, listID); err != nil {
+			sendListError(c, err, "Failed to unsubscribe from list")
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"message": "unsubscribed successfully", "subscribed": false})
+	}
+}
+
+// GetListTimelineHandler GET /lists/:listid/timeline?limit=20&cursor=42, the posts of the list members. since_id
+// and since leave out the posts the client already has.
+func GetListTimelineHandler(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		listID, ok := parseListID(c)
+		if !ok {
+			return
+		}
+
+		limit, cursor, err := parsePagination(c)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		since, err := parseSince(c)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		viewerID, _ := user.GetUserIDFromContext(c)
+		rawPosts, nextCursor, err := list.GetListTimeline(db, viewerID, listID, limit, cursor, since)
+		if err != nil {
+			sendListError(c, err, "Internal server error")
+			return
+		}
+
+		posts, err := processPostsForViewer(c, db, rawPosts)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"posts":       posts,
+			"next_cursor": nextCursor,
+		})
+	}
+}
+
+func parseListID(c *gin.Context) (uint, bool) {
+	listID, err := strconv.ParseUint(c.Param("listid"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid list ID"})
+		return 0, false
+	}
+	return uint(listID), true
+}
+
+// sendListError maps the errors of the list service to responses, falling back to a 500 with the given message.
+func sendListError(c *gin.Context, err error, fallback string) {
+	switch {
+	case errors.Is(err, list.ErrInvalidListName), errors.Is(err, list.ErrDescriptionTooLong),
+		errors.Is(err, list.ErrOwnList):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, list.ErrNoList), errors.Is(err, list.ErrNoUser):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case errors.Is(err, list.ErrNotListOwner):
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+	case errors.Is(err, list.ErrListFull):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fallback})
+	}
+}
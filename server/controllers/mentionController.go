@@ -0,0 +1,49 @@
+package controllers
+
+import (
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"net/http"
+	"x-clone/server/services/mention"
+	"x-clone/server/services/user"
+)
+
+// GetMentionsHandler GET /posts/mentions?limit=20&cursor=42, the posts mentioning the viewer, newest first.
+// since_id and since leave out the posts the client already has.
+func GetMentionsHandler(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, err := user.GetUserIDFromContext(c)
+		if err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Authentication required"})
+			return
+		}
+
+		limit, cursor, err := parsePagination(c)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		since, err := parseSince(c)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		rawPosts, nextCursor, err := mention.GetMentionsOfUser(db, userID, limit, cursor, since)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+			return
+		}
+
+		posts, err := processPostsForViewer(c, db, rawPosts)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"posts":       posts,
+			"next_cursor": nextCursor,
+		})
+	}
+}
@@ -0,0 +1,161 @@
+package controllers
+
+import (
+	"errors"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"net/http"
+	"strconv"
+	"time"
+	"x-clone/server/constants"
+	"x-clone/server/mappers"
+	"x-clone/server/services/mute"
+	"x-clone/server/services/user"
+)
+
+// GetMutesHandler GET /mutes, the accounts, unexpired words and conversations muted by the viewer.
+func GetMutesHandler(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, _ := user.GetUserIDFromContext(c)
+
+		accounts, err := mute.GetMutedAccounts(db, userID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load mutes"})
+			return
+		}
+		words, err := mute.GetMutedWords(db, userID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load mutes"})
+			return
+		}
+		conversations, err := mute.GetMutedConversations(db, userID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load mutes"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"accounts":      mappers.MapUsersToResponses(accounts),
+			"words":         words,
+			"conversations": user.ProcessPosts(conversations),
+		})
+	}
+}
+
+// MuteAccountHandler POST /mutes/accounts/:username, the muted account is not told.
+func MuteAccountHandler(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, _ := user.GetUserIDFromContext(c)
+
+		if err := mute.MuteAccount(db, userID, c.Param("username")); err != nil {
+			sendMuteError(c, err, "Failed to mute account")
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"message": "muted successfully", "muted": true})
+	}
+}
+
+func UnmuteAccountHandler(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, _ := user.GetUserIDFromContext(c)
+
+		if err := mute.UnmuteAccount(db, userID, c.Param("username")); err != nil {
+			sendMuteError(c, err, "Failed to unmute account")
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"message": "unmuted successfully", "muted": false})
+	}
+}
+
+// MuteWordHandler POST /mutes/words with {"phrase": "spoilers", "expires_at": "2025-01-01T00:00:00Z"}, the
+// expiry being optional.
+func MuteWordHandler(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req struct {
+			Phrase    string     `json:"phrase" binding:"required"`
+			ExpiresAt *time.Time `json:"expires_at"`
+		}
+		if errJSON := c.ShouldBindJSON(&req); errJSON != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Phrase is required"})
+			return
+		}
+
+		userID, _ := user.GetUserIDFromContext(c)
+		word, err := mute.MuteWord(db, userID, req.Phrase, req.ExpiresAt)
+		if err != nil {
+			sendMuteError(c, err, "Failed to mute word")
+			return
+		}
+
+		c.JSON(http.StatusCreated, gin.H{"message": "word muted successfully", "word": word})
+	}
+}
+
+func UnmuteWordHandler(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		wordID, err := strconv.ParseUint(c.Param("wordid"), 10, 32)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid word ID"})
+			return
+		}
+
+		userID, _ := user.GetUserIDFromContext(c)
+		if err := mute.UnmuteWord(db, userID, uint(wordID)); err != nil {
+			sendMuteError(c, err, "Failed to unmute word")
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"message": "word unmuted successfully"})
+	}
+}
+
+// MuteConversationHandler POST /mutes/conversations/:postid, mutes the whole thread the post belongs to.
+func MuteConversationHandler(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		toggleConversationMute(c, db, true)
+	}
+}
+
+func UnmuteConversationHandler(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		toggleConversationMute(c, db, false)
+	}
+}
+
+func toggleConversationMute(c *gin.Context, db *gorm.DB, muted bool) {
+	postID, atoiErr := strconv.Atoi(c.Param("postid"))
+	if atoiErr != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid post ID"})
+		return
+	}
+
+	userID, _ := user.GetUserIDFromContext(c)
+	if muted {
+		if err := mute.MuteConversation(db, userID, uint(postID)); err != nil {
+			sendMuteError(c, err, "Failed to mute conversation")
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"message": "conversation muted successfully", "muted": true})
+		return
+	}
+
+	if err := mute.UnmuteConversation(db, userID, uint(postID)); err != nil {
+		sendMuteError(c, err, "Failed to unmute conversation")
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "conversation unmuted successfully", "muted": false})
+}
+
+func sendMuteError(c *gin.Context, err error, fallback string) {
+	switch {
+	case errors.Is(err, mute.ErrCannotMuteSelf), errors.Is(err, mute.ErrInvalidPhrase),
+		errors.Is(err, mute.ErrExpiryInPast), errors.Is(err, mute.ErrTooManyMutedWords):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case err.Error() == constants.ErrNoUser, err.Error() == constants.ErrNoPost:
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fallback})
+	}
+}
@@ -8,15 +8,36 @@ import (
 	"log"
 	"net/http"
 	"strconv"
+	"strings"
+	"time"
 	"x-clone/server/constants"
 	"x-clone/server/mappers"
 	"x-clone/server/models"
+	"x-clone/server/services/block"
+	"x-clone/server/services/community"
+	"x-clone/server/services/federation"
+	"x-clone/server/services/hashtag"
+	"x-clone/server/services/label"
+	"x-clone/server/services/mention"
+	"x-clone/server/services/mute"
+	"x-clone/server/services/timeline"
+	"x-clone/server/services/unfurl"
 	"x-clone/server/services/user"
+	"x-clone/server/services/validation"
 )
 
+// GetAllPostsHandler GET /posts?since_id=42&since=2024-05-01T10:00:00Z, every post, or only the posts newer
+// than the optional bounds.
 func GetAllPostsHandler(db *gorm.DB) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		rawPosts, err := user.GetAllPosts(db)
+		since, err := parseSince(c)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		viewerID, _ := user.GetUserIDFromContext(c)
+		rawPosts, err := user.GetAllPosts(db, viewerID, since)
 
 		if err != nil {
 			if errors.Is(err, gorm.ErrRecordNotFound) {
@@ -27,7 +48,11 @@ func GetAllPostsHandler(db *gorm.DB) gin.HandlerFunc {
 			return
 		}
 
-		listPosts := user.ProcessPosts(rawPosts)
+		listPosts, err := processPostsForViewer(c, db, rawPosts)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+			return
+		}
 		c.JSON(http.StatusOK, listPosts) // <- Directly return the array
 	}
 }
@@ -47,7 +72,11 @@ func GetAllRepliesHandler(db *gorm.DB) gin.HandlerFunc {
 			return
 		}
 
-		listPosts := user.ProcessPosts(rawPosts)
+		listPosts, err := processPostsForViewer(c, db, rawPosts)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+			return
+		}
 		c.JSON(http.StatusOK, listPosts) // <- Directly return the array
 	}
 }
@@ -67,7 +96,11 @@ func PostsWLikesHandler(db *gorm.DB) gin.HandlerFunc {
 			return
 		}
 
-		listPosts := user.ProcessPosts(rawPosts)
+		listPosts, err := processPostsForViewer(c, db, rawPosts)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+			return
+		}
 		c.JSON(http.StatusOK, listPosts) // <- Directly return the array
 	}
 }
@@ -86,11 +119,101 @@ func GetPostsByUsernameHandler(db *gorm.DB) gin.HandlerFunc {
 			return
 		}
 
-		listPosts := user.ProcessPosts(rawPosts)
+		var author models.User
+		if errUser := db.Select("pinned_post_id").Where("username = ?", username).First(&author).Error; errUser != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+			return
+		}
+
+		listPosts, err := processPostsForViewer(c, db, rawPosts)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+			return
+		}
+		listPosts = pinFirst(listPosts, author.PinnedPostID)
 		c.JSON(http.StatusOK, listPosts) //
 	}
 }
 
+func PinPostHandler(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, _ := user.GetUserIDFromContext(c)
+		postID, atoiErr := strconv.Atoi(c.Param("postid"))
+		if atoiErr != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid post ID"})
+			return
+		}
+
+		if err := user.PinPost(db, userID, uint(postID)); err != nil {
+			switch {
+			case err.Error() == constants.ErrNoPost:
+				c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			case errors.Is(err, user.ErrCannotPinPost):
+				c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+			default:
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to pin post"})
+			}
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"message": "post pinned successfully"})
+	}
+}
+
+func UnpinPostHandler(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, _ := user.GetUserIDFromContext(c)
+		postID, atoiErr := strconv.Atoi(c.Param("postid"))
+		if atoiErr != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid post ID"})
+			return
+		}
+
+		if err := user.UnpinPost(db, userID, uint(postID)); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to unpin post"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"message": "post unpinned successfully"})
+	}
+}
+
+// UpdateReplyAudienceHandler PUT /posts/:postid/reply-audience with {"reply_audience": "mentioned"}.
+func UpdateReplyAudienceHandler(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, _ := user.GetUserIDFromContext(c)
+		postID, atoiErr := strconv.Atoi(c.Param("postid"))
+		if atoiErr != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid post ID"})
+			return
+		}
+
+		var req struct {
+			ReplyAudience models.ReplyAudience `json:"reply_audience" binding:"required"`
+		}
+		if errJSON := c.ShouldBindJSON(&req); errJSON != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Reply audience is required"})
+			return
+		}
+
+		if err := user.SetReplyAudience(db, userID, uint(postID), req.ReplyAudience); err != nil {
+			switch {
+			case errors.Is(err, user.ErrInvalidReplyAudience):
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			case err.Error() == constants.ErrNoPost:
+				c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			case errors.Is(err, user.ErrNotPostOwner):
+				c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+			default:
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update reply audience"})
+			}
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"message": "reply audience updated successfully", "reply_audience": req.ReplyAudience})
+	}
+}
+
 func GetSpecificPostHandler(db *gorm.DB) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		postID, errPostID := strconv.Atoi(c.Param("postid"))
@@ -101,7 +224,7 @@ func GetSpecificPostHandler(db *gorm.DB) gin.HandlerFunc {
 
 		var post models.Post
 		// Use Preload to eagerly load the ParentPost relationship
-		if err := db.Preload("ParentPost").First(&post, postID).Error; err != nil {
+		if err := db.Scopes(models.WithPostRelations).First(&post, postID).Error; err != nil {
 			if errors.Is(err, gorm.ErrRecordNotFound) {
 				c.JSON(http.StatusNotFound, gin.H{"error": constants.ErrNoPost})
 				return
@@ -110,8 +233,17 @@ func GetSpecificPostHandler(db *gorm.DB) gin.HandlerFunc {
 			return
 		}
 
-		// Process the single post using the ProcessPost function
-		processedPost := user.ProcessPost(post)
+		// Process the single post for the current viewer, who cannot see the posts of or referring to a user they
+		// blocked or were blocked by, nor what they muted
+		processedPost, visible, errProcess := processPostForViewer(c, db, post)
+		if errProcess != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+			return
+		}
+		if !visible {
+			c.JSON(http.StatusNotFound, gin.H{"error": constants.ErrNoPost})
+			return
+		}
 
 		c.JSON(http.StatusOK, gin.H{"post": processedPost})
 	}
@@ -131,33 +263,53 @@ func CreatePostHandler(db *gorm.DB) gin.HandlerFunc {
 			return
 		}
 
-		// Validate post body
-		if errValidate := validatePostBody(req.Body); errValidate != nil {
-			sendErrorResponse(c, http.StatusBadRequest, errValidate.Error())
+		audience := req.audience()
+		if !audience.IsValid() {
+			sendErrorResponse(c, http.StatusBadRequest, user.ErrInvalidReplyAudience.Error())
 			return
 		}
 
-		// Ensure the parent post exists (if provided)
-		if req.ParentID != nil {
-			if _, errFetch := fetchParentPost(db, req.ParentID); errFetch != nil {
-				sendErrorResponse(c, http.StatusNotFound, errFetch.Error())
+		// Work out the kind of the post from the references it carries
+		kind, referencedID := req.kind()
+		if referencedID != nil {
+			referenced, errFetch := resolveReferencedPost(db, *referencedID)
+			if errFetch != nil {
+				sendErrorResponse(c, http.StatusNotFound, "referenced post not found")
 				return
 			}
+			referencedID = &referenced.ID
+		}
+
+		// Validate post body
+		body, postErr := validateContent(db, validation.Content{
+			Kind:     validationKind(kind),
+			AuthorID: userID,
+			Text:     req.text(),
+		})
+		if postErr != nil {
+			c.JSON(postErr.Status, postErr.Message)
+			return
+		}
+
+		labels, err := label.NormalizeLabels(req.Labels)
+		if err != nil {
+			sendErrorResponse(c, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		if communityErr := checkCanPostInCommunity(db, userID, kind, req.CommunityID); communityErr != nil {
+			c.JSON(communityErr.Status, communityErr.Message)
+			return
 		}
 
 		// Create post
-		createdPost, err := user.CreatePost(db,
-			userID,
-			nickname,
-			req.ParentID,
-			username,
-			req.Quote,
-			req.Body,
-			req.ParentID != nil)
+		createdPost, err := user.CreatePost(db, userID, nickname, username, kind, referencedID, body, audience, labels,
+			req.CommunityID)
 		if err != nil {
 			handlePostCreationError(c, err)
 			return
 		}
+		federation.PublishPost(db, *createdPost)
 
 		// Fetch and process the post
 		processedPost, err := fetchAndProcessPost(db, createdPost.ID)
@@ -201,6 +353,8 @@ func DeletePostHandler(db *gorm.DB) gin.HandlerFunc {
 	}
 }
 
+// CreateRepostHandler POST /posts/:postid/repost creates a quote when a quote is given. Without one it is a
+// deprecated alias of RepostHandler kept for older clients, and reposting an already reposted post changes nothing.
 func CreateRepostHandler(db *gorm.DB) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		userID, _ := user.GetUserIDFromContext(c)
@@ -217,60 +371,117 @@ func CreateRepostHandler(db *gorm.DB) gin.HandlerFunc {
 		}
 		parentIDUint := uint(parentID)
 
-		parentPost, err := resolveParentPost(db, parentIDUint)
+		// The quote is optional: without one the post is reposted, like PUT does
+		var payload struct {
+			Quote string `json:"quote"`
+		}
+		if c.Request.ContentLength > 0 {
+			if errJSON := c.ShouldBindJSON(&payload); errJSON != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "invalid JSON payload"})
+				return
+			}
+		}
+		if payload.Quote == constants.Empty {
+			RepostHandler(db)(c)
+			return
+		}
+
+		parentPost, err := resolveReferencedPost(db, parentIDUint)
 		if err != nil {
 			c.JSON(http.StatusNotFound, gin.H{"error": "Original post or comment not found"})
 			return
 		}
 
-		handled, err := handleExistingRepost(db, userID, parentPost.ID)
+		postErr := createRepost(c, db, parentPost.ID, models.KindQuote, payload.Quote)
+		c.JSON(postErr.Status, postErr.Message)
+	}
+}
+
+// RepostHandler PUT /posts/:postid/repost reposts a post; reposting it again changes nothing.
+func RepostHandler(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, _ := user.GetUserIDFromContext(c)
+		username, _ := user.GetUsernameIDFromContext(c)
+		nickname, _ := user.GetNicknameFromContext(c)
+
+		postID, atoiErr := strconv.Atoi(c.Param("postid"))
+		if atoiErr != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid post ID"})
+			return
+		}
+
+		parentPost, err := resolveReferencedPost(db, uint(postID))
 		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to handle repost"})
+			c.JSON(http.StatusNotFound, gin.H{"error": "Original post or comment not found"})
 			return
 		}
-		if handled {
-			c.JSON(http.StatusOK, gin.H{"message": "Repost deleted successfully"})
+
+		repost, created, err := user.Repost(db, userID, nickname, username, parentPost.ID)
+		if err != nil {
+			handlePostCreationError(c, err)
 			return
 		}
 
-		postErr := createRepost(c, db, int(parentPost.ID))
-		if postErr.Status != http.StatusCreated {
-			c.JSON(postErr.Status, postErr.Message)
+		status := http.StatusOK
+		if created {
+			status = http.StatusCreated
+			federation.PublishPost(db, *repost)
+		}
+		c.JSON(status, gin.H{"message": "reposted successfully", "reposted": true, "repost_id": repost.ID})
+	}
+}
+
+// UnrepostHandler DELETE /posts/:postid/repost removes the repost of a post, if any.
+func UnrepostHandler(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, _ := user.GetUserIDFromContext(c)
+		postID, atoiErr := strconv.Atoi(c.Param("postid"))
+		if atoiErr != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid post ID"})
 			return
 		}
 
-		if errIncrement := incrementRepostCount(db, parentPost.ID); errIncrement != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update repost count"})
+		parentPost, err := resolveReferencedPost(db, uint(postID))
+		if err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Original post or comment not found"})
 			return
 		}
 
-		c.JSON(http.StatusCreated, postErr.Message)
+		if errUnrepost := unrepost(db, userID, parentPost.ID); errUnrepost != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to remove repost"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"message": "repost removed successfully", "reposted": false})
 	}
 }
 
-func ToggleLikeHandler(db *gorm.DB) gin.HandlerFunc {
+// LikePostHandler PUT /posts/:postid/like likes a post; liking it again changes nothing. POST is kept as a
+// deprecated alias for older clients and no longer toggles the like.
+func LikePostHandler(db *gorm.DB) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		userID, _ := c.Get("userID")
-		likerID, _ := userID.(uint)
-
+		likerID, _ := user.GetUserIDFromContext(c)
 		postID, atoiErr := strconv.Atoi(c.Param("postid"))
 		if atoiErr != nil {
 			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid post ID"})
 			return
 		}
 
-		toggleResult, toggleErr := user.ToggleLike(db, likerID, uint(postID))
-		if toggleErr != nil {
-			log.Println("Toggle Like error:", toggleErr)
-			if toggleResult.IsLiked {
-				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to like post"})
-			} else {
-				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to unlike post"})
-			}
+		likePost(c, db, likerID, uint(postID))
+	}
+}
+
+// UnlikePostHandler DELETE /posts/:postid/like removes the like of a post, if any.
+func UnlikePostHandler(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		likerID, _ := user.GetUserIDFromContext(c)
+		postID, atoiErr := strconv.Atoi(c.Param("postid"))
+		if atoiErr != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid post ID"})
 			return
 		}
 
-		c.JSON(http.StatusOK, gin.H{"message": toggleResult.MessageStatus})
+		unlikePost(c, db, likerID, uint(postID))
 	}
 }
 
@@ -293,10 +504,10 @@ func CheckRepostedHandler(db *gorm.DB) gin.HandlerFunc {
 
 		// Check for existing repost
 		var existingRepost models.Post
-		err = db.Where("user_id = ? AND parent_id = ? AND is_repost = ?",
+		err = db.Where("user_id = ? AND quoted_post_id = ? AND kind = ?",
 			userID,
 			postID,
-			true).
+			models.KindRepost).
 			First(&existingRepost).Error
 
 		if errors.Is(err, gorm.ErrRecordNotFound) {
@@ -357,16 +568,19 @@ func GetCommentsHandler(db *gorm.DB) gin.HandlerFunc {
 
 		var comments []models.Post
 		// Preload ParentPost to include it in the processing
-		result := db.Preload("ParentPost").Where("parent_id = ? AND is_repost = ?", uint(postID), false).Find(&comments)
+		result := db.Scopes(models.WithPostRelations).
+			Where("reply_to_id = ?", uint(postID)).
+			Find(&comments)
 		if result.Error != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch comments"})
 			return
 		}
 
-		// Process each comment using ProcessPost
-		processedComments := make([]mappers.PostResponse, len(comments))
-		for i, comment := range comments {
-			processedComments[i] = user.ProcessPost(comment) // Use user.ProcessPost if part of a package
+		// Process each comment for the current viewer
+		processedComments, err := processPostsForViewer(c, db, comments)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+			return
 		}
 
 		c.JSON(http.StatusOK, gin.H{"comments": processedComments})
@@ -398,6 +612,43 @@ func CountRepostsHandler(db *gorm.DB) gin.HandlerFunc {
 	}
 }
 
+// GetPostStatesHandler GET /posts/state?ids=1,2,3 returns the counters and viewer flags of many posts at once.
+func GetPostStatesHandler(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if c.Query("ids") == constants.Empty {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "ids parameter is required"})
+			return
+		}
+
+		rawIDs := strings.Split(c.Query("ids"), ",")
+		if len(rawIDs) > constants.MaxPostStateIDs {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": fmt.Sprintf("cannot request more than %d posts", constants.MaxPostStateIDs),
+			})
+			return
+		}
+
+		postIDs := make([]uint, 0, len(rawIDs))
+		for _, rawID := range rawIDs {
+			postID, err := strconv.ParseUint(strings.TrimSpace(rawID), 10, 32)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid post ID"})
+				return
+			}
+			postIDs = append(postIDs, uint(postID))
+		}
+
+		viewerID, _ := user.GetUserIDFromContext(c)
+		states, err := user.GetPostStates(db, viewerID, postIDs)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve post states"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"posts": states})
+	}
+}
+
 func CountLikesHandler(db *gorm.DB) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		// Extract parent post ID from URL
@@ -458,9 +709,9 @@ func CreateCommentHandler(db *gorm.DB) gin.HandlerFunc {
 			return
 		}
 
-		// Check if parent post exists
-		var parentPost models.Post
-		if errDB := db.First(&parentPost, parentPostID).Error; errDB != nil {
+		// Check if parent post exists, replying to the original of a repost
+		parentPost, errDB := resolveReferencedPost(db, uint(parentPostID))
+		if errDB != nil {
 			c.JSON(http.StatusNotFound, gin.H{"error": "Parent post not found"})
 			return
 		}
@@ -472,8 +723,7 @@ func CreateCommentHandler(db *gorm.DB) gin.HandlerFunc {
 
 		// Parse request body
 		var req struct {
-			Body  string  `json:"body"`
-			Quote *string `json:"quote"`
+			Body string `json:"body"`
 		}
 		if errJSON := c.ShouldBindJSON(&req); errJSON != nil {
 			c.JSON(http.StatusBadRequest, gin.H{"error": errJSON.Error()})
@@ -481,26 +731,36 @@ func CreateCommentHandler(db *gorm.DB) gin.HandlerFunc {
 		}
 
 		// Validate body
-		if errValidate := validatePostBody(req.Body); errValidate != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": errValidate.Error()})
+		body, postErr := validateContent(db, validation.Content{
+			Kind:     validation.Comment,
+			AuthorID: userID,
+			Text:     req.Body,
+		})
+		if postErr != nil {
+			c.JSON(postErr.Status, postErr.Message)
 			return
 		}
-		// Create the comment (set ParentID and IsRepost=false)
-		parentIDUint := uint(parentPostID)
-		createdPost, err := user.CreatePost(
-			db,
+
+		// Create the reply
+		createdPost, err := user.CreatePost(db,
 			userID,
 			nickname,
-			&parentIDUint, // ParentID from URL
 			username,
-			req.Quote,
-			req.Body,
-			false, // isRepost explicitly set to false
-		)
+			models.KindReply,
+			&parentPost.ID,
+			body,
+			models.ReplyEveryone,
+			nil,
+			nil)
+		if errors.Is(err, block.ErrBlocked) || errors.Is(err, user.ErrReplyNotAllowed) {
+			c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+			return
+		}
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create comment"})
 			return
 		}
+		federation.PublishPost(db, *createdPost)
 
 		// Return the created comment
 		c.JSON(http.StatusCreated, gin.H{
@@ -512,55 +772,41 @@ func CreateCommentHandler(db *gorm.DB) gin.HandlerFunc {
 
 // AUX.
 
-func resolveParentPost(db *gorm.DB, parentID uint) (models.Post, error) {
-	var parentPost models.Post
-	if err := db.First(&parentPost, parentID).Error; err != nil {
-		return models.Post{}, err
-	}
-
-	if parentPost.IsRepost && parentPost.ParentID != nil {
-		var originalPost models.Post
-		if err := db.First(&originalPost, *parentPost.ParentID).Error; err != nil {
-			return models.Post{}, err
+func likePost(c *gin.Context, db *gorm.DB, userID, postID uint) {
+	if err := user.LikePost(db, userID, postID); err != nil {
+		log.Println("Like error:", err)
+		if errors.Is(err, block.ErrBlocked) {
+			c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+			return
 		}
-		parentPost = originalPost
+		switch err.Error() {
+		case constants.ErrNoPost:
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		case constants.ErrNoUser:
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to like post"})
+		}
+		return
 	}
 
-	return parentPost, nil
+	federation.PublishLike(db, userID, postID, true)
+	c.JSON(http.StatusOK, gin.H{"message": "liked successfully", "liked": true})
 }
 
-func handleExistingRepost(db *gorm.DB, userID, parentPostID uint) (bool, error) {
-	var existingRepost models.Post
-	err := db.Where("user_id = ? AND parent_id = ? AND is_repost = ?", userID, parentPostID, true).
-		First(&existingRepost).Error
-
-	if errors.Is(err, gorm.ErrRecordNotFound) {
-		return false, nil
-	}
-	if err != nil {
-		return false, err
-	}
-
-	if errDB := db.Delete(&existingRepost).Error; errDB != nil {
-		return false, errDB
-	}
-
-	if errIncrement := decrementRepostCount(db, parentPostID); errIncrement != nil {
-		return false, errIncrement
+func unlikePost(c *gin.Context, db *gorm.DB, userID, postID uint) {
+	if err := user.UnlikePost(db, userID, postID); err != nil {
+		log.Println("Unlike error:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to unlike post"})
+		return
 	}
 
-	return true, nil
+	federation.PublishLike(db, userID, postID, false)
+	c.JSON(http.StatusOK, gin.H{"message": "unliked successfully", "liked": false})
 }
 
-func incrementRepostCount(db *gorm.DB, parentPostID uint) error {
-	return db.Model(&models.Post{ID: parentPostID}).Update("reposts_count", gorm.Expr("reposts_count + 1")).Error
-}
-
-func decrementRepostCount(db *gorm.DB, parentPostID uint) error {
-	return db.Model(&models.Post{ID: parentPostID}).Update("reposts_count", gorm.Expr("reposts_count - 1")).Error
-}
-
-func createRepost(c *gin.Context, db *gorm.DB, parentID int) PostError {
+// createRepost saves a repost, or a quote when the quote text is given, of the resolved parent post.
+func createRepost(c *gin.Context, db *gorm.DB, parentID uint, kind models.PostKind, quote string) PostError {
 	userIDVal, _ := c.Get("userID")
 	username, _ := user.GetUsernameIDFromContext(c)
 	nickname, _ := user.GetNicknameFromContext(c)
@@ -573,38 +819,43 @@ func createRepost(c *gin.Context, db *gorm.DB, parentID int) PostError {
 		}
 	}
 
-	var payload struct {
-		Quote string `json:"quote"`
-	}
-	if err := c.ShouldBindJSON(&payload); err != nil {
-		return PostError{
-			Message: gin.H{"error": "invalid JSON payload"},
-			Status:  http.StatusBadRequest,
+	body := constants.Empty
+	if kind == models.KindQuote {
+		text, postErr := validateContent(db, validation.Content{
+			Kind:     validation.Quote,
+			AuthorID: currentUserID,
+			Text:     quote,
+		})
+		if postErr != nil {
+			return *postErr
 		}
+		body = text
 	}
 
 	// Create the repost with resolved parent ID
-	parentIDUint := uint(parentID)
-	createdPost, err := user.CreatePost(
-		db,
+	createdPost, err := user.CreatePost(db,
 		currentUserID,
 		nickname,
-		&parentIDUint,
 		username,
-		&payload.Quote,
-		constants.Empty,
-		true, // isRepost is always true
-	)
+		kind,
+		&parentID,
+		body,
+		models.ReplyEveryone,
+		nil,
+		nil)
+	if errors.Is(err, block.ErrBlocked) {
+		return PostError{Message: gin.H{"error": err.Error()}, Status: http.StatusForbidden}
+	}
 	if err != nil {
 		return PostError{
 			Message: gin.H{"error": "failed to create repost"},
 			Status:  http.StatusInternalServerError,
 		}
 	}
+	federation.PublishPost(db, *createdPost)
 
-	// Fetch the created repost with ParentPost preloaded
-	var postWithParent models.Post
-	if errPreloadDB := db.Preload("ParentPost").First(&postWithParent, createdPost.ID).Error; errPreloadDB != nil {
+	processedPost, err := fetchAndProcessPost(db, createdPost.ID)
+	if err != nil {
 		return PostError{
 			Message: gin.H{"error": "failed to fetch repost"},
 			Status:  http.StatusInternalServerError,
@@ -612,7 +863,7 @@ func createRepost(c *gin.Context, db *gorm.DB, parentID int) PostError {
 	}
 
 	return PostError{
-		Message: gin.H{"message": "repost created successfully"},
+		Message: gin.H{"message": "repost created successfully", "post": processedPost},
 		Status:  http.StatusCreated,
 	}
 }
@@ -636,52 +887,123 @@ func GetLikesCount(db *gorm.DB, postID uint) (int64, error) {
 func GetCommentsCount(db *gorm.DB, postID uint) (int64, error) {
 	var commentsCount int64
 
-	// Query for counting comments with the specific parent_id, which is postID
+	// Query for counting the replies to the post
 	err := db.Model(&models.Post{}).
-		Where("parent_id = ? AND is_repost = ?", postID, false). // Fixing the WHERE clause
-		Count(&commentsCount).Error                              // Use Count directly instead of Pluck for counting rows
+		Where("reply_to_id = ?", postID).
+		Count(&commentsCount).Error // Use Count directly instead of Pluck for counting rows
 
 	return commentsCount, err
 }
 
-// Parses the request body and returns the structured request.
-func parsePostRequest(c *gin.Context) (*struct {
-	Body     string  `json:"body"`
-	Quote    *string `json:"quote"`
-	ParentID *uint   `json:"parent_id"`
-}, error) {
-	var req struct {
-		Body     string  `json:"body"`
-		Quote    *string `json:"quote"`
-		ParentID *uint   `json:"parent_id"`
+// postRequest is the payload of a new post. ParentID and Quote are still accepted from older clients,
+// for which a post with a parent was a quote whose text could be sent in either field.
+type postRequest struct {
+	Body         string  `json:"body"`
+	Quote        *string `json:"quote"`
+	ReplyToID    *uint   `json:"reply_to_id"`
+	QuotedPostID *uint   `json:"quoted_post_id"`
+	ParentID     *uint   `json:"parent_id"`
+	// ReplyAudience defaults to everyone when omitted.
+	ReplyAudience models.ReplyAudience  `json:"reply_audience"`
+	Labels        []models.ContentLabel `json:"labels"`
+	// CommunityID posts an original post in a community; replies join the community of their post.
+	CommunityID *uint `json:"community_id"`
+}
+
+// kind returns the kind of the requested post along with the post it references.
+func (r *postRequest) kind() (models.PostKind, *uint) {
+	switch {
+	case r.ReplyToID != nil:
+		return models.KindReply, r.ReplyToID
+	case r.QuotedPostID != nil:
+		return models.KindQuote, r.QuotedPostID
+	case r.ParentID != nil:
+		return models.KindQuote, r.ParentID
+	default:
+		return models.KindOriginal, nil
+	}
+}
+
+func (r *postRequest) audience() models.ReplyAudience {
+	if r.ReplyAudience == constants.Empty {
+		return models.ReplyEveryone
 	}
+	return r.ReplyAudience
+}
+
+func (r *postRequest) text() string {
+	if r.Body == constants.Empty && r.Quote != nil {
+		return *r.Quote
+	}
+	return r.Body
+}
+
+// Parses the request body and returns the structured request.
+func parsePostRequest(c *gin.Context) (*postRequest, error) {
+	var req postRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
 		return nil, fmt.Errorf("invalid JSON: %s", err.Error())
 	}
 	return &req, nil
 }
 
-var ErrParentPostNotFound = errors.New("parent post ID not provided")
+// resolveReferencedPost fetches the post to reply to, repost or quote. Reposts are resolved to the post
+// they share, so that interactions always land on the original.
+func resolveReferencedPost(db *gorm.DB, postID uint) (models.Post, error) {
+	var post models.Post
+	if err := db.First(&post, postID).Error; err != nil {
+		return models.Post{}, err
+	}
 
-// Fetches the parent post if it exists and resolves original posts for reposts.
-func fetchParentPost(db *gorm.DB, parentID *uint) (*models.Post, error) {
-	if parentID == nil {
-		return nil, ErrParentPostNotFound
+	if post.Kind == models.KindRepost && post.QuotedPostID != nil {
+		var originalPost models.Post
+		if err := db.First(&originalPost, *post.QuotedPostID).Error; err != nil {
+			return models.Post{}, err
+		}
+		post = originalPost
 	}
 
-	var parentPost models.Post
-	if err := db.First(&parentPost, *parentID).Error; err != nil {
-		return nil, errors.New("parent post not found")
+	return post, nil
+}
+
+// checkCanPostInCommunity returns the response to send when the post cannot go to the requested community.
+func checkCanPostInCommunity(db *gorm.DB, userID uint, kind models.PostKind, communityID *uint) *PostError {
+	if communityID == nil || kind == models.KindReply {
+		return nil
+	}
+	if kind != models.KindOriginal {
+		return &PostError{
+			Message: gin.H{"error": "only original posts can be posted in a community"},
+			Status:  http.StatusBadRequest,
+		}
 	}
 
-	if parentPost.ParentID != nil {
-		var originalPost models.Post
-		if err := db.First(&originalPost, *parentPost.ParentID).Error; err != nil {
-			return nil, errors.New("original post not found")
+	err := community.CheckCanPost(db, userID, *communityID)
+	switch {
+	case err == nil:
+		return nil
+	case errors.Is(err, community.ErrNoCommunity):
+		return &PostError{Message: gin.H{"error": err.Error()}, Status: http.StatusNotFound}
+	case errors.Is(err, community.ErrNotMember):
+		return &PostError{Message: gin.H{"error": err.Error()}, Status: http.StatusForbidden}
+	default:
+		return &PostError{
+			Message: gin.H{"error": "failed to check community membership"},
+			Status:  http.StatusInternalServerError,
 		}
-		return &originalPost, nil
 	}
-	return &parentPost, nil
+}
+
+// validationKind picks the validation chain matching the kind of a post.
+func validationKind(kind models.PostKind) validation.Kind {
+	switch kind {
+	case models.KindReply:
+		return validation.Comment
+	case models.KindRepost, models.KindQuote:
+		return validation.Quote
+	case models.KindOriginal:
+	}
+	return validation.Post
 }
 
 // Handles post creation errors in a centralized function.
@@ -690,23 +1012,281 @@ func handlePostCreationError(c *gin.Context, err error) {
 		sendErrorResponse(c, http.StatusBadRequest, constants.ErrNoUser)
 		return
 	}
+	if errors.Is(err, block.ErrBlocked) || errors.Is(err, user.ErrReplyNotAllowed) {
+		sendErrorResponse(c, http.StatusForbidden, err.Error())
+		return
+	}
 	sendErrorResponse(c, http.StatusInternalServerError, "failed to create post")
 }
 
 // Fetches the created post and processes it into the API response format.
 func fetchAndProcessPost(db *gorm.DB, postID uint) (mappers.PostResponse, error) {
 	var postWithParent models.Post
-	if err := db.Preload("ParentPost").First(&postWithParent, postID).Error; err != nil {
+	if err := db.Scopes(models.WithPostRelations).First(&postWithParent, postID).Error; err != nil {
 		return mappers.PostResponse{}, err
 	}
 	return mappers.ProcessPost(postWithParent), nil
 }
 
-func validatePostBody(body string) error {
-	if body == constants.Empty {
-		return errors.New("body cannot be empty")
+// processPostsForViewer maps posts to responses and fills the flags that depend on the authenticated viewer.
+func processPostsForViewer(c *gin.Context, db *gorm.DB, rawPosts []models.Post) ([]mappers.PostResponse, error) {
+	return applyViewerState(c, db, user.ProcessPosts(rawPosts))
+}
+
+// processPostForViewer is processPostsForViewer for a post opened directly, which is blurred rather than left out
+// when the viewer hides labeled posts. It reports false when the post is hidden from the viewer by a block or a
+// mute.
+func processPostForViewer(c *gin.Context, db *gorm.DB, post models.Post) (mappers.PostResponse, bool, error) {
+	posts, err := dropBlockedPosts(c, db, user.ProcessPosts([]models.Post{post}))
+	if err != nil {
+		return mappers.PostResponse{}, false, err
+	}
+	posts, err = dropMutedPosts(c, db, posts)
+	if err != nil {
+		return mappers.PostResponse{}, false, err
+	}
+	posts, err = hydratePosts(c, db, posts, false)
+	if err != nil || len(posts) == 0 {
+		return mappers.PostResponse{}, false, err
+	}
+	return posts[0], true, nil
+}
+
+// applyViewerState fills the viewer flags, reply counts and author snippets of already mapped posts, which are
+// then counted as seen by the viewer. The number of queries does not depend on the number of posts.
+// Anonymous viewers get the default flags. The flags of a repost describe the post it shares.
+// Labeled posts are blurred or left out according to the sensitive content preference of the viewer, and the
+// posts of users the viewer blocked or was blocked by are left out, as well as what the viewer muted. It fails
+// rather than show posts it could not check.
+func applyViewerState(c *gin.Context, db *gorm.DB, posts []mappers.PostResponse) ([]mappers.PostResponse, error) {
+	posts, err := dropBlockedPosts(c, db, posts)
+	if err != nil {
+		return nil, err
+	}
+	posts, err = dropMutedPosts(c, db, posts)
+	if err != nil {
+		return nil, err
+	}
+	return hydratePosts(c, db, posts, true)
+}
+
+func hydratePosts(
+	c *gin.Context,
+	db *gorm.DB,
+	posts []mappers.PostResponse,
+	dropHidden bool) ([]mappers.PostResponse, error) {
+	posts = applySensitivePreference(c, db, posts, dropHidden)
+	recordImpressions(c, db, posts)
+	if len(posts) == 0 {
+		return posts, nil
+	}
+
+	postIDs := make([]uint, 0, len(posts))
+	authorIDs := make([]uint, 0, len(posts))
+	for _, post := range posts {
+		postIDs = append(postIDs, post.ID, sharedPostID(post))
+		authorIDs = append(authorIDs, post.UserID)
+	}
+
+	viewerID, _ := user.GetUserIDFromContext(c)
+	states, err := user.GetPostStates(db, viewerID, postIDs)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load post states: %w", err)
+	}
+	authors, err := user.GetUsersByIDs(db, authorIDs)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load post authors: %w", err)
+	}
+
+	stateByID := make(map[uint]user.PostState, len(states))
+	for _, state := range states {
+		stateByID[state.PostID] = state
+	}
+	authorByID := make(map[uint]mappers.Response, len(authors))
+	for _, author := range authors {
+		authorByID[author.ID] = mappers.MapUserToResponse(author)
+	}
+
+	for i := range posts {
+		shared := stateByID[sharedPostID(posts[i])]
+		posts[i].Bookmarked = stateByID[posts[i].ID].Bookmarked
+		posts[i].LikedByMe = shared.Liked
+		posts[i].RepostedByMe = shared.Reposted
+		posts[i].ReplyCount = shared.CommentsCount
+		if author, ok := authorByID[posts[i].UserID]; ok {
+			posts[i].Author = &author
+		}
+	}
+
+	if viewerID == 0 {
+		return posts, nil
+	}
+
+	viewerUsername, _ := user.GetUsernameIDFromContext(c)
+	replyable, err := user.ReplyablePostIDs(db, viewerID, viewerUsername, posts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load reply permissions of viewer: %w", err)
+	}
+	for i := range posts {
+		posts[i].CanReply = replyable[posts[i].ID]
+	}
+	return posts, nil
+}
+
+// applySensitivePreference blurs the labeled posts, or leaves them out when the viewer hides them and dropHidden
+// is set. A repost carries the labels of the post it shares. Viewers always see their own posts as they are.
+func applySensitivePreference(
+	c *gin.Context,
+	db *gorm.DB,
+	posts []mappers.PostResponse,
+	dropHidden bool) []mappers.PostResponse {
+	viewerID, _ := user.GetUserIDFromContext(c)
+	preference, err := label.GetPreference(db, viewerID)
+	if err != nil {
+		log.Println("Failed to load sensitive content preference of viewer:", err)
+		preference = models.SensitiveBlur
+	}
+	if preference == models.SensitiveShow {
+		return posts
+	}
+
+	kept := posts[:0]
+	for _, post := range posts {
+		if labeled, authorID := sharedLabels(post); labeled && authorID != viewerID {
+			if preference == models.SensitiveHide && dropHidden {
+				continue
+			}
+			post.Blurred = true
+		}
+		kept = append(kept, post)
+	}
+	return kept
+}
+
+// dropBlockedPosts leaves out the posts written by, or sharing, replying to or quoting a post of, a user the
+// viewer blocked or was blocked by.
+func dropBlockedPosts(c *gin.Context, db *gorm.DB, posts []mappers.PostResponse) ([]mappers.PostResponse, error) {
+	viewerID, _ := user.GetUserIDFromContext(c)
+	blocked, err := block.BlockedUserIDs(db, viewerID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load blocked users of viewer: %w", err)
+	}
+	if len(blocked) == 0 {
+		return posts, nil
+	}
+
+	kept := posts[:0]
+	for _, post := range posts {
+		if blocked[post.UserID] || post.ParentPost != nil && blocked[post.ParentPost.UserID] {
+			continue
+		}
+		kept = append(kept, post)
+	}
+	return kept, nil
+}
+
+// dropMutedPosts leaves out the posts hidden by the mutes of the viewer.
+func dropMutedPosts(c *gin.Context, db *gorm.DB, posts []mappers.PostResponse) ([]mappers.PostResponse, error) {
+	viewerID, _ := user.GetUserIDFromContext(c)
+	kept, err := mute.FilterPosts(db, viewerID, posts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to apply mutes of viewer: %w", err)
+	}
+	return kept, nil
+}
+
+// sharedLabels reports whether the post a timeline entry stands for is labeled, and who wrote it.
+func sharedLabels(post mappers.PostResponse) (bool, uint) {
+	if post.Kind == models.KindRepost && post.ParentPost != nil {
+		return len(post.ParentPost.Labels) > 0, post.ParentPost.UserID
+	}
+	return len(post.Labels) > 0, post.UserID
+}
+
+// sharedPostID is the post a timeline entry stands for: the shared post for reposts, the entry itself otherwise.
+func sharedPostID(post mappers.PostResponse) uint {
+	if post.Kind == models.KindRepost && post.ParentPost != nil {
+		return post.ParentPost.ID
+	}
+	return post.ID
+}
+
+// pinFirst moves the pinned post to the top of a profile timeline and flags it.
+func pinFirst(posts []mappers.PostResponse, pinnedPostID *uint) []mappers.PostResponse {
+	if pinnedPostID == nil {
+		return posts
+	}
+
+	for i, post := range posts {
+		if post.ID != *pinnedPostID {
+			continue
+		}
+		post.Pinned = true
+		ordered := make([]mappers.PostResponse, 0, len(posts))
+		ordered = append(ordered, post)
+		ordered = append(ordered, posts[:i]...)
+		return append(ordered, posts[i+1:]...)
+	}
+	return posts
+}
+
+// parsePagination reads the limit and cursor query parameters shared by paginated timelines.
+func parsePagination(c *gin.Context) (int, uint, error) {
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", strconv.Itoa(constants.DefaultPageSize)))
+	if err != nil || limit <= 0 || limit > constants.MaxPageSize {
+		return 0, 0, errors.New("invalid limit parameter")
+	}
+
+	var cursor uint64
+	if rawCursor := c.Query("cursor"); rawCursor != constants.Empty {
+		cursor, err = strconv.ParseUint(rawCursor, 10, 32)
+		if err != nil {
+			return 0, 0, errors.New("invalid cursor parameter")
+		}
+	}
+
+	return limit, uint(cursor), nil
+}
+
+// parseSince reads the since_id and since query parameters bounding a timeline to newer posts. since is an
+// RFC 3339 time.
+func parseSince(c *gin.Context) (timeline.Since, error) {
+	var since timeline.Since
+	if rawID := c.Query("since_id"); rawID != constants.Empty {
+		id, err := strconv.ParseUint(rawID, 10, 32)
+		if err != nil {
+			return since, errors.New("invalid since_id parameter")
+		}
+		since.ID = uint(id)
+	}
+	if rawTime := c.Query("since"); rawTime != constants.Empty {
+		parsed, err := time.Parse(time.RFC3339, rawTime)
+		if err != nil {
+			return since, errors.New("invalid since parameter")
+		}
+		since.Time = parsed
+	}
+	return since, nil
+}
+
+// validateContent runs the validation chain of the content kind and returns the normalized text,
+// or the response to send when the content is rejected.
+func validateContent(db *gorm.DB, content validation.Content) (string, *PostError) {
+	text, err := validation.ForKind(content.Kind).Validate(db, content)
+	if err == nil {
+		return text, nil
+	}
+
+	if validationErr, ok := validation.AsError(err); ok {
+		return constants.Empty, &PostError{
+			Message: gin.H{"error": validationErr.Message, "details": validationErr},
+			Status:  http.StatusBadRequest,
+		}
+	}
+	return constants.Empty, &PostError{
+		Message: gin.H{"error": "failed to validate content"},
+		Status:  http.StatusInternalServerError,
 	}
-	return nil
 }
 
 func sendErrorResponse(c *gin.Context, statusCode int, message string) {
@@ -714,7 +1294,11 @@ func sendErrorResponse(c *gin.Context, statusCode int, message string) {
 }
 
 func editPost(c *gin.Context, db *gorm.DB, postID int) PostError {
-	var req models.Post
+	// Older clients send the text of a quote in the quote field
+	var req struct {
+		Body  string  `json:"body"`
+		Quote *string `json:"quote"`
+	}
 
 	// Parse the request body
 	if err := c.ShouldBindJSON(&req); err != nil {
@@ -745,21 +1329,45 @@ func editPost(c *gin.Context, db *gorm.DB, postID int) PostError {
 			Status: http.StatusUnauthorized}
 	}
 
-	// Allow editing of either the body, the quote, or both
-	if req.Body != "" {
-		post.Body = req.Body
+	// Reposts have no text of their own
+	if post.Kind == models.KindRepost {
+		return PostError{Message: gin.H{"error": "reposts cannot be edited"},
+			Status: http.StatusBadRequest}
 	}
 
-	if req.Quote != nil {
-		post.Quote = req.Quote
+	text := req.Body
+	if text == constants.Empty && req.Quote != nil {
+		text = *req.Quote
+	}
+	if text != constants.Empty {
+		body, postErr := validateContent(db, validation.Content{
+			Kind:     validationKind(post.Kind),
+			AuthorID: currentUserID,
+			PostID:   post.ID,
+			Text:     text,
+		})
+		if postErr != nil {
+			return *postErr
+		}
+		post.Body = body
 	}
 
-	// Save the updated post to the database
-	if db.Save(&post).Error != nil {
+	// Save the updated post to the database and refresh its hashtags
+	errTx := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Save(&post).Error; err != nil {
+			return err
+		}
+		if err := hashtag.SyncPostHashtags(tx, &post); err != nil {
+			return err
+		}
+		return mention.SyncPostMentions(tx, &post)
+	})
+	if errTx != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to update post"})
 		return PostError{Message: gin.H{"error": "failed to update post"},
 			Status: http.StatusInternalServerError}
 	}
+	unfurl.AttachCardAsync(db, post.ID, post.Body)
 
 	return PostError{Message: gin.H{"message": "post updated successfully"},
 		Status: http.StatusOK}
@@ -782,12 +1390,31 @@ func deletePost(db *gorm.DB, currentUserID uint, postID int) PostError {
 		}
 	}
 
-	if deleteErr := db.Delete(&post).Error; deleteErr != nil {
+	if deleteErr := removePost(db, post); deleteErr != nil {
 		return PostError{Message: gin.H{"error": "failed to delete post"}, Status: http.StatusInternalServerError}
 	}
 	return PostError{Message: gin.H{"message": "post deleted successfully"}, Status: http.StatusOK}
 }
 
+// removePost deletes a post and lets the servers federating with this one know.
+func removePost(db *gorm.DB, post models.Post) error {
+	if err := user.RemovePost(db, post); err != nil {
+		return err
+	}
+	federation.PublishDeletion(db, post)
+	return nil
+}
+
+// unrepost removes the repost of a post and lets the servers federating with this one know.
+func unrepost(db *gorm.DB, userID, postID uint) error {
+	repost, err := user.Unrepost(db, userID, postID)
+	if err != nil || repost == nil {
+		return err
+	}
+	federation.PublishDeletion(db, *repost)
+	return nil
+}
+
 type PostError struct {
 	Message gin.H
 	Status  int
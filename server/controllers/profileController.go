@@ -4,7 +4,9 @@ import (
 	"github.com/gin-gonic/gin"
 	"gorm.io/gorm"
 	"net/http"
+	"x-clone/server/mappers"
 	"x-clone/server/models"
+	"x-clone/server/services/block"
 	"x-clone/server/services/user"
 )
 
@@ -25,6 +27,31 @@ func ViewUserProfileHandler(db *gorm.DB) gin.HandlerFunc {
 		var followingCount int64
 		db.Model(&models.Follow{}).Where("following_username = ?", username).Count(&followingCount)
 
+		// Include the pinned post, if any and unless the viewer and the user blocked each other
+		var pinnedPost *mappers.PostResponse
+		post, hasPinned, errPinned := user.GetPinnedPost(db, u)
+		if errPinned != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load pinned post"})
+			return
+		}
+		viewerID, _ := user.GetUserIDFromContext(c)
+		blocked, errBlock := block.IsBlocked(db, viewerID, u.ID)
+		if errBlock != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load pinned post"})
+			return
+		}
+		if hasPinned && !blocked {
+			processedPost, visible, errProcess := processPostForViewer(c, db, post)
+			if errProcess != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load pinned post"})
+				return
+			}
+			if visible {
+				processedPost.Pinned = true
+				pinnedPost = &processedPost
+			}
+		}
+
 		// Return profile data with counts
 		c.JSON(http.StatusOK, gin.H{
 			"profile": gin.H{
@@ -36,6 +63,7 @@ func ViewUserProfileHandler(db *gorm.DB) gin.HandlerFunc {
 				"follower_count":  followerCount,
 				"following_count": followingCount,
 				"created_at":      u.CreatedAt, // Include the CreatedAt field
+				"pinned_post":     pinnedPost,
 			},
 		})
 	}
@@ -8,7 +8,8 @@ import (
 	"net/http"
 	"strings"
 	"x-clone/server/mappers"
-	"x-clone/server/models"
+	"x-clone/server/services/block"
+	"x-clone/server/services/timeline"
 	"x-clone/server/services/user"
 )
 
@@ -20,25 +21,36 @@ func SearchHandler(db *gorm.DB) gin.HandlerFunc {
 		keywords := strings.Fields(keyword)
 		keywordProcessed := strings.Join(keywords, " ")
 
+		viewerID, _ := user.GetUserIDFromContext(c)
 		filter := c.Query("f")
 		switch filter {
 		case "":
-			posts, err := user.SearchPostsByKeywords(db, keyword)
+			posts, err := user.SearchPostsByKeywords(db, viewerID, keyword)
 			if err != nil {
 				c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
 				return
 			}
 
-			c.JSON(http.StatusOK, posts)
+			processed, err := applyViewerState(c, db, posts)
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+				return
+			}
+			c.JSON(http.StatusOK, processed)
 
 		case "latest":
-			posts, err := user.SearchPostsByKeywordsSortedByLatest(db, keywordProcessed)
+			posts, err := user.SearchPostsByKeywordsSortedByLatest(db, viewerID, keywordProcessed)
 			if err != nil {
 				c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
 				return
 			}
 
-			c.JSON(http.StatusOK, posts)
+			processed, err := applyViewerState(c, db, posts)
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+				return
+			}
+			c.JSON(http.StatusOK, processed)
 
 		case "user":
 			users, err := user.SearchUsersByUsername(db, keywordProcessed)
@@ -46,7 +58,12 @@ func SearchHandler(db *gorm.DB) gin.HandlerFunc {
 				c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
 				return
 			}
-			c.JSON(http.StatusOK, gin.H{"users": users})
+			kept, err := dropBlockedUsers(c, db, users)
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+				return
+			}
+			c.JSON(http.StatusOK, gin.H{"users": kept})
 
 		case "unique-user":
 			exists, err := user.SearchUniqueMailUsername(db, "username", keywordProcessed)
@@ -83,33 +100,17 @@ func PrivateSearchHandler(db *gorm.DB) gin.HandlerFunc {
 	}
 }
 
-func fetchPostsFromFollowedUsers(db *gorm.DB, followedUsers []mappers.Response) ([]models.Post, error) {
-	var allPosts []models.Post
-	for _, followedUser := range followedUsers {
-		posts, err := user.GetAllPostsByUsername(db, followedUser.Username)
-		if err != nil {
-			return nil, fmt.Errorf("failed to fetch posts for user %s: %w", followedUser.Username, err)
-		}
-		allPosts = append(allPosts, posts...)
-	}
-	return allPosts, nil
-}
-
-// _ should be replaced when keyword has any use.
+// handleFollowingFilter returns every post of the accounts the viewer follows, newest first. The keyword is not
+// used yet. The paged home timeline is served by GetHomeTimelineHandler.
 func handleFollowingFilter(c *gin.Context, db *gorm.DB, _ string) {
 	currentUser, err := getCurrentUser(c)
 	if err != nil {
 		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
 		return
 	}
+	userID, _ := user.GetUserIDFromContext(c)
 
-	followedUsers, err := user.GetFollowing(db, currentUser)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-		return
-	}
-
-	allPosts, err := fetchPostsFromFollowedUsers(db, followedUsers)
+	allPosts, err := timeline.GetFollowedPosts(db, userID, currentUser)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
@@ -120,10 +121,31 @@ func handleFollowingFilter(c *gin.Context, db *gorm.DB, _ string) {
 		return
 	}
 
-	processedPosts := user.ProcessPosts(allPosts)
+	processedPosts, err := processPostsForViewer(c, db, allPosts)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return
+	}
 	c.JSON(http.StatusOK, processedPosts)
 }
 
+// dropBlockedUsers leaves out the users the viewer blocked or was blocked by.
+func dropBlockedUsers(c *gin.Context, db *gorm.DB, users []mappers.Response) ([]mappers.Response, error) {
+	viewerID, _ := user.GetUserIDFromContext(c)
+	blocked, err := block.BlockedUserIDs(db, viewerID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load blocked users of viewer: %w", err)
+	}
+
+	kept := make([]mappers.Response, 0, len(users))
+	for _, u := range users {
+		if !blocked[u.ID] {
+			kept = append(kept, u)
+		}
+	}
+	return kept, nil
+}
+
 func getCurrentUser(c *gin.Context) (string, error) {
 	currentUserAux, exists := c.Get("username")
 	if !exists || currentUserAux == nil {
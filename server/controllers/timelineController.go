@@ -0,0 +1,227 @@
+package controllers
+
+import (
+	"errors"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"io"
+	"log"
+	"net/http"
+	"time"
+	"x-clone/server/constants"
+	"x-clone/server/models"
+	"x-clone/server/services/live"
+	"x-clone/server/services/ranking"
+	"x-clone/server/services/timeline"
+	"x-clone/server/services/user"
+)
+
+// GetHomeTimelineHandler GET /timeline/home?limit=20&cursor=42, the posts of the viewer and of the accounts
+// they follow, newest first. since_id and since leave out the posts the client already has.
+func GetHomeTimelineHandler(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, _ := user.GetUserIDFromContext(c)
+		username, _ := user.GetUsernameIDFromContext(c)
+
+		limit, cursor, err := parsePagination(c)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		since, err := parseSince(c)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		rawPosts, nextCursor, err := timeline.GetHomeTimeline(db, userID, username, limit, cursor, since)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+			return
+		}
+
+		posts, err := processPostsForViewer(c, db, rawPosts)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"posts":       posts,
+			"next_cursor": nextCursor,
+		})
+	}
+}
+
+// CountNewPostsHandler GET /timeline/new-count?since_id=42&since=2024-05-01T10:00:00Z, how many posts newer than
+// the bounds the home and all-posts timelines have, for a "new posts" banner. Counts stop at NewPostsMaxCount.
+func CountNewPostsHandler(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, _ := user.GetUserIDFromContext(c)
+		username, _ := user.GetUsernameIDFromContext(c)
+
+		since, err := parseSince(c)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if since.IsZero() {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "since_id or since is required"})
+			return
+		}
+
+		home, err := timeline.CountNewHomePosts(db, userID, username, since)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+			return
+		}
+		all, err := timeline.CountNewPosts(db, userID, since)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"home": home, "all": all, "max": constants.NewPostsMaxCount})
+	}
+}
+
+// GetForYouTimelineHandler GET /timeline/for-you?limit=20&cursor=40&explain=true, the ranked timeline of the
+// viewer. The cursor is the ID of the post to continue after, and explain adds how each post was scored. since_id
+// and since only rank the posts newer than the ones the client already has. A cursor into an order that expired
+// answers 410 Gone, and the client starts again without a cursor.
+func GetForYouTimelineHandler(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, _ := user.GetUserIDFromContext(c)
+		username, _ := user.GetUsernameIDFromContext(c)
+
+		limit, cursor, err := parsePagination(c)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		since, err := parseSince(c)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		viewer := ranking.Viewer{UserID: userID, Username: username}
+		ranked, nextCursor, err := ranking.Rank(db, viewer, ranking.EngagementScorer{}, limit, cursor, since)
+		if errors.Is(err, ranking.ErrSnapshotExpired) {
+			c.JSON(http.StatusGone, gin.H{"error": err.Error()})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+			return
+		}
+
+		rawPosts := make([]models.Post, len(ranked))
+		for i, r := range ranked {
+			rawPosts[i] = r.Post
+		}
+		posts := user.ProcessPosts(rawPosts)
+		if c.Query("explain") == "true" {
+			for i := range posts {
+				posts[i].Explanation = &ranked[i].Explanation
+			}
+		}
+
+		processed, err := applyViewerState(c, db, posts)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"posts":       processed,
+			"next_cursor": nextCursor,
+		})
+	}
+}
+
+// StreamHomeTimelineHandler GET /timeline/home/stream, pushes the changes to the home timeline of the viewer as
+// Server-Sent Events: "post" with a new post as GET /timeline/home would return it, "counters" with the new like
+// and repost counts of a post, and "delete" with the ID of a removed post. A "ping" is sent every
+// LiveHeartbeatInterval to keep idle connections open.
+func StreamHomeTimelineHandler(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, _ := user.GetUserIDFromContext(c)
+		username, _ := user.GetUsernameIDFromContext(c)
+
+		authors, err := timeline.HomeAuthorIDs(db, userID, username)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+			return
+		}
+
+		events, cancel := live.Subscribe()
+		defer cancel()
+		heartbeat := time.NewTicker(constants.LiveHeartbeatInterval)
+		defer heartbeat.Stop()
+
+		c.Header("Cache-Control", "no-cache")
+		c.Header("X-Accel-Buffering", "no")
+
+		// Counters and deletions also matter for the posts shared by the followed accounts, which were sent
+		// on this stream along with the reposts carrying them.
+		sent := live.NewSentPosts()
+		c.Stream(func(_ io.Writer) bool {
+			select {
+			case <-c.Request.Context().Done():
+				return false
+			case <-heartbeat.C:
+				// Follows made or removed since the stream opened are picked up here
+				if refreshed, errAuthors := timeline.HomeAuthorIDs(db, userID, username); errAuthors != nil {
+					log.Println("Failed to refresh followed accounts of live timeline:", errAuthors)
+				} else {
+					authors = refreshed
+				}
+				c.SSEvent("ping", time.Now().Unix())
+				return true
+			case event, ok := <-events:
+				if !ok {
+					return false
+				}
+				if authors[event.AuthorID] || sent.Has(event.PostID) {
+					sendLiveEvent(c, db, event, sent)
+				}
+				return true
+			}
+		})
+	}
+}
+
+func sendLiveEvent(c *gin.Context, db *gorm.DB, event live.Event, sent *live.SentPosts) {
+	switch event.Type {
+	case live.EventPost:
+		var post models.Post
+		if err := db.Scopes(models.WithPostRelations).First(&post, event.PostID).Error; err != nil {
+			log.Println("Failed to load post for live timeline:", err)
+			return
+		}
+		// The blocks, mutes and sensitive content preference of the viewer apply as on the timeline itself
+		posts, err := processPostsForViewer(c, db, []models.Post{post})
+		if err != nil {
+			log.Println("Failed to apply the viewer state to a live post:", err)
+			return
+		}
+		if len(posts) == 0 {
+			return
+		}
+		sent.Add(posts[0].ID)
+		if posts[0].ParentPost != nil {
+			sent.Add(posts[0].ParentPost.ID)
+		}
+		c.SSEvent(string(live.EventPost), posts[0])
+	case live.EventCounters:
+		c.SSEvent(string(live.EventCounters), gin.H{
+			"post_id":       event.PostID,
+			"likes_count":   event.LikesCount,
+			"reposts_count": event.RepostsCount,
+		})
+	case live.EventDelete:
+		sent.Remove(event.PostID)
+		c.SSEvent(string(live.EventDelete), gin.H{"post_id": event.PostID})
+	}
+}
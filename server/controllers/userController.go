@@ -11,7 +11,10 @@ import (
 	"time"
 	"x-clone/server/constants"
 	"x-clone/server/models"
+	"x-clone/server/services/block"
+	"x-clone/server/services/federation"
 	"x-clone/server/services/user"
+	"x-clone/server/services/validation"
 )
 
 func FollowUserHandler(db *gorm.DB) gin.HandlerFunc {
@@ -211,7 +214,29 @@ func toggleFollow(db *gorm.DB, c *gin.Context, isFollowing bool) {
 
 	followedUsername := c.Param("username")
 
+	// Accounts of other servers, written user@domain, are looked up the first time they are followed
+	if isFollowing && strings.Contains(followedUsername, "@") && federation.Enabled() {
+		remoteUser, resolveErr := federation.ResolveRemoteUser(db, followedUsername)
+		if resolveErr != nil {
+			log.Println("Remote follow error:", resolveErr)
+			c.JSON(http.StatusNotFound, gin.H{"error": constants.ErrNoUser})
+			return
+		}
+		followedUsername = remoteUser.Username
+	}
+
 	if isFollowing {
+		followingID, _ := user.GetUserIDFromContext(c)
+		blocked, blockErr := block.IsBlockedWith(db, followingID, followedUsername)
+		if blockErr != nil {
+			log.Println("Follow error:", blockErr)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to follow user"})
+			return
+		}
+		if blocked {
+			c.JSON(http.StatusForbidden, gin.H{"error": block.ErrBlocked.Error()})
+			return
+		}
 		if followErr := user.FollowAccount(db, followingUsername, followedUsername); followErr != nil {
 			log.Println("Follow error:", followErr)
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to follow user"})
@@ -240,6 +265,7 @@ func toggleFollow(db *gorm.DB, c *gin.Context, isFollowing bool) {
 		UpdateColumn("follower_count", gorm.Expr("follower_count "+expr+" 1")).Error; err != nil {
 		log.Println("Failed to "+logErrorMessage+" follower_count:", err)
 	}
+	federation.PublishFollow(db, followingUsername, followedUsername, isFollowing)
 
 	c.JSON(http.StatusOK, gin.H{"message": successMessage})
 }
@@ -256,17 +282,34 @@ func sendMessage(c *gin.Context, senderStr string, receiverStr string, db *gorm.
 		}
 	}
 
-	if strings.TrimSpace(payload.Message) == constants.Empty {
-		return ErrorMessage{Message: gin.H{"error": "Message content cannot be empty"},
-			Status: http.StatusBadRequest}
-	}
-
 	if receiverStr == senderStr {
 		return ErrorMessage{Message: gin.H{"error": "You cannot send a message to yourself"},
 			Status: http.StatusBadRequest}
 	}
 
-	if err := user.SendMessage(db, senderStr, receiverStr, payload.Message); err != nil {
+	senderID, idErr := user.GetUserIDFromContext(c)
+	if idErr != nil {
+		return ErrorMessage{Message: gin.H{"error": idErr.Error()}, Status: http.StatusUnauthorized}
+	}
+	blocked, blockErr := block.IsBlockedWith(db, senderID, receiverStr)
+	if blockErr != nil {
+		return ErrorMessage{Message: gin.H{"error": "Could not send message"},
+			Status: http.StatusInternalServerError}
+	}
+	if blocked {
+		return ErrorMessage{Message: gin.H{"error": block.ErrBlocked.Error()}, Status: http.StatusForbidden}
+	}
+
+	content, postErr := validateContent(db, validation.Content{
+		Kind:     validation.Message,
+		AuthorID: senderID,
+		Text:     payload.Message,
+	})
+	if postErr != nil {
+		return ErrorMessage{Message: postErr.Message, Status: postErr.Status}
+	}
+
+	if err := user.SendMessage(db, senderStr, receiverStr, content); err != nil {
 		return ErrorMessage{Message: gin.H{"error": "Could not send message"},
 			Status: http.StatusInternalServerError}
 	}
@@ -333,8 +376,10 @@ func GetUserInfoHandler(db *gorm.DB) gin.HandlerFunc {
 		}
 
 		c.JSON(http.StatusOK, gin.H{
-			"username":  u.Username,
-			"createdAt": u.CreatedAt,
+			"username":          u.Username,
+			"createdAt":         u.CreatedAt,
+			"sensitive_content": u.SensitiveContent,
+			"is_moderator":      u.IsModerator,
 		})
 	}
 }
@@ -1,19 +1,106 @@
 package main
 
 import (
+	"context"
 	"database/sql"
+	"flag"
 	"fmt"
 	"log"
-	"net/http"
 	"os"
+	"os/signal"
+	"syscall"
 	"x-clone/server/constants"
+	"x-clone/server/services/analytics"
+	"x-clone/server/services/hashtag"
+	"x-clone/server/services/reconcile"
 	"x-clone/server/startup"
 )
 
+// exitUsage is the exit status of a subcommand called with invalid flags.
+const exitUsage = 2
+
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "reconcile" {
+		os.Exit(runReconcile(os.Args[2:]))
+	}
+	if len(os.Args) > 1 && os.Args[1] == "backfill-hashtags" {
+		os.Exit(runBackfillHashtags(os.Args[2:]))
+	}
+	if len(os.Args) > 1 && os.Args[1] == "drop-legacy-post-columns" {
+		os.Exit(runDropLegacyPostColumns())
+	}
 	startServer()
 }
 
+// runReconcile is the "reconcile" subcommand: it checks the counters once, logs every drift and exits
+// with status 1 when discrepancies were found and left unfixed.
+func runReconcile(args []string) int {
+	flags := flag.NewFlagSet("reconcile", flag.ExitOnError)
+	fix := flags.Bool("fix", false, "rewrite the counters that drifted")
+	batchSize := flags.Int("batch-size", constants.ReconcileBatchSize, "rows checked per query")
+	if err := flags.Parse(args); err != nil || *batchSize <= 0 {
+		fmt.Println("usage: x-clone reconcile [-fix] [-batch-size n]")
+		return exitUsage
+	}
+
+	db := startup.StartDatabase()
+	if db == nil {
+		return 1
+	}
+
+	report, err := reconcile.Run(db, reconcile.Options{Fix: *fix, BatchSize: *batchSize})
+	if err != nil {
+		log.Println(err)
+		return 1
+	}
+	reconcile.LogReport(report)
+
+	if !*fix && len(report.Discrepancies) > 0 {
+		return 1
+	}
+	return 0
+}
+
+// runBackfillHashtags is the "backfill-hashtags" subcommand: it links the posts written before hashtags were
+// indexed to their tags, once, so that they show up on the hashtag timelines.
+func runBackfillHashtags(args []string) int {
+	flags := flag.NewFlagSet("backfill-hashtags", flag.ExitOnError)
+	batchSize := flags.Int("batch-size", constants.HashtagBackfillBatchSize, "posts read per query")
+	if err := flags.Parse(args); err != nil || *batchSize <= 0 {
+		fmt.Println("usage: x-clone backfill-hashtags [-batch-size n]")
+		return exitUsage
+	}
+
+	db := startup.StartDatabase()
+	if db == nil {
+		return 1
+	}
+
+	indexed, err := hashtag.Backfill(db, *batchSize)
+	if err != nil {
+		log.Println(err)
+		return 1
+	}
+	log.Printf("Indexed the hashtags of %d posts", indexed)
+	return 0
+}
+
+// runDropLegacyPostColumns is the "drop-legacy-post-columns" subcommand: it removes the columns posts were told
+// apart with before kinds existed, once the converted posts have been checked.
+func runDropLegacyPostColumns() int {
+	db := startup.StartDatabase()
+	if db == nil {
+		return 1
+	}
+
+	if err := startup.DropLegacyPostColumns(db); err != nil {
+		log.Println(err)
+		return 1
+	}
+	log.Println("Dropped the legacy post columns")
+	return 0
+}
+
 func startServer() {
 	db := startup.StartDatabase()
 
@@ -34,18 +121,17 @@ func startServer() {
 		}
 	}(s)
 
-	if startRoutesErr := startup.StartRoutes(db); startRoutesErr != nil {
-		return
-	}
+	startup.StartReconciliation(db)
+	startup.StartFederation(db)
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
 
-	serverPort := os.Getenv("SERVER_PORT")
-	if serverPort == constants.Empty {
-		log.Panic("serverPort environment variable is not set")
+	if startRoutesErr := startup.StartRoutes(ctx, db); startRoutesErr != nil {
+		log.Println("Server stopped:", startRoutesErr)
 	}
 
-	fmt.Printf("Server running on port %s", serverPort)
-	serverError = http.ListenAndServe(":"+serverPort, nil)
-	if serverError != nil {
-		return
+	if flushErr := analytics.Flush(); flushErr != nil {
+		log.Println("Failed to write post events:", flushErr)
 	}
 }
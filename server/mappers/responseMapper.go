@@ -1,8 +1,10 @@
 package mappers
 
 import (
+	"strings"
 	"time"
 	"x-clone/server/models"
+	"x-clone/server/text"
 )
 
 type Response struct {
@@ -41,52 +43,175 @@ func MapPostsToResponses(posts []models.Post) []PostResponse {
 }
 
 type PostResponse struct {
-	ID           uint                `json:"id"`
-	CreatedAt    string              `json:"created_at"`
-	UserID       uint                `json:"userid"`
-	Nickname     string              `json:"nickname"`
-	Username     string              `json:"username"`
-	ParentID     *uint               `json:"parent_id"`
-	Quote        *string             `json:"quote"`
-	Body         string              `json:"body"`
-	RepostsCount uint                `json:"reposts_count"`
-	LikesCount   uint                `json:"likes_count"`
-	IsRepost     bool                `json:"is_repost"`
-	ParentPost   *ParentPostResponse `json:"parent_post,omitempty"`
+	ID            uint                       `json:"id"`
+	CreatedAt     string                     `json:"created_at"`
+	UserID        uint                       `json:"userid"`
+	Nickname      string                     `json:"nickname"`
+	Username      string                     `json:"username"`
+	Kind          models.PostKind            `json:"kind"`
+	ReplyToID     *uint                      `json:"reply_to_id"`
+	QuotedPostID  *uint                      `json:"quoted_post_id"`
+	CommunityID   *uint                      `json:"community_id"`
+	ParentID      *uint                      `json:"parent_id"`
+	Quote         *string                    `json:"quote"`
+	Body          string                     `json:"body"`
+	RepostsCount  uint                       `json:"reposts_count"`
+	LikesCount    uint                       `json:"likes_count"`
+	IsRepost      bool                       `json:"is_repost"`
+	ReplyAudience models.ReplyAudience       `json:"reply_audience"`
+	Labels        []models.ContentLabel      `json:"labels"`
+	ParentPost    *ParentPostResponse        `json:"parent_post,omitempty"`
+	Entities      []EntityResponse           `json:"entities"`
+	Card          *CardResponse              `json:"card,omitempty"`
+	Bookmarked    bool                       `json:"bookmarked"`
+	Pinned        bool                       `json:"pinned"`
+	CanReply      bool                       `json:"can_reply"`
+	LikedByMe     bool                       `json:"liked_by_me"`
+	RepostedByMe  bool                       `json:"reposted_by_me"`
+	ReplyCount    int64                      `json:"reply_count"`
+	Author        *Response                  `json:"author,omitempty"`
+	Blurred       bool                       `json:"blurred"`
+	Explanation   *models.RankingExplanation `json:"explanation,omitempty"`
+}
+
+type CardResponse struct {
+	URL         string `json:"url"`
+	Title       string `json:"title"`
+	Description string `json:"description"`
+	ImageURL    string `json:"image_url"`
+	SiteName    string `json:"site_name"`
+	CardType    string `json:"card_type"`
+}
+
+// EntityResponse is a typed span of the body so clients can link it without re-parsing.
+// Offsets are given both in runes and in UTF-16 code units, End offsets being exclusive.
+// Mentions are only returned when they resolved to an existing user, whose ID is included.
+type EntityResponse struct {
+	Type       text.Type `json:"type"`
+	Text       string    `json:"text"`
+	Value      string    `json:"value"`
+	UserID     *uint     `json:"user_id,omitempty"`
+	Start      int       `json:"start"`
+	End        int       `json:"end"`
+	StartUTF16 int       `json:"start_utf16"`
+	EndUTF16   int       `json:"end_utf16"`
 }
 
 type ParentPostResponse struct {
-	ID        uint   `json:"id"`
-	CreatedAt string `json:"created_at"`
-	Username  string `json:"username"`
-	Nickname  string `json:"nickname"`
-	Body      string `json:"body"`
+	ID            uint                  `json:"id"`
+	CreatedAt     string                `json:"created_at"`
+	UserID        uint                  `json:"userid"`
+	Username      string                `json:"username"`
+	Nickname      string                `json:"nickname"`
+	Body          string                `json:"body"`
+	ReplyAudience models.ReplyAudience  `json:"reply_audience"`
+	Labels        []models.ContentLabel `json:"labels"`
+	CommunityID   *uint                 `json:"community_id"`
 }
 
+// ProcessPost maps a post to its response. ParentID, Quote, IsRepost and ParentPost are derived from the kind
+// so that clients written before kinds existed keep working.
 func ProcessPost(post models.Post) PostResponse {
 	var parentPost *ParentPostResponse
-	if post.ParentPost != nil {
+	if referenced := post.ReferencedPost(); referenced != nil {
 		parentPost = &ParentPostResponse{
-			ID:        post.ParentPost.ID,
-			CreatedAt: post.ParentPost.CreatedAt.Format("2006-01-02 15:04:05.999999999 -0700 MST"),
-			Username:  post.ParentPost.Username,
-			Nickname:  post.ParentPost.Nickname,
-			Body:      post.ParentPost.Body,
+			ID:            referenced.ID,
+			CreatedAt:     referenced.CreatedAt.Format("2006-01-02 15:04:05.999999999 -0700 MST"),
+			UserID:        referenced.UserID,
+			Username:      referenced.Username,
+			Nickname:      referenced.Nickname,
+			Body:          referenced.Body,
+			ReplyAudience: referenced.ReplyAudience,
+			Labels:        mapLabels(referenced.Labels),
+			CommunityID:   referenced.CommunityID,
 		}
 	}
 
+	var quote *string
+	if post.Kind == models.KindQuote {
+		quote = &post.Body
+	}
+
 	return PostResponse{
-		ID:           post.ID,
-		CreatedAt:    post.CreatedAt.Format("2006-01-02 15:04:05.999999999 -0700 MST"),
-		UserID:       post.UserID,
-		Nickname:     post.Nickname,
-		Username:     post.Username,
-		ParentID:     post.ParentID,
-		Quote:        post.Quote,
-		Body:         post.Body,
-		RepostsCount: post.RepostsCount,
-		LikesCount:   post.LikesCount,
-		IsRepost:     post.IsRepost,
-		ParentPost:   parentPost, // <- This ensures parent post is included
+		ID:            post.ID,
+		CreatedAt:     post.CreatedAt.Format("2006-01-02 15:04:05.999999999 -0700 MST"),
+		UserID:        post.UserID,
+		Nickname:      post.Nickname,
+		Username:      post.Username,
+		Kind:          post.Kind,
+		ReplyToID:     post.ReplyToID,
+		QuotedPostID:  post.QuotedPostID,
+		CommunityID:   post.CommunityID,
+		ParentID:      post.ReferencedPostID(),
+		Quote:         quote,
+		Body:          post.Body,
+		RepostsCount:  post.RepostsCount,
+		LikesCount:    post.LikesCount,
+		IsRepost:      post.Kind == models.KindRepost || post.Kind == models.KindQuote,
+		ReplyAudience: post.ReplyAudience,
+		Labels:        mapLabels(post.Labels),
+		ParentPost:    parentPost, // <- This ensures parent post is included
+		Entities:      mapEntities(post),
+		Card:          mapCard(post.LinkCard),
+	}
+}
+
+func mapLabels(labels []models.PostLabel) []models.ContentLabel {
+	mapped := make([]models.ContentLabel, len(labels))
+	for i, l := range labels {
+		mapped[i] = l.Label
+	}
+	return mapped
+}
+
+func mapCard(card *models.LinkCard) *CardResponse {
+	if card == nil {
+		return nil
+	}
+	return &CardResponse{
+		URL:         card.URL,
+		Title:       card.Title,
+		Description: card.Description,
+		ImageURL:    card.ImageURL,
+		SiteName:    card.SiteName,
+		CardType:    card.CardType,
+	}
+}
+
+// mapEntities extracts the entities of the body, keeping only the mentions resolved when the post was saved.
+// Mentions give the current username of the mentioned user, which differs from the body after a rename.
+func mapEntities(post models.Post) []EntityResponse {
+	resolved := make(map[string]models.Mention, len(post.Mentions))
+	for _, m := range post.Mentions {
+		resolved[strings.ToLower(m.Username)] = m
+	}
+
+	entities := []EntityResponse{}
+	for _, e := range text.Extract(post.Body) {
+		response := EntityResponse{
+			Type:       e.Type,
+			Text:       e.Text,
+			Value:      e.Value,
+			Start:      e.Start,
+			End:        e.End,
+			StartUTF16: e.StartUTF16,
+			EndUTF16:   e.EndUTF16,
+		}
+
+		if e.Type == text.Mention {
+			m, ok := resolved[strings.ToLower(e.Value)]
+			if !ok {
+				continue
+			}
+			userID := m.UserID
+			response.UserID = &userID
+			response.Value = m.Username
+			if m.User != nil {
+				response.Value = m.User.Username
+			}
+		}
+
+		entities = append(entities, response)
 	}
+	return entities
 }
@@ -0,0 +1,20 @@
+package models
+
+import "time"
+
+type PostEventKind string
+
+const (
+	EventImpression   PostEventKind = "impression"
+	EventProfileClick PostEventKind = "profile_click"
+)
+
+// PostEvent records that a viewer saw a post, or opened its author's profile from it, during the window
+// starting at WindowStart. The unique index keeps a single event per viewer, post and window.
+type PostEvent struct {
+	ID          uint          `gorm:"primaryKey"`
+	PostID      uint          `gorm:"uniqueIndex:idx_post_event;not null"`
+	Kind        PostEventKind `gorm:"type:varchar(16);uniqueIndex:idx_post_event;not null"`
+	ViewerKey   string        `gorm:"type:varchar(64);uniqueIndex:idx_post_event;not null"`
+	WindowStart time.Time     `gorm:"uniqueIndex:idx_post_event;index;not null"`
+}
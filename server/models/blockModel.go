@@ -0,0 +1,30 @@
+package models
+
+import (
+	"gorm.io/gorm"
+	"time"
+)
+
+// Block hides two users from each other. It works both ways: neither can follow, reply to, repost, like or
+// message the other, and their posts are left out of each other's timelines.
+type Block struct {
+	ID        uint      `json:"id" gorm:"primaryKey"`
+	CreatedAt time.Time `json:"created_at"`
+	BlockerID uint      `json:"blocker_id" gorm:"uniqueIndex:idx_block;not null"`
+	BlockedID uint      `json:"blocked_id" gorm:"uniqueIndex:idx_block;index;not null"`
+}
+
+// WithoutBlocked leaves out of a posts query the posts of the users the viewer blocked or was blocked by, so that
+// pages are filled with visible posts. Anonymous viewers (viewerID 0) have no blocks.
+func WithoutBlocked(viewerID uint) func(*gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		if viewerID == 0 {
+			return db
+		}
+		blocked := db.Session(&gorm.Session{NewDB: true}).Model(&Block{}).
+			Select("blocked_id").Where("blocker_id = ?", viewerID)
+		blockedBy := db.Session(&gorm.Session{NewDB: true}).Model(&Block{}).
+			Select("blocker_id").Where("blocked_id = ?", viewerID)
+		return db.Where("posts.user_id NOT IN (?) AND posts.user_id NOT IN (?)", blocked, blockedBy)
+	}
+}
@@ -0,0 +1,19 @@
+package models
+
+import "time"
+
+type BookmarkFolder struct {
+	ID        uint      `json:"id" gorm:"primaryKey"`
+	CreatedAt time.Time `json:"created_at"`
+	UserID    uint      `json:"user_id" gorm:"uniqueIndex:idx_user_folder_name;not null"`
+	Name      string    `json:"name" gorm:"uniqueIndex:idx_user_folder_name;not null"`
+}
+
+// Bookmark privately saves a post for a user, optionally inside one of their folders.
+type Bookmark struct {
+	ID        uint      `json:"id" gorm:"primaryKey"`
+	CreatedAt time.Time `json:"created_at"`
+	UserID    uint      `json:"user_id" gorm:"uniqueIndex:idx_user_bookmark;not null"`
+	PostID    uint      `json:"post_id" gorm:"uniqueIndex:idx_user_bookmark;index;not null"`
+	FolderID  *uint     `json:"folder_id" gorm:"index"`
+}
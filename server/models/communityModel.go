@@ -0,0 +1,44 @@
+package models
+
+import "time"
+
+// CommunityRole is what a member can do in a community. Owners and moderators can remove posts,
+// and only the owner can change roles.
+type CommunityRole string
+
+const (
+	RoleOwner     CommunityRole = "owner"
+	RoleModerator CommunityRole = "moderator"
+	RoleMember    CommunityRole = "member"
+)
+
+func (r CommunityRole) CanModerate() bool {
+	return r == RoleOwner || r == RoleModerator
+}
+
+type Community struct {
+	ID          uint            `json:"id" gorm:"primaryKey"`
+	CreatedAt   time.Time       `json:"created_at"`
+	OwnerID     uint            `json:"owner_id" gorm:"index;not null"`
+	Name        string          `json:"name" gorm:"uniqueIndex;not null"`
+	Description string          `json:"description"`
+	MemberCount uint            `json:"member_count" gorm:"not null;default:0"`
+	Rules       []CommunityRule `json:"rules" gorm:"foreignKey:CommunityID"`
+}
+
+// CommunityRule is one of the numbered rules shown to people joining a community.
+type CommunityRule struct {
+	ID          uint   `json:"id" gorm:"primaryKey"`
+	CommunityID uint   `json:"community_id" gorm:"index;not null"`
+	Position    int    `json:"position" gorm:"not null"`
+	Title       string `json:"title" gorm:"not null"`
+	Description string `json:"description"`
+}
+
+type CommunityMember struct {
+	ID          uint          `json:"id" gorm:"primaryKey"`
+	CreatedAt   time.Time     `json:"created_at"`
+	CommunityID uint          `json:"community_id" gorm:"uniqueIndex:idx_community_member;not null"`
+	UserID      uint          `json:"user_id" gorm:"uniqueIndex:idx_community_member;index;not null"`
+	Role        CommunityRole `json:"role" gorm:"type:varchar(16);not null;default:'member'"`
+}
@@ -0,0 +1,40 @@
+package models
+
+import "time"
+
+// ActorKey is the key pair a local user signs their federated requests with. It is created the first time
+// the user is seen by another server.
+type ActorKey struct {
+	ID            uint      `json:"id" gorm:"primaryKey"`
+	CreatedAt     time.Time `json:"created_at"`
+	UserID        uint      `json:"user_id" gorm:"uniqueIndex;not null"`
+	PublicKeyPEM  string    `json:"public_key_pem" gorm:"type:text;not null"`
+	PrivateKeyPEM string    `json:"-" gorm:"type:text;not null"`
+}
+
+// RemoteActor is an account of another server. It is mirrored by a remote User, named user@domain, so that
+// its posts, likes and follows are stored like local ones.
+type RemoteActor struct {
+	ID           uint      `json:"id" gorm:"primaryKey"`
+	CreatedAt    time.Time `json:"created_at"`
+	UpdatedAt    time.Time `json:"updated_at"`
+	UserID       uint      `json:"user_id" gorm:"uniqueIndex;not null"`
+	ActorURI     string    `json:"actor_uri" gorm:"uniqueIndex;not null"`
+	KeyID        string    `json:"key_id" gorm:"index;not null"`
+	PublicKeyPEM string    `json:"-" gorm:"type:text;not null"`
+	Inbox        string    `json:"inbox" gorm:"not null"`
+	SharedInbox  string    `json:"shared_inbox"`
+}
+
+// Delivery is an activity waiting to be posted to the inbox of another server, signed by its sender. Failed
+// deliveries are retried later, until they run out of attempts.
+type Delivery struct {
+	ID            uint      `json:"id" gorm:"primaryKey"`
+	CreatedAt     time.Time `json:"created_at"`
+	SenderID      uint      `json:"sender_id" gorm:"not null"`
+	Inbox         string    `json:"inbox" gorm:"not null"`
+	Payload       string    `json:"payload" gorm:"type:text;not null"`
+	Attempts      int       `json:"attempts" gorm:"not null;default:0"`
+	NextAttemptAt time.Time `json:"next_attempt_at" gorm:"index;not null"`
+	LastError     string    `json:"last_error"`
+}
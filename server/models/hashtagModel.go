@@ -0,0 +1,18 @@
+package models
+
+import "time"
+
+type Hashtag struct {
+	ID        uint      `json:"id" gorm:"primaryKey"`
+	CreatedAt time.Time `json:"created_at"`
+	Tag       string    `json:"tag" gorm:"uniqueIndex;not null"`
+}
+
+// PostHashtag links a post to every normalized tag found in its body.
+// CreatedAt mirrors the post creation time so trending windows can be computed without joining posts.
+type PostHashtag struct {
+	ID        uint      `gorm:"primaryKey"`
+	PostID    uint      `gorm:"uniqueIndex:idx_post_hashtag;not null"`
+	HashtagID uint      `gorm:"uniqueIndex:idx_post_hashtag;index;not null"`
+	CreatedAt time.Time `gorm:"index"`
+}
@@ -0,0 +1,48 @@
+package models
+
+import "time"
+
+type ContentLabel string
+
+const (
+	LabelSensitive ContentLabel = "sensitive"
+	LabelNudity    ContentLabel = "nudity"
+	LabelViolence  ContentLabel = "violence"
+	LabelSpoiler   ContentLabel = "spoiler"
+)
+
+func (l ContentLabel) IsValid() bool {
+	switch l {
+	case LabelSensitive, LabelNudity, LabelViolence, LabelSpoiler:
+		return true
+	}
+	return false
+}
+
+// SensitivePreference is how a viewer wants labeled posts to be shown. Hidden posts are left out of
+// timelines, but a post opened directly is only blurred.
+type SensitivePreference string
+
+const (
+	SensitiveShow SensitivePreference = "show"
+	SensitiveBlur SensitivePreference = "blur"
+	SensitiveHide SensitivePreference = "hide"
+)
+
+func (p SensitivePreference) IsValid() bool {
+	switch p {
+	case SensitiveShow, SensitiveBlur, SensitiveHide:
+		return true
+	}
+	return false
+}
+
+// PostLabel is a content warning on a post, added by its author when posting or by a moderator later.
+type PostLabel struct {
+	ID          uint         `json:"id" gorm:"primaryKey"`
+	CreatedAt   time.Time    `json:"created_at"`
+	PostID      uint         `json:"post_id" gorm:"uniqueIndex:idx_post_label;not null"`
+	Label       ContentLabel `json:"label" gorm:"type:varchar(16);uniqueIndex:idx_post_label;not null"`
+	AppliedByID uint         `json:"applied_by_id" gorm:"not null"`
+	ByModerator bool         `json:"by_moderator" gorm:"not null;default:false"`
+}
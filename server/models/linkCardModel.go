@@ -0,0 +1,19 @@
+package models
+
+import "time"
+
+// LinkCard caches the preview metadata of a URL so each page is fetched at most once per refresh period.
+// FetchError keeps the last failure so unreachable pages are not fetched again on every post, for a shorter
+// period than successful fetches.
+type LinkCard struct {
+	ID          uint      `json:"id" gorm:"primaryKey"`
+	CreatedAt   time.Time `json:"created_at"`
+	URL         string    `json:"url" gorm:"uniqueIndex;not null"`
+	Title       string    `json:"title"`
+	Description string    `json:"description"`
+	ImageURL    string    `json:"image_url"`
+	SiteName    string    `json:"site_name"`
+	CardType    string    `json:"card_type"`
+	FetchedAt   time.Time `json:"fetched_at"`
+	FetchError  string    `json:"-"`
+}
@@ -0,0 +1,28 @@
+package models
+
+import "time"
+
+// List is a curated group of accounts. Private lists are only visible to their owner.
+type List struct {
+	ID          uint      `json:"id" gorm:"primaryKey"`
+	CreatedAt   time.Time `json:"created_at"`
+	OwnerID     uint      `json:"owner_id" gorm:"index;not null"`
+	Name        string    `json:"name" gorm:"not null"`
+	Description string    `json:"description"`
+	Private     bool      `json:"private" gorm:"not null;default:false"`
+}
+
+type ListMember struct {
+	ID        uint      `json:"id" gorm:"primaryKey"`
+	CreatedAt time.Time `json:"created_at"`
+	ListID    uint      `json:"list_id" gorm:"uniqueIndex:idx_list_member;not null"`
+	UserID    uint      `json:"user_id" gorm:"uniqueIndex:idx_list_member;index;not null"`
+}
+
+// ListSubscription follows a list owned by someone else, so it shows up among the subscriber's lists.
+type ListSubscription struct {
+	ID        uint      `json:"id" gorm:"primaryKey"`
+	CreatedAt time.Time `json:"created_at"`
+	ListID    uint      `json:"list_id" gorm:"uniqueIndex:idx_list_subscription;index;not null"`
+	UserID    uint      `json:"user_id" gorm:"uniqueIndex:idx_list_subscription;not null"`
+}
@@ -0,0 +1,15 @@
+package models
+
+import "time"
+
+// Mention stores a resolved @username reference. The mentioned user is tracked by ID so that mentions
+// survive username changes: Username is the handle as written in the post, which is never rewritten, and
+// the current handle is read from User.
+type Mention struct {
+	ID        uint      `json:"id" gorm:"primaryKey"`
+	CreatedAt time.Time `json:"created_at"`
+	PostID    uint      `json:"post_id" gorm:"uniqueIndex:idx_post_mention;not null"`
+	UserID    uint      `json:"user_id" gorm:"uniqueIndex:idx_post_mention;index;not null"`
+	Username  string    `json:"username"`
+	User      *User     `json:"-" gorm:"foreignKey:UserID;constraint:-"`
+}
@@ -0,0 +1,45 @@
+package models
+
+import (
+	"gorm.io/gorm"
+	"time"
+)
+
+// MutedAccount hides the posts of an account from the user who muted it. Unlike a block, the muted account is
+// not told and can still follow, reply to and message the user.
+type MutedAccount struct {
+	ID        uint      `json:"id" gorm:"primaryKey"`
+	CreatedAt time.Time `json:"created_at"`
+	UserID    uint      `json:"user_id" gorm:"uniqueIndex:idx_muted_account;not null"`
+	MutedID   uint      `json:"muted_id" gorm:"uniqueIndex:idx_muted_account;not null"`
+}
+
+// WithoutMuted leaves out of a posts query the posts of the accounts the viewer muted. Muted words and
+// conversations are applied once the posts are loaded. Anonymous viewers (viewerID 0) have no mutes.
+func WithoutMuted(viewerID uint) func(*gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		if viewerID == 0 {
+			return db
+		}
+		muted := db.Session(&gorm.Session{NewDB: true}).Model(&MutedAccount{}).
+			Select("muted_id").Where("user_id = ?", viewerID)
+		return db.Where("posts.user_id NOT IN (?)", muted)
+	}
+}
+
+// MutedWord hides the posts containing a word or phrase until it expires. It never expires when ExpiresAt is nil.
+type MutedWord struct {
+	ID        uint       `json:"id" gorm:"primaryKey"`
+	CreatedAt time.Time  `json:"created_at"`
+	UserID    uint       `json:"user_id" gorm:"uniqueIndex:idx_muted_word;not null"`
+	Phrase    string     `json:"phrase" gorm:"uniqueIndex:idx_muted_word;not null"`
+	ExpiresAt *time.Time `json:"expires_at"`
+}
+
+// MutedConversation hides a whole thread, identified by the post that started it.
+type MutedConversation struct {
+	ID         uint      `json:"id" gorm:"primaryKey"`
+	CreatedAt  time.Time `json:"created_at"`
+	UserID     uint      `json:"user_id" gorm:"uniqueIndex:idx_muted_conversation;not null"`
+	RootPostID uint      `json:"root_post_id" gorm:"uniqueIndex:idx_muted_conversation;index;not null"`
+}
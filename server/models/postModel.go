@@ -5,23 +5,95 @@ import (
 	"time"
 )
 
+// PostKind tells what a post is. Replies point to the post they answer through ReplyToID,
+// while reposts and quotes point to the post they share through QuotedPostID.
+type PostKind string
+
+const (
+	KindOriginal PostKind = "original"
+	KindReply    PostKind = "reply"
+	KindRepost   PostKind = "repost"
+	KindQuote    PostKind = "quote"
+)
+
+// ReplyAudience limits who can reply to a post; its author always can. With ReplyFollowing, only the
+// people followed by the author can reply. Reposts are replied to through the post they share.
+type ReplyAudience string
+
+const (
+	ReplyEveryone  ReplyAudience = "everyone"
+	ReplyFollowing ReplyAudience = "following"
+	ReplyMentioned ReplyAudience = "mentioned"
+	ReplyNobody    ReplyAudience = "nobody"
+)
+
+func (a ReplyAudience) IsValid() bool {
+	switch a {
+	case ReplyEveryone, ReplyFollowing, ReplyMentioned, ReplyNobody:
+		return true
+	}
+	return false
+}
+
 type Post struct {
-	ID           uint      `json:"id" gorm:"primaryKey"`
-	CreatedAt    time.Time `json:"created_at"`
-	UserID       uint      `json:"user_id"`
-	Nickname     string    `json:"nickname"`
-	Username     string    `json:"username"`
-	ParentID     *uint     `json:"parent_id"`
-	Quote        *string   `json:"quote"`
-	Body         string    `json:"body"`
-	LikesCount   uint      `json:"likes_count"`
-	RepostsCount uint      `json:"reposts_count"`
-	IsRepost     bool      `json:"is_repost"`
-	ParentPost   *Post     `gorm:"foreignKey:ParentID"`
+	ID            uint          `json:"id" gorm:"primaryKey"`
+	CreatedAt     time.Time     `json:"created_at" gorm:"index"`
+	UserID        uint          `json:"user_id" gorm:"index:idx_post_merged,where:fanned_out = false"`
+	Nickname      string        `json:"nickname"`
+	Username      string        `json:"username"`
+	Kind          PostKind      `json:"kind" gorm:"type:varchar(16);not null;default:'original';index"`
+	ReplyToID     *uint         `json:"reply_to_id" gorm:"index"`
+	QuotedPostID  *uint         `json:"quoted_post_id" gorm:"index"`
+	CommunityID   *uint         `json:"community_id" gorm:"index"`
+	Body          string        `json:"body"`
+	ReplyAudience ReplyAudience `json:"reply_audience" gorm:"type:varchar(16);not null;default:'everyone'"`
+	LikesCount    uint          `json:"likes_count"`
+	RepostsCount  uint          `json:"reposts_count"`
+	ReplyTo       *Post         `json:"reply_to,omitempty" gorm:"foreignKey:ReplyToID"`
+	QuotedPost    *Post         `json:"quoted_post,omitempty" gorm:"foreignKey:QuotedPostID"`
+	Mentions      []Mention     `json:"mentions,omitempty" gorm:"foreignKey:PostID"`
+	Labels        []PostLabel   `json:"labels,omitempty" gorm:"foreignKey:PostID"`
+	LinkCardID    *uint         `json:"link_card_id"`
+	LinkCard      *LinkCard     `json:"link_card,omitempty" gorm:"foreignKey:LinkCardID"`
+	// FannedOut tells whether the post was written to the home timelines of the followers of its author. The
+	// posts of large accounts are not, and are merged into those timelines when they are read instead.
+	FannedOut bool `json:"-" gorm:"not null;default:false"`
+	// ActivityURI is the ActivityPub ID of a post received from another server.
+	ActivityURI *string `json:"-" gorm:"uniqueIndex"`
+}
+
+// ReferencedPostID returns the post answered by a reply or shared by a repost or quote.
+func (p *Post) ReferencedPostID() *uint {
+	if p.Kind == KindReply {
+		return p.ReplyToID
+	}
+	return p.QuotedPostID
+}
+
+// ReferencedPost is the loaded counterpart of ReferencedPostID.
+func (p *Post) ReferencedPost() *Post {
+	if p.Kind == KindReply {
+		return p.ReplyTo
+	}
+	return p.QuotedPost
+}
+
+// WithPostRelations preloads every association needed to render a post response.
+func WithPostRelations(db *gorm.DB) *gorm.DB {
+	return db.Preload("ReplyTo").
+		Preload("ReplyTo.Labels").
+		Preload("QuotedPost").
+		Preload("QuotedPost.Labels").
+		Preload("Mentions").
+		Preload("Mentions.User", func(db *gorm.DB) *gorm.DB { return db.Select("id", "username") }).
+		Preload("LinkCard").
+		Preload("Labels")
 }
 
+// Like is unique per user and post, so concurrent likes of the same post cannot be counted twice.
 type Like struct {
-	gorm.Model
-	PostID uint
-	UserID uint
+	ID        uint      `json:"id" gorm:"primaryKey"`
+	CreatedAt time.Time `json:"created_at"`
+	UserID    uint      `json:"user_id" gorm:"uniqueIndex:idx_user_like;not null"`
+	PostID    uint      `json:"post_id" gorm:"uniqueIndex:idx_user_like;index;not null"`
 }
@@ -0,0 +1,22 @@
+package models
+
+// RankingSource tells why a post was picked as a candidate of the For You timeline.
+type RankingSource string
+
+const (
+	SourceFollow   RankingSource = "follow"
+	SourceNetwork  RankingSource = "network"
+	SourceTrending RankingSource = "trending"
+)
+
+// RankingExplanation tells how a post of the For You timeline was scored, for debugging the ranking.
+type RankingExplanation struct {
+	Scorer       string        `json:"scorer"`
+	Source       RankingSource `json:"source"`
+	Score        float64       `json:"score"`
+	Engagement   float64       `json:"engagement"`
+	Recency      float64       `json:"recency"`
+	Affinity     float64       `json:"affinity"`
+	SourceWeight float64       `json:"source_weight"`
+	Rules        []string      `json:"rules,omitempty"`
+}
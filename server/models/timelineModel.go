@@ -0,0 +1,14 @@
+package models
+
+import "time"
+
+// TimelineEntry puts a post on the home timeline of a user, written when the post is created so that reading
+// a timeline is a single indexed query. CreatedAt is the creation time of the post, indexed per user so that
+// clients polling for posts newer than a time are answered from the index as well.
+type TimelineEntry struct {
+	ID        uint      `json:"id" gorm:"primaryKey"`
+	UserID    uint      `json:"user_id" gorm:"uniqueIndex:idx_timeline_entry;index:idx_timeline_entry_recent;not null"`
+	PostID    uint      `json:"post_id" gorm:"uniqueIndex:idx_timeline_entry;index;not null"`
+	AuthorID  uint      `json:"author_id" gorm:"index;not null"`
+	CreatedAt time.Time `json:"created_at" gorm:"index:idx_timeline_entry_recent"`
+}
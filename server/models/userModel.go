@@ -17,6 +17,13 @@ type User struct {
 	Location      *string        `json:"location"`
 	Bio           *string        `json:"bio"`
 	FollowerCount uint           `json:"follower_count"`
+	// PinnedPostID is only changed through the pin endpoints, never through profile edits.
+	PinnedPostID *uint `json:"-"`
+	// SensitiveContent and IsModerator cannot be changed through profile edits either.
+	SensitiveContent SensitivePreference `json:"-" gorm:"type:varchar(8);not null;default:'blur'"`
+	IsModerator      bool                `json:"-" gorm:"not null;default:false"`
+	// IsRemote marks the users mirroring accounts of other servers, who cannot log in.
+	IsRemote bool `json:"is_remote" gorm:"not null;default:false"`
 }
 
 type Follow struct {
@@ -0,0 +1,237 @@
+package analytics
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"log"
+	"strconv"
+	"sync"
+	"time"
+	"x-clone/server/constants"
+	"x-clone/server/models"
+)
+
+// anonymousKeyBytes is how much of the hashed client fingerprint identifies an anonymous viewer.
+const anonymousKeyBytes = 16
+
+// ViewerKey identifies who saw a post without storing raw client data. Anonymous viewers (userID 0)
+// are told apart by a hash of their address and user agent.
+func ViewerKey(userID uint, clientIP, userAgent string) string {
+	if userID != 0 {
+		return "user:" + strconv.FormatUint(uint64(userID), 10)
+	}
+	sum := sha256.Sum256([]byte(clientIP + "|" + userAgent))
+	return "anon:" + hex.EncodeToString(sum[:anonymousKeyBytes])
+}
+
+type eventKey struct {
+	postID    uint
+	kind      models.PostEventKind
+	viewerKey string
+}
+
+// Recorder buffers post events in memory and writes them in batches, so serving a timeline never waits
+// on an insert. Events already seen in the current window are dropped before reaching the database,
+// whose unique index catches the duplicates that slip through, for instance across restarts or once more
+// than ImpressionSeenMax events were seen and the in-memory set was cleared.
+type Recorder struct {
+	db      *gorm.DB
+	mu      sync.Mutex
+	pending []models.PostEvent
+	seen    map[eventKey]struct{}
+	window  time.Time
+}
+
+func NewRecorder(db *gorm.DB) *Recorder {
+	return &Recorder{db: db, seen: make(map[eventKey]struct{})}
+}
+
+// Record queues one event per post for the viewer, flushing in the background once a batch is full.
+func (r *Recorder) Record(kind models.PostEventKind, viewerKey string, postIDs []uint) {
+	window := time.Now().UTC().Truncate(constants.ImpressionWindow)
+
+	r.mu.Lock()
+	if !window.Equal(r.window) || len(r.seen) >= constants.ImpressionSeenMax {
+		r.window = window
+		r.seen = make(map[eventKey]struct{})
+	}
+	for _, postID := range postIDs {
+		key := eventKey{postID: postID, kind: kind, viewerKey: viewerKey}
+		if _, ok := r.seen[key]; ok {
+			continue
+		}
+		r.seen[key] = struct{}{}
+		r.pending = append(r.pending, models.PostEvent{
+			PostID:      postID,
+			Kind:        kind,
+			ViewerKey:   viewerKey,
+			WindowStart: window,
+		})
+	}
+	full := len(r.pending) >= constants.ImpressionBatchSize
+	r.mu.Unlock()
+
+	if full {
+		go r.flushAndLog()
+	}
+}
+
+// Flush writes every queued event. Events that fail to be written are dropped.
+func (r *Recorder) Flush() error {
+	r.mu.Lock()
+	batch := r.pending
+	r.pending = nil
+	r.mu.Unlock()
+
+	if len(batch) == 0 {
+		return nil
+	}
+	return r.db.Clauses(clause.OnConflict{DoNothing: true}).
+		CreateInBatches(batch, constants.ImpressionBatchSize).Error
+}
+
+func (r *Recorder) flushAndLog() {
+	if err := r.Flush(); err != nil {
+		log.Println("Failed to write post events:", err)
+	}
+}
+
+func (r *Recorder) run(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for range ticker.C {
+		r.flushAndLog()
+	}
+}
+
+var (
+	defaultRecorder *Recorder
+	startRecorder   sync.Once
+)
+
+// recorder returns the recorder shared by every request, starting its periodic flush on first use.
+func recorder(db *gorm.DB) *Recorder {
+	startRecorder.Do(func() {
+		defaultRecorder = NewRecorder(db)
+		go defaultRecorder.run(constants.ImpressionFlushInterval)
+	})
+	return defaultRecorder
+}
+
+// Flush writes the events still queued by the shared recorder, if it was started. It is called on shutdown so
+// that the last events are not lost.
+func Flush() error {
+	if defaultRecorder == nil {
+		return nil
+	}
+	return defaultRecorder.Flush()
+}
+
+func RecordImpressions(db *gorm.DB, viewerKey string, postIDs []uint) {
+	if len(postIDs) > 0 {
+		recorder(db).Record(models.EventImpression, viewerKey, postIDs)
+	}
+}
+
+func RecordProfileClick(db *gorm.DB, viewerKey string, postID uint) {
+	recorder(db).Record(models.EventProfileClick, viewerKey, []uint{postID})
+}
+
+// RemovePostEvents deletes every event of a post, used when the post itself is deleted.
+func RemovePostEvents(db *gorm.DB, postID uint) error {
+	return db.Where("post_id = ?", postID).Delete(&models.PostEvent{}).Error
+}
+
+type HourlyStats struct {
+	Hour          time.Time `json:"hour"`
+	Impressions   int64     `json:"impressions"`
+	Engagements   int64     `json:"engagements"`
+	ProfileClicks int64     `json:"profile_clicks"`
+}
+
+// PostStats sums up how a post performed. Engagements are likes, reposts (quotes included), replies and
+// profile clicks. Impressions and profile clicks are written in batches, so the latest seconds may be missing.
+type PostStats struct {
+	PostID         uint          `json:"post_id"`
+	Impressions    int64         `json:"impressions"`
+	Engagements    int64         `json:"engagements"`
+	EngagementRate float64       `json:"engagement_rate"`
+	Likes          int64         `json:"likes"`
+	Reposts        int64         `json:"reposts"`
+	Replies        int64         `json:"replies"`
+	ProfileClicks  int64         `json:"profile_clicks"`
+	Hourly         []HourlyStats `json:"hourly"`
+}
+
+// GetPostStats returns the all-time totals of a post with an hourly breakdown of its last hours.
+func GetPostStats(db *gorm.DB, postID uint, hours int) (*PostStats, error) {
+	var rows []struct {
+		Hour   time.Time
+		Source string
+		Count  int64
+	}
+	err := db.Raw(`
+		SELECT date_trunc('hour', activity.at) AS hour, activity.source, COUNT(*) AS count
+		FROM (
+			SELECT window_start AS at, kind AS source FROM post_events WHERE post_id = @postID
+			UNION ALL
+			SELECT created_at, 'like' FROM likes WHERE post_id = @postID
+			UNION ALL
+			SELECT created_at, 'repost' FROM posts WHERE quoted_post_id = @postID AND kind IN ('repost', 'quote')
+			UNION ALL
+			SELECT created_at, 'reply' FROM posts WHERE reply_to_id = @postID
+		) AS activity
+		GROUP BY 1, 2`,
+		map[string]interface{}{"postID": postID}).Scan(&rows).Error
+	if err != nil {
+		return nil, fmt.Errorf("internal server error: %w", err)
+	}
+
+	now := time.Now().UTC().Truncate(time.Hour)
+	since := now.Add(-time.Duration(hours-1) * time.Hour)
+	hourly := make([]HourlyStats, hours)
+	for i := range hourly {
+		hourly[i].Hour = since.Add(time.Duration(i) * time.Hour)
+	}
+
+	stats := &PostStats{PostID: postID, Hourly: hourly}
+	for _, row := range rows {
+		var bucket *HourlyStats
+		if hour := row.Hour.UTC(); !hour.Before(since) && !hour.After(now) {
+			bucket = &hourly[int(hour.Sub(since)/time.Hour)]
+		}
+
+		switch row.Source {
+		case string(models.EventImpression):
+			stats.Impressions += row.Count
+			if bucket != nil {
+				bucket.Impressions += row.Count
+			}
+			continue
+		case string(models.EventProfileClick):
+			stats.ProfileClicks += row.Count
+			if bucket != nil {
+				bucket.ProfileClicks += row.Count
+			}
+		case "like":
+			stats.Likes += row.Count
+		case "repost":
+			stats.Reposts += row.Count
+		case "reply":
+			stats.Replies += row.Count
+		}
+
+		stats.Engagements += row.Count
+		if bucket != nil {
+			bucket.Engagements += row.Count
+		}
+	}
+
+	if stats.Impressions > 0 {
+		stats.EngagementRate = float64(stats.Engagements) / float64(stats.Impressions)
+	}
+	return stats, nil
+}
@@ -0,0 +1,130 @@
+package block
+
+import (
+	"errors"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"x-clone/server/constants"
+	"x-clone/server/models"
+	"x-clone/server/services/timeline"
+)
+
+var (
+	ErrBlocked         = errors.New("you cannot interact with this user")
+	ErrCannotBlockSelf = errors.New("you cannot block yourself")
+)
+
+// BlockUser blocks a user; blocking twice is not an error. The follows between both users are removed
+// in both directions, along with their posts in each other's home timeline.
+func BlockUser(db *gorm.DB, blockerID uint, blockerUsername, blockedUsername string) error {
+	if blockerUsername == blockedUsername {
+		return ErrCannotBlockSelf
+	}
+	blockedID, err := userIDByUsername(db, blockedUsername)
+	if err != nil {
+		return err
+	}
+
+	return db.Transaction(func(tx *gorm.DB) error {
+		block := models.Block{BlockerID: blockerID, BlockedID: blockedID}
+		if err := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&block).Error; err != nil {
+			return err
+		}
+
+		for _, pair := range [][2]string{{blockerUsername, blockedUsername}, {blockedUsername, blockerUsername}} {
+			follower, followed := pair[0], pair[1]
+			result := tx.Where("following_username = ? AND followed_username = ?", follower, followed).
+				Delete(&models.Follow{})
+			if result.Error != nil {
+				return result.Error
+			}
+			if result.RowsAffected > 0 {
+				if err := tx.Model(&models.User{}).Where("username = ? AND follower_count > 0", followed).
+					UpdateColumn("follower_count", gorm.Expr("follower_count - 1")).Error; err != nil {
+					return err
+				}
+			}
+			if err := timeline.RemoveAuthor(tx, follower, followed); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// UnblockUser removes a block; unblocking a user who is not blocked is not an error. Follows removed by
+// the block are not restored.
+func UnblockUser(db *gorm.DB, blockerID uint, blockedUsername string) error {
+	blockedID, err := userIDByUsername(db, blockedUsername)
+	if err != nil {
+		return err
+	}
+	return db.Where("blocker_id = ? AND blocked_id = ?", blockerID, blockedID).Delete(&models.Block{}).Error
+}
+
+// GetBlockedUsers returns the users blocked by the user, most recently blocked first.
+func GetBlockedUsers(db *gorm.DB, blockerID uint) ([]models.User, error) {
+	var users []models.User
+	if err := db.Joins("JOIN blocks ON blocks.blocked_id = users.id").
+		Where("blocks.blocker_id = ?", blockerID).
+		Order("blocks.id desc").
+		Find(&users).Error; err != nil {
+		return nil, err
+	}
+	return users, nil
+}
+
+// IsBlocked tells whether either user blocked the other.
+func IsBlocked(db *gorm.DB, userID, otherID uint) (bool, error) {
+	var count int64
+	err := db.Model(&models.Block{}).
+		Where("(blocker_id = ? AND blocked_id = ?) OR (blocker_id = ? AND blocked_id = ?)",
+			userID, otherID, otherID, userID).
+		Count(&count).Error
+	return count > 0, err
+}
+
+// IsBlockedWith is IsBlocked for a user known by username. Unknown users are not blocked.
+func IsBlockedWith(db *gorm.DB, userID uint, otherUsername string) (bool, error) {
+	otherID, err := userIDByUsername(db, otherUsername)
+	if err != nil {
+		if err.Error() == constants.ErrNoUser {
+			return false, nil
+		}
+		return false, err
+	}
+	return IsBlocked(db, userID, otherID)
+}
+
+// BlockedUserIDs returns the users the user blocked or was blocked by. Anonymous users (userID 0) have none.
+func BlockedUserIDs(db *gorm.DB, userID uint) (map[uint]bool, error) {
+	blocked := make(map[uint]bool)
+	if userID == 0 {
+		return blocked, nil
+	}
+
+	var ids []uint
+	if err := db.Raw(`
+		SELECT blocked_id FROM blocks WHERE blocker_id = @user
+		UNION
+		SELECT blocker_id FROM blocks WHERE blocked_id = @user`,
+		map[string]interface{}{"user": userID}).Scan(&ids).Error; err != nil {
+		return nil, err
+	}
+	for _, id := range ids {
+		blocked[id] = true
+	}
+	return blocked, nil
+}
+
+func userIDByUsername(db *gorm.DB, username string) (uint, error) {
+	var u models.User
+	err := db.Select("id").Where("username = ?", username).First(&u).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return 0, errors.New(constants.ErrNoUser)
+	}
+	if err != nil {
+		return 0, err
+	}
+	return u.ID, nil
+}
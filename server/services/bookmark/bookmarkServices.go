@@ -0,0 +1,159 @@
+package bookmark
+
+import (
+	"errors"
+	"fmt"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"strings"
+	"x-clone/server/constants"
+	"x-clone/server/models"
+)
+
+var (
+	ErrNoFolder          = errors.New("no bookmark folder found")
+	ErrInvalidFolderName = errors.New("folder name cannot be empty")
+	ErrFolderNameTaken   = errors.New("a folder with this name already exists")
+)
+
+// AddBookmark saves a post for a user. Bookmarking an already saved post only moves it to the given folder.
+func AddBookmark(db *gorm.DB, userID, postID uint, folderID *uint) error {
+	var postCount int64
+	if err := db.Model(&models.Post{}).Where("id = ?", postID).Count(&postCount).Error; err != nil {
+		return err
+	}
+	if postCount == 0 {
+		return errors.New(constants.ErrNoPost)
+	}
+
+	if folderID != nil {
+		if _, err := getFolder(db, userID, *folderID); err != nil {
+			return err
+		}
+	}
+
+	bookmark := models.Bookmark{UserID: userID, PostID: postID, FolderID: folderID}
+	return db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "user_id"}, {Name: "post_id"}},
+		DoUpdates: clause.AssignmentColumns([]string{"folder_id"}),
+	}).Create(&bookmark).Error
+}
+
+// RemoveBookmark deletes a bookmark; removing a post that was not bookmarked is not an error.
+func RemoveBookmark(db *gorm.DB, userID, postID uint) error {
+	return db.Where("user_id = ? AND post_id = ?", userID, postID).Delete(&models.Bookmark{}).Error
+}
+
+// RemovePostBookmarks deletes every bookmark of a post, used when the post itself is deleted.
+func RemovePostBookmarks(db *gorm.DB, postID uint) error {
+	return db.Where("post_id = ?", postID).Delete(&models.Bookmark{}).Error
+}
+
+// GetBookmarkedPosts returns a page of the user's bookmarked posts, most recently saved first. It pages like
+// timeline.Page, on bookmark IDs rather than post IDs.
+func GetBookmarkedPosts(db *gorm.DB, userID uint, folderID *uint, limit int, cursor uint) ([]models.Post, uint, error) {
+	query := db.Where("user_id = ?", userID)
+	if folderID != nil {
+		query = query.Where("folder_id = ?", *folderID)
+	}
+	if cursor != 0 {
+		query = query.Where("id < ?", cursor)
+	}
+
+	var bookmarks []models.Bookmark
+	if err := query.Order("id desc").Limit(limit + 1).Find(&bookmarks).Error; err != nil {
+		return nil, 0, fmt.Errorf("internal server error: %w", err)
+	}
+
+	var nextCursor uint
+	if len(bookmarks) > limit {
+		bookmarks = bookmarks[:limit]
+		nextCursor = bookmarks[limit-1].ID
+	}
+	if len(bookmarks) == 0 {
+		return []models.Post{}, 0, nil
+	}
+
+	postIDs := make([]uint, len(bookmarks))
+	for i, b := range bookmarks {
+		postIDs[i] = b.PostID
+	}
+
+	var posts []models.Post
+	if err := db.Scopes(models.WithPostRelations).Where("id IN ?", postIDs).Find(&posts).Error; err != nil {
+		return nil, 0, fmt.Errorf("internal server error: %w", err)
+	}
+
+	// Keep the bookmark order rather than the post order.
+	byID := make(map[uint]models.Post, len(posts))
+	for _, post := range posts {
+		byID[post.ID] = post
+	}
+	ordered := make([]models.Post, 0, len(posts))
+	for _, postID := range postIDs {
+		if post, ok := byID[postID]; ok {
+			ordered = append(ordered, post)
+		}
+	}
+
+	return ordered, nextCursor, nil
+}
+
+func CreateFolder(db *gorm.DB, userID uint, name string) (*models.BookmarkFolder, error) {
+	name = strings.TrimSpace(name)
+	if name == constants.Empty {
+		return nil, ErrInvalidFolderName
+	}
+
+	var existing int64
+	if err := db.Model(&models.BookmarkFolder{}).
+		Where("user_id = ? AND LOWER(name) = LOWER(?)", userID, name).
+		Count(&existing).Error; err != nil {
+		return nil, err
+	}
+	if existing > 0 {
+		return nil, ErrFolderNameTaken
+	}
+
+	folder := models.BookmarkFolder{UserID: userID, Name: name}
+	if err := db.Create(&folder).Error; err != nil {
+		return nil, err
+	}
+	return &folder, nil
+}
+
+func GetFolders(db *gorm.DB, userID uint) ([]models.BookmarkFolder, error) {
+	var folders []models.BookmarkFolder
+	if err := db.Where("user_id = ?", userID).Order("name asc").Find(&folders).Error; err != nil {
+		return nil, err
+	}
+	return folders, nil
+}
+
+// DeleteFolder removes a folder and keeps its bookmarks, which become unfiled.
+func DeleteFolder(db *gorm.DB, userID, folderID uint) error {
+	if _, err := getFolder(db, userID, folderID); err != nil {
+		return err
+	}
+
+	return db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&models.Bookmark{}).
+			Where("user_id = ? AND folder_id = ?", userID, folderID).
+			Update("folder_id", nil).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&models.BookmarkFolder{}, folderID).Error
+	})
+}
+
+func getFolder(db *gorm.DB, userID, folderID uint) (*models.BookmarkFolder, error) {
+	var folder models.BookmarkFolder
+	err := db.Where("id = ? AND user_id = ?", folderID, userID).First(&folder).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrNoFolder
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &folder, nil
+}
@@ -0,0 +1,317 @@
+package community
+
+import (
+	"errors"
+	"fmt"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"strings"
+	"time"
+	"unicode/utf8"
+	"x-clone/server/constants"
+	"x-clone/server/models"
+	"x-clone/server/services/timeline"
+)
+
+var (
+	ErrNoCommunity      = errors.New("no community found")
+	ErrNoMember         = errors.New("user is not a member of this community")
+	ErrNotMember        = errors.New("you must join this community first")
+	ErrNotModerator     = errors.New("only community moderators can do this")
+	ErrNotOwner         = errors.New("only the community owner can do this")
+	ErrOwnerCannotLeave = errors.New("the owner cannot leave their community")
+	ErrNameTaken        = errors.New("a community with this name already exists")
+	ErrInvalidRole      = errors.New("role must be moderator or member")
+	ErrInvalidName      = fmt.Errorf("community name must be between 1 and %d characters",
+		constants.MaxCommunityNameLength)
+	ErrDescriptionTooLong = fmt.Errorf("community description cannot be longer than %d characters",
+		constants.MaxCommunityDescriptionLength)
+	ErrInvalidRules = fmt.Errorf("a community has at most %d rules, each with a title of 1 to %d characters "+
+		"and a description of at most %d characters",
+		constants.MaxCommunityRules, constants.MaxCommunityRuleTitleLength, constants.MaxCommunityRuleDescriptionLength)
+)
+
+// Member is a community member along with their role.
+type Member struct {
+	UserID   uint                 `json:"user_id"`
+	Username string               `json:"username"`
+	Nickname string               `json:"nickname"`
+	Role     models.CommunityRole `json:"role"`
+	JoinedAt time.Time            `json:"joined_at"`
+}
+
+// CreateCommunity creates a community owned by the user, who becomes its first member.
+func CreateCommunity(db *gorm.DB, ownerID uint, name, description string, rules []models.CommunityRule) (
+	*models.Community, error) {
+	name, description = strings.TrimSpace(name), strings.TrimSpace(description)
+	if name == constants.Empty || utf8.RuneCountInString(name) > constants.MaxCommunityNameLength {
+		return nil, ErrInvalidName
+	}
+	if utf8.RuneCountInString(description) > constants.MaxCommunityDescriptionLength {
+		return nil, ErrDescriptionTooLong
+	}
+	rules, err := normalizeRules(rules)
+	if err != nil {
+		return nil, err
+	}
+
+	var existing int64
+	if err := db.Model(&models.Community{}).Where("LOWER(name) = LOWER(?)", name).Count(&existing).Error; err != nil {
+		return nil, err
+	}
+	if existing > 0 {
+		return nil, ErrNameTaken
+	}
+
+	community := models.Community{OwnerID: ownerID, Name: name, Description: description, MemberCount: 1}
+	errTx := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Omit("Rules").Create(&community).Error; err != nil {
+			return err
+		}
+		if err := replaceRules(tx, community.ID, rules); err != nil {
+			return err
+		}
+		return tx.Create(&models.CommunityMember{CommunityID: community.ID, UserID: ownerID, Role: models.RoleOwner}).
+			Error
+	})
+	if errTx != nil {
+		return nil, errTx
+	}
+	community.Rules = rules
+	return &community, nil
+}
+
+// GetCommunity returns a community with its rules in order.
+func GetCommunity(db *gorm.DB, communityID uint) (*models.Community, error) {
+	var community models.Community
+	err := db.Preload("Rules", func(db *gorm.DB) *gorm.DB {
+		return db.Order("position asc")
+	}).First(&community, communityID).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrNoCommunity
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &community, nil
+}
+
+// UpdateRules replaces the rules of a community, which only its moderators can do.
+func UpdateRules(db *gorm.DB, userID, communityID uint, rules []models.CommunityRule) ([]models.CommunityRule, error) {
+	if err := requireModerator(db, userID, communityID); err != nil {
+		return nil, err
+	}
+	rules, err := normalizeRules(rules)
+	if err != nil {
+		return nil, err
+	}
+
+	errTx := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("community_id = ?", communityID).Delete(&models.CommunityRule{}).Error; err != nil {
+			return err
+		}
+		return replaceRules(tx, communityID, rules)
+	})
+	if errTx != nil {
+		return nil, errTx
+	}
+	return rules, nil
+}
+
+// GetRole returns the role of the user in the community, or an empty role when they are not a member.
+func GetRole(db *gorm.DB, userID, communityID uint) (models.CommunityRole, error) {
+	var member models.CommunityMember
+	err := db.Where("community_id = ? AND user_id = ?", communityID, userID).First(&member).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return constants.Empty, nil
+	}
+	if err != nil {
+		return constants.Empty, err
+	}
+	return member.Role, nil
+}
+
+// CheckCanPost tells whether the user may post in the community, which requires being a member.
+func CheckCanPost(db *gorm.DB, userID, communityID uint) error {
+	if _, err := GetCommunity(db, communityID); err != nil {
+		return err
+	}
+	role, err := GetRole(db, userID, communityID)
+	if err != nil {
+		return err
+	}
+	if role == constants.Empty {
+		return ErrNotMember
+	}
+	return nil
+}
+
+// CanModerate tells whether the user may remove posts from the community.
+func CanModerate(db *gorm.DB, userID, communityID uint) (bool, error) {
+	role, err := GetRole(db, userID, communityID)
+	if err != nil {
+		return false, err
+	}
+	return role.CanModerate(), nil
+}
+
+// MemberCommunityIDs tells which of the given communities the user is a member of.
+func MemberCommunityIDs(db *gorm.DB, userID uint, communityIDs []uint) (map[uint]bool, error) {
+	memberOf := make(map[uint]bool, len(communityIDs))
+	if len(communityIDs) == 0 {
+		return memberOf, nil
+	}
+
+	var ids []uint
+	if err := db.Model(&models.CommunityMember{}).
+		Where("user_id = ? AND community_id IN ?", userID, communityIDs).
+		Pluck("community_id", &ids).Error; err != nil {
+		return nil, err
+	}
+	for _, id := range ids {
+		memberOf[id] = true
+	}
+	return memberOf, nil
+}
+
+// Join makes the user a member of the community; joining twice is not an error.
+func Join(db *gorm.DB, userID, communityID uint) error {
+	if _, err := GetCommunity(db, communityID); err != nil {
+		return err
+	}
+
+	return db.Transaction(func(tx *gorm.DB) error {
+		member := models.CommunityMember{CommunityID: communityID, UserID: userID, Role: models.RoleMember}
+		result := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&member)
+		if result.Error != nil || result.RowsAffected == 0 {
+			return result.Error
+		}
+		return tx.Model(&models.Community{}).Where("id = ?", communityID).
+			Update("member_count", gorm.Expr("member_count + 1")).Error
+	})
+}
+
+// Leave removes the user from the community; leaving a community the user is not in is not an error.
+// Their posts stay in the community.
+func Leave(db *gorm.DB, userID, communityID uint) error {
+	role, err := GetRole(db, userID, communityID)
+	if err != nil {
+		return err
+	}
+	if role == models.RoleOwner {
+		return ErrOwnerCannotLeave
+	}
+
+	return db.Transaction(func(tx *gorm.DB) error {
+		result := tx.Where("community_id = ? AND user_id = ?", communityID, userID).Delete(&models.CommunityMember{})
+		if result.Error != nil || result.RowsAffected == 0 {
+			return result.Error
+		}
+		return tx.Model(&models.Community{}).Where("id = ?", communityID).
+			Update("member_count", gorm.Expr("GREATEST(member_count - 1, 0)")).Error
+	})
+}
+
+// GetMembers returns the members of a community, owner and moderators first, then by join date.
+func GetMembers(db *gorm.DB, communityID uint) ([]Member, error) {
+	if _, err := GetCommunity(db, communityID); err != nil {
+		return nil, err
+	}
+
+	members := []Member{}
+	err := db.Table("community_members").
+		Select(`users.id AS user_id, users.username, users.nickname, community_members.role,
+			community_members.created_at AS joined_at`).
+		Joins("JOIN users ON users.id = community_members.user_id").
+		Where("community_members.community_id = ?", communityID).
+		Order(clause.Expr{SQL: "CASE community_members.role WHEN ? THEN 0 WHEN ? THEN 1 ELSE 2 END, " +
+			"community_members.id", Vars: []interface{}{models.RoleOwner, models.RoleModerator}}).
+		Scan(&members).Error
+	if err != nil {
+		return nil, err
+	}
+	return members, nil
+}
+
+// SetRole makes a member a moderator or a plain member again, which only the owner can do.
+func SetRole(db *gorm.DB, ownerID, communityID uint, username string, role models.CommunityRole) error {
+	if role != models.RoleModerator && role != models.RoleMember {
+		return ErrInvalidRole
+	}
+	community, err := GetCommunity(db, communityID)
+	if err != nil {
+		return err
+	}
+	if community.OwnerID != ownerID {
+		return ErrNotOwner
+	}
+
+	result := db.Model(&models.CommunityMember{}).
+		Where("community_id = ? AND role <> ?", communityID, models.RoleOwner).
+		Where("user_id = (?)", db.Model(&models.User{}).Select("id").Where("username = ?", username)).
+		Update("role", role)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrNoMember
+	}
+	return nil
+}
+
+// GetTimeline returns a page of the posts of a community newer than since. Replies are left out and shown
+// under the posts they answer.
+func GetTimeline(db *gorm.DB, viewerID, communityID uint, limit int, cursor uint,
+	since timeline.Since) ([]models.Post, uint, error) {
+	if _, err := GetCommunity(db, communityID); err != nil {
+		return nil, 0, err
+	}
+
+	query := db.Scopes(models.WithPostRelations, models.WithoutBlocked(viewerID), models.WithoutMuted(viewerID),
+		since.Scope).
+		Where("community_id = ? AND kind <> ?", communityID, models.KindReply)
+	return timeline.Page(query, limit, cursor)
+}
+
+func requireModerator(db *gorm.DB, userID, communityID uint) error {
+	if _, err := GetCommunity(db, communityID); err != nil {
+		return err
+	}
+	canModerate, err := CanModerate(db, userID, communityID)
+	if err != nil {
+		return err
+	}
+	if !canModerate {
+		return ErrNotModerator
+	}
+	return nil
+}
+
+// normalizeRules trims the rules and numbers them in the given order.
+func normalizeRules(rules []models.CommunityRule) ([]models.CommunityRule, error) {
+	if len(rules) > constants.MaxCommunityRules {
+		return nil, ErrInvalidRules
+	}
+
+	normalized := make([]models.CommunityRule, len(rules))
+	for i, rule := range rules {
+		title, description := strings.TrimSpace(rule.Title), strings.TrimSpace(rule.Description)
+		if title == constants.Empty ||
+			utf8.RuneCountInString(title) > constants.MaxCommunityRuleTitleLength ||
+			utf8.RuneCountInString(description) > constants.MaxCommunityRuleDescriptionLength {
+			return nil, ErrInvalidRules
+		}
+		normalized[i] = models.CommunityRule{Position: i + 1, Title: title, Description: description}
+	}
+	return normalized, nil
+}
+
+func replaceRules(tx *gorm.DB, communityID uint, rules []models.CommunityRule) error {
+	if len(rules) == 0 {
+		return nil
+	}
+	for i := range rules {
+		rules[i].CommunityID = communityID
+	}
+	return tx.Create(&rules).Error
+}
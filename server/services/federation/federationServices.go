@@ -0,0 +1,1308 @@
+package federation
+
+import (
+	"bytes"
+	"crypto/rsa"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"html"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"x-clone/server/constants"
+	"x-clone/server/models"
+	"x-clone/server/services/block"
+	"x-clone/server/services/feed"
+	"x-clone/server/services/httpsig"
+	"x-clone/server/services/unfurl"
+	"x-clone/server/services/user"
+)
+
+var (
+	ErrDisabled      = errors.New("federation is disabled")
+	ErrNoActor       = errors.New("no actor found")
+	ErrNoObject      = errors.New("no object found")
+	ErrActorMismatch = errors.New("activity actor does not match its signature")
+	ErrInvalidHandle = errors.New("remote accounts are written user@domain")
+	ErrRemoteFetch   = errors.New("could not fetch the remote document")
+)
+
+// ContentType is the media type of the documents served to and sent to other servers.
+const ContentType = "application/activity+json"
+
+const (
+	activityStreamsContext = "https://www.w3.org/ns/activitystreams"
+	securityContext        = "https://w3id.org/security/v1"
+	publicAddress          = "https://www.w3.org/ns/activitystreams#Public"
+	ldContentType          = `application/ld+json; profile="https://www.w3.org/ns/activitystreams"`
+)
+
+// httpClient refuses to reach loopback and private addresses, unless FEDERATION_ALLOW_PRIVATE_NETWORKS is set for
+// a local setup. It is built on first use, once the environment is loaded.
+var (
+	httpClient     *http.Client
+	httpClientOnce sync.Once
+)
+
+func remoteClient() *http.Client {
+	httpClientOnce.Do(func() {
+		if httpClient == nil {
+			httpClient = &http.Client{
+				Timeout:   constants.FederationHTTPTimeout,
+				Transport: unfurl.NewTransport(os.Getenv("FEDERATION_ALLOW_PRIVATE_NETWORKS") == "true"),
+			}
+		}
+	})
+	return httpClient
+}
+
+// BaseURL is the public address of this server for other servers, FEDERATION_URL. Federation is disabled when
+// it is not set.
+func BaseURL() string {
+	return strings.TrimRight(os.Getenv("FEDERATION_URL"), "/")
+}
+
+func Enabled() bool {
+	return BaseURL() != constants.Empty
+}
+
+// Domain is the host of BaseURL, which local accounts are known by: user@domain.
+func Domain() string {
+	parsed, err := url.Parse(BaseURL())
+	if err != nil {
+		return constants.Empty
+	}
+	return parsed.Host
+}
+
+// Actor IDs use user IDs rather than usernames, since usernames can change.
+func ActorURI(userID uint) string {
+	return fmt.Sprintf("%s%s/users/%d", BaseURL(), constants.InitialURLFederation, userID)
+}
+
+func PostURI(postID uint) string {
+	return fmt.Sprintf("%s%s/posts/%d", BaseURL(), constants.InitialURLFederation, postID)
+}
+
+func SharedInboxURI() string {
+	return BaseURL() + constants.InitialURLFederation + "/inbox"
+}
+
+// Documents.
+
+type PublicKey struct {
+	ID           string `json:"id"`
+	Owner        string `json:"owner"`
+	PublicKeyPEM string `json:"publicKeyPem"`
+}
+
+type Endpoints struct {
+	SharedInbox string `json:"sharedInbox,omitempty"`
+}
+
+type Actor struct {
+	Context           []string  `json:"@context,omitempty"`
+	ID                string    `json:"id"`
+	Type              string    `json:"type"`
+	PreferredUsername string    `json:"preferredUsername"`
+	Name              string    `json:"name"`
+	Summary           string    `json:"summary"`
+	URL               string    `json:"url,omitempty"`
+	Inbox             string    `json:"inbox"`
+	Outbox            string    `json:"outbox,omitempty"`
+	Followers         string    `json:"followers,omitempty"`
+	Endpoints         Endpoints `json:"endpoints"`
+	PublicKey         PublicKey `json:"publicKey"`
+	Published         string    `json:"published,omitempty"`
+}
+
+type Tag struct {
+	Type string `json:"type"`
+	Href string `json:"href,omitempty"`
+	Name string `json:"name,omitempty"`
+}
+
+type Note struct {
+	Context      string   `json:"@context,omitempty"`
+	ID           string   `json:"id"`
+	Type         string   `json:"type"`
+	AttributedTo string   `json:"attributedTo"`
+	Content      string   `json:"content"`
+	Summary      string   `json:"summary,omitempty"`
+	Sensitive    bool     `json:"sensitive"`
+	InReplyTo    *string  `json:"inReplyTo"`
+	QuoteURL     string   `json:"quoteUrl,omitempty"`
+	Published    string   `json:"published"`
+	URL          string   `json:"url,omitempty"`
+	To           []string `json:"to"`
+	Cc           []string `json:"cc"`
+	Tag          []Tag    `json:"tag,omitempty"`
+}
+
+// Activity is any activity, sent or received. Its object is either an ID or an embedded document.
+type Activity struct {
+	Context   string          `json:"@context,omitempty"`
+	ID        string          `json:"id"`
+	Type      string          `json:"type"`
+	Actor     string          `json:"actor"`
+	Object    json.RawMessage `json:"object"`
+	To        []string        `json:"to,omitempty"`
+	Cc        []string        `json:"cc,omitempty"`
+	Published string          `json:"published,omitempty"`
+}
+
+// ObjectID returns the ID of the object of the activity, embedded or not.
+func (a Activity) ObjectID() string {
+	var id string
+	if err := json.Unmarshal(a.Object, &id); err == nil {
+		return id
+	}
+	var object struct {
+		ID string `json:"id"`
+	}
+	if err := json.Unmarshal(a.Object, &object); err == nil {
+		return object.ID
+	}
+	return constants.Empty
+}
+
+type Collection struct {
+	Context      string        `json:"@context,omitempty"`
+	ID           string        `json:"id"`
+	Type         string        `json:"type"`
+	TotalItems   int64         `json:"totalItems"`
+	OrderedItems []interface{} `json:"orderedItems,omitempty"`
+}
+
+type WebFingerLink struct {
+	Rel  string `json:"rel"`
+	Type string `json:"type,omitempty"`
+	Href string `json:"href"`
+}
+
+type WebFinger struct {
+	Subject string          `json:"subject"`
+	Aliases []string        `json:"aliases,omitempty"`
+	Links   []WebFingerLink `json:"links"`
+}
+
+// Serving local accounts.
+
+// GetWebFinger resolves acct:user@domain, or the ID of a local actor, to the actor of a local user.
+func GetWebFinger(db *gorm.DB, resource string) (*WebFinger, error) {
+	if !Enabled() {
+		return nil, ErrDisabled
+	}
+
+	var local models.User
+	if userID, ok := localID(resource, ActorURI(0)); ok {
+		u, err := localUser(db, userID)
+		if err != nil {
+			return nil, err
+		}
+		local = *u
+	} else {
+		username, domain, found := strings.Cut(strings.TrimPrefix(resource, "acct:"), "@")
+		if !found || !strings.EqualFold(domain, Domain()) {
+			return nil, ErrNoActor
+		}
+		err := db.Where("username = ? AND is_remote = ?", username, false).First(&local).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrNoActor
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	actor := ActorURI(local.ID)
+	profile := feed.FrontendURL() + "/" + local.Username
+	return &WebFinger{
+		Subject: "acct:" + local.Username + "@" + Domain(),
+		Aliases: []string{actor, profile},
+		Links: []WebFingerLink{
+			{Rel: "self", Type: ContentType, Href: actor},
+			{Rel: "http://webfinger.net/rel/profile-page", Type: "text/html", Href: profile},
+		},
+	}, nil
+}
+
+// GetActor returns the actor document of a local user, creating their key pair on first use.
+func GetActor(db *gorm.DB, userID uint) (*Actor, error) {
+	if !Enabled() {
+		return nil, ErrDisabled
+	}
+	local, err := localUser(db, userID)
+	if err != nil {
+		return nil, err
+	}
+	key, err := actorKey(db, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	id := ActorURI(userID)
+	var summary string
+	if local.Bio != nil {
+		summary = textToHTML(*local.Bio)
+	}
+	return &Actor{
+		Context:           []string{activityStreamsContext, securityContext},
+		ID:                id,
+		Type:              "Person",
+		PreferredUsername: local.Username,
+		Name:              local.Nickname,
+		Summary:           summary,
+		URL:               feed.FrontendURL() + "/" + local.Username,
+		Inbox:             id + "/inbox",
+		Outbox:            id + "/outbox",
+		Followers:         id + "/followers",
+		Endpoints:         Endpoints{SharedInbox: SharedInboxURI()},
+		PublicKey:         PublicKey{ID: id + "#main-key", Owner: id, PublicKeyPEM: key.PublicKeyPEM},
+		Published:         local.CreatedAt.UTC().Format(time.RFC3339),
+	}, nil
+}
+
+// GetOutbox returns the latest FederationOutboxSize activities of a local user.
+func GetOutbox(db *gorm.DB, userID uint) (*Collection, error) {
+	if !Enabled() {
+		return nil, ErrDisabled
+	}
+	if _, err := localUser(db, userID); err != nil {
+		return nil, err
+	}
+
+	var total int64
+	if err := db.Model(&models.Post{}).Where("user_id = ?", userID).Count(&total).Error; err != nil {
+		return nil, err
+	}
+	var posts []models.Post
+	if err := db.Scopes(models.WithPostRelations).Where("user_id = ?", userID).
+		Order("id desc").Limit(constants.FederationOutboxSize).Find(&posts).Error; err != nil {
+		return nil, err
+	}
+
+	items := make([]interface{}, 0, len(posts))
+	for _, post := range posts {
+		activity, err := postActivity(db, post)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, activity)
+	}
+	return &Collection{
+		Context:      activityStreamsContext,
+		ID:           ActorURI(userID) + "/outbox",
+		Type:         "OrderedCollection",
+		TotalItems:   total,
+		OrderedItems: items,
+	}, nil
+}
+
+// GetFollowers returns the followers collection of a local user. Only its size is shared.
+func GetFollowers(db *gorm.DB, userID uint) (*Collection, error) {
+	if !Enabled() {
+		return nil, ErrDisabled
+	}
+	local, err := localUser(db, userID)
+	if err != nil {
+		return nil, err
+	}
+	return &Collection{
+		Context:    activityStreamsContext,
+		ID:         ActorURI(userID) + "/followers",
+		Type:       "OrderedCollection",
+		TotalItems: int64(local.FollowerCount),
+	}, nil
+}
+
+// GetNote returns the note of a local post. Reposts have no note of their own.
+func GetNote(db *gorm.DB, postID uint) (*Note, error) {
+	if !Enabled() {
+		return nil, ErrDisabled
+	}
+	var post models.Post
+	err := db.Scopes(models.WithPostRelations).
+		Where("kind <> ? AND activity_uri IS NULL", models.KindRepost).First(&post, postID).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrNoObject
+	}
+	if err != nil {
+		return nil, err
+	}
+	note, err := noteFor(db, post)
+	if err != nil {
+		return nil, err
+	}
+	note.Context = activityStreamsContext
+	return note, nil
+}
+
+// Publishing local changes. These run once the change is saved and only queue deliveries, so failures are
+// logged rather than returned.
+
+// PublishPost sends a new local post to the servers of the followers of its author, and to the author of the
+// post it answers or shares when that one is remote. Reposts are sent as announces.
+func PublishPost(db *gorm.DB, post models.Post) {
+	if !Enabled() {
+		return
+	}
+	if err := publishPost(db, post.ID); err != nil {
+		log.Println("Failed to federate post:", err)
+	}
+}
+
+func publishPost(db *gorm.DB, postID uint) error {
+	var post models.Post
+	if err := db.Scopes(models.WithPostRelations).First(&post, postID).Error; err != nil {
+		return err
+	}
+	if post.ActivityURI != nil {
+		return nil
+	}
+	activity, err := postActivity(db, post)
+	if err != nil {
+		return err
+	}
+
+	inboxes, err := followerInboxes(db, post.UserID)
+	if err != nil {
+		return err
+	}
+	if referenced := post.ReferencedPost(); referenced != nil {
+		if remote, errRemote := remoteActorOf(db, referenced.UserID); errRemote == nil {
+			inboxes = append(inboxes, remote.Inbox)
+		}
+	}
+	return enqueue(db, post.UserID, activity, inboxes)
+}
+
+// PublishDeletion tells the servers that received a local post that it was removed. Removing a repost undoes
+// its announce.
+func PublishDeletion(db *gorm.DB, post models.Post) {
+	if !Enabled() || post.ActivityURI != nil {
+		return
+	}
+	inboxes, err := followerInboxes(db, post.UserID)
+	if err != nil {
+		log.Println("Failed to federate post deletion:", err)
+		return
+	}
+
+	actor := ActorURI(post.UserID)
+	activity := Activity{
+		Context: activityStreamsContext,
+		ID:      PostURI(post.ID) + "#delete",
+		Type:    "Delete",
+		Actor:   actor,
+		Object:  mustMarshal(map[string]string{"id": PostURI(post.ID), "type": "Tombstone"}),
+		To:      []string{publicAddress},
+	}
+	if post.Kind == models.KindRepost {
+		announce := Activity{ID: PostURI(post.ID) + "/activity", Type: "Announce", Actor: actor}
+		if post.QuotedPostID != nil {
+			announce.Object = mustMarshal(objectURI(db, *post.QuotedPostID))
+		}
+		activity.ID = PostURI(post.ID) + "#undo"
+		activity.Type = "Undo"
+		activity.Object = mustMarshal(announce)
+	}
+	if err := enqueue(db, post.UserID, activity, inboxes); err != nil {
+		log.Println("Failed to federate post deletion:", err)
+	}
+}
+
+// PublishLike tells the server of a remote post that a local user liked it, or no longer does.
+func PublishLike(db *gorm.DB, userID, postID uint, liked bool) {
+	if !Enabled() {
+		return
+	}
+	var post models.Post
+	if err := db.Select("id", "user_id", "activity_uri").First(&post, postID).Error; err != nil ||
+		post.ActivityURI == nil {
+		return
+	}
+	remote, err := remoteActorOf(db, post.UserID)
+	if err != nil {
+		return
+	}
+
+	actor := ActorURI(userID)
+	like := Activity{
+		Context: activityStreamsContext,
+		ID:      fmt.Sprintf("%s#likes/%d", actor, postID),
+		Type:    "Like",
+		Actor:   actor,
+		Object:  mustMarshal(*post.ActivityURI),
+	}
+	activity := like
+	if !liked {
+		like.Context = constants.Empty
+		activity = Activity{Context: activityStreamsContext, ID: like.ID + "/undo", Type: "Undo", Actor: actor,
+			Object: mustMarshal(like)}
+	}
+	if err := enqueue(db, userID, activity, []string{remote.Inbox}); err != nil {
+		log.Println("Failed to federate like:", err)
+	}
+}
+
+// PublishFollow tells a remote account that a local user followed it, or unfollowed it.
+func PublishFollow(db *gorm.DB, followerUsername, followedUsername string, following bool) {
+	if !Enabled() {
+		return
+	}
+	var follower, followed models.User
+	if err := db.Where("username = ? AND is_remote = ?", followerUsername, false).First(&follower).Error; err != nil {
+		return
+	}
+	if err := db.Where("username = ? AND is_remote = ?", followedUsername, true).First(&followed).Error; err != nil {
+		return
+	}
+	remote, err := remoteActorOf(db, followed.ID)
+	if err != nil {
+		return
+	}
+
+	actor := ActorURI(follower.ID)
+	follow := Activity{
+		Context: activityStreamsContext,
+		ID:      fmt.Sprintf("%s#follows/%d", actor, followed.ID),
+		Type:    "Follow",
+		Actor:   actor,
+		Object:  mustMarshal(remote.ActorURI),
+	}
+	activity := follow
+	if !following {
+		follow.Context = constants.Empty
+		activity = Activity{Context: activityStreamsContext, ID: follow.ID + "/undo", Type: "Undo", Actor: actor,
+			Object: mustMarshal(follow)}
+	}
+	if err := enqueue(db, follower.ID, activity, []string{remote.Inbox}); err != nil {
+		log.Println("Failed to federate follow:", err)
+	}
+}
+
+// ResolveRemoteUser finds the user mirroring a remote account known as user@domain, looking it up through
+// WebFinger the first time.
+func ResolveRemoteUser(db *gorm.DB, handle string) (*models.User, error) {
+	if !Enabled() {
+		return nil, ErrDisabled
+	}
+	handle = strings.TrimPrefix(handle, "@")
+	username, domain, found := strings.Cut(handle, "@")
+	if !found || username == constants.Empty || domain == constants.Empty || strings.EqualFold(domain, Domain()) {
+		return nil, ErrInvalidHandle
+	}
+
+	var existing models.User
+	err := db.Where("username = ? AND is_remote = ?", handle, true).First(&existing).Error
+	if err == nil {
+		return &existing, nil
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, err
+	}
+
+	var finger WebFinger
+	fingerURL := fmt.Sprintf("%s://%s%s?resource=%s", remoteScheme(), domain, constants.WebFingerPath,
+		url.QueryEscape("acct:"+handle))
+	if err := fetch(fingerURL, "application/jrd+json", &finger); err != nil {
+		return nil, err
+	}
+	for _, link := range finger.Links {
+		if link.Rel == "self" && strings.HasPrefix(link.Type, "application/") {
+			_, remoteUser, err := refreshRemoteActor(db, link.Href)
+			return remoteUser, err
+		}
+	}
+	return nil, ErrNoActor
+}
+
+// Receiving activities.
+
+// HandleInbox checks the signature of an inbox request and applies its activity. Activities that do not
+// concern this server are accepted and ignored.
+func HandleInbox(db *gorm.DB, req *http.Request, body []byte) error {
+	if !Enabled() {
+		return ErrDisabled
+	}
+	signature, err := httpsig.Parse(req)
+	if err != nil {
+		return err
+	}
+	if err := signature.Check(req, body); err != nil {
+		return err
+	}
+
+	// The key is fetched when it is not known yet, or when it may have been rotated since it was stored
+	remote, err := remoteActorForKey(db, signature.KeyID)
+	if err != nil {
+		return err
+	}
+	if remote == nil || verify(signature, req, body, remote.PublicKeyPEM) != nil {
+		if remote, err = verifyWithFetchedKey(db, signature, req, body); err != nil {
+			return err
+		}
+	}
+
+	var activity Activity
+	if err := json.Unmarshal(body, &activity); err != nil {
+		return err
+	}
+	if activity.Actor != remote.ActorURI {
+		return ErrActorMismatch
+	}
+
+	var shadow models.User
+	if err := db.First(&shadow, remote.UserID).Error; err != nil {
+		return err
+	}
+	return applyActivity(db, remote, shadow, activity)
+}
+
+func verify(signature *httpsig.Signature, req *http.Request, body []byte, publicKeyPEM string) error {
+	key, err := httpsig.ParsePublicKey(publicKeyPEM)
+	if err != nil {
+		return err
+	}
+	return signature.Verify(req, body, key)
+}
+
+// verifyWithFetchedKey fetches the actor owning the key of a request, and only stores it once the signature of
+// the request is verified with the fetched key. A key that failed is not fetched again before
+// FederationKeyRefetchInterval, so that forged requests cannot make this server fetch the same URL over and over.
+func verifyWithFetchedKey(db *gorm.DB, signature *httpsig.Signature, req *http.Request,
+	body []byte) (*models.RemoteActor, error) {
+	if !keyRefetches.allow(signature.KeyID, time.Now()) {
+		return nil, httpsig.ErrInvalidSignature
+	}
+
+	actorURI, _, _ := strings.Cut(signature.KeyID, "#")
+	actor, err := fetchRemoteActor(actorURI)
+	if err == nil && actor.PublicKey.ID != signature.KeyID {
+		err = httpsig.ErrInvalidSignature
+	}
+	if err == nil {
+		err = verify(signature, req, body, actor.PublicKey.PublicKeyPEM)
+	}
+	if err != nil {
+		keyRefetches.fail(signature.KeyID, time.Now())
+		return nil, err
+	}
+
+	remote, _, err := storeRemoteActor(db, actor)
+	return remote, err
+}
+
+// refetchLimiter remembers when the keys that failed to verify a request were fetched.
+type refetchLimiter struct {
+	mu     sync.Mutex
+	failed map[string]time.Time
+}
+
+var keyRefetches = &refetchLimiter{failed: make(map[string]time.Time)}
+
+func (l *refetchLimiter) allow(keyID string, now time.Time) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	failedAt, found := l.failed[keyID]
+	return !found || now.Sub(failedAt) >= constants.FederationKeyRefetchInterval
+}
+
+func (l *refetchLimiter) fail(keyID string, now time.Time) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if len(l.failed) >= constants.FederationKeyRefetchMaxKeys {
+		for key, failedAt := range l.failed {
+			if now.Sub(failedAt) >= constants.FederationKeyRefetchInterval {
+				delete(l.failed, key)
+			}
+		}
+	}
+	// Forgetting every key bounds the memory used when more keys than that failed within the interval
+	if len(l.failed) >= constants.FederationKeyRefetchMaxKeys {
+		l.failed = make(map[string]time.Time)
+	}
+	l.failed[keyID] = now
+}
+
+func applyActivity(db *gorm.DB, remote *models.RemoteActor, shadow models.User, activity Activity) error {
+	switch activity.Type {
+	case "Follow":
+		return acceptFollow(db, shadow, activity)
+	case "Undo":
+		return undo(db, shadow, activity)
+	case "Create":
+		var note Note
+		if err := json.Unmarshal(activity.Object, &note); err != nil || note.Type != "Note" {
+			return nil
+		}
+		return createRemotePost(db, remote, shadow, note)
+	case "Delete":
+		return deleteRemotePost(db, shadow, activity.ObjectID())
+	case "Like":
+		if postID, ok := localID(activity.ObjectID(), PostURI(0)); ok {
+			return ignoreMissing(user.LikePost(db, shadow.ID, postID))
+		}
+	case "Announce":
+		if postID, ok := localID(activity.ObjectID(), PostURI(0)); ok {
+			_, _, err := user.Repost(db, shadow.ID, shadow.Nickname, shadow.Username, postID)
+			return ignoreMissing(err)
+		}
+	case "Reject":
+		var follow Activity
+		if err := json.Unmarshal(activity.Object, &follow); err == nil && follow.Type == "Follow" {
+			if followerID, ok := localID(follow.Actor, ActorURI(0)); ok {
+				return rejectFollow(db, followerID, shadow)
+			}
+		}
+	case "Update":
+		if activity.ObjectID() == remote.ActorURI {
+			_, _, err := refreshRemoteActor(db, remote.ActorURI)
+			return err
+		}
+	}
+	return nil
+}
+
+// acceptFollow lets a remote account follow a local user, unless either blocked the other, and answers with
+// an Accept or a Reject.
+func acceptFollow(db *gorm.DB, shadow models.User, follow Activity) error {
+	followedID, ok := localID(follow.ObjectID(), ActorURI(0))
+	if !ok {
+		return nil
+	}
+	followed, err := localUser(db, followedID)
+	if err != nil {
+		return err
+	}
+
+	answer := "Accept"
+	blocked, err := block.IsBlocked(db, followed.ID, shadow.ID)
+	if err != nil {
+		return err
+	}
+	if blocked {
+		answer = "Reject"
+	} else if err := addFollow(db, shadow.Username, followed.Username); err != nil {
+		return err
+	}
+
+	follow.Context = constants.Empty
+	actor := ActorURI(followed.ID)
+	activity := Activity{
+		Context: activityStreamsContext,
+		ID:      fmt.Sprintf("%s#%s/%d/%d", actor, strings.ToLower(answer), shadow.ID, time.Now().Unix()),
+		Type:    answer,
+		Actor:   actor,
+		Object:  mustMarshal(follow),
+	}
+	remote, err := remoteActorOf(db, shadow.ID)
+	if err != nil {
+		return err
+	}
+	return enqueue(db, followed.ID, activity, []string{remote.Inbox})
+}
+
+func undo(db *gorm.DB, shadow models.User, activity Activity) error {
+	var undone Activity
+	if err := json.Unmarshal(activity.Object, &undone); err != nil {
+		return nil
+	}
+	switch undone.Type {
+	case "Follow":
+		if followedID, ok := localID(undone.ObjectID(), ActorURI(0)); ok {
+			followed, err := localUser(db, followedID)
+			if err != nil {
+				return ignoreMissing(err)
+			}
+			return removeFollow(db, shadow.Username, followed.Username)
+		}
+	case "Like":
+		if postID, ok := localID(undone.ObjectID(), PostURI(0)); ok {
+			return user.UnlikePost(db, shadow.ID, postID)
+		}
+	case "Announce":
+		if postID, ok := localID(undone.ObjectID(), PostURI(0)); ok {
+			_, err := user.Unrepost(db, shadow.ID, postID)
+			return err
+		}
+	}
+	return nil
+}
+
+func rejectFollow(db *gorm.DB, followerID uint, shadow models.User) error {
+	follower, err := localUser(db, followerID)
+	if err != nil {
+		return ignoreMissing(err)
+	}
+	return removeFollow(db, follower.Username, shadow.Username)
+}
+
+// createRemotePost stores a remote note as a post of the user mirroring its author. Only the notes that
+// concern local users are kept: the ones of followed accounts, and the replies to or mentions of local users.
+// Replies outside the reply audience of the post they answer are dropped.
+func createRemotePost(db *gorm.DB, remote *models.RemoteActor, shadow models.User, note Note) error {
+	if note.AttributedTo != remote.ActorURI {
+		return ErrActorMismatch
+	}
+	var replyToID *uint
+	if note.InReplyTo != nil {
+		replyToID = postIDForObject(db, *note.InReplyTo)
+	}
+	relevant, err := concernsLocalUsers(db, shadow, note, replyToID)
+	if err != nil || !relevant {
+		return err
+	}
+
+	body := htmlToText(note.Content)
+	if body == constants.Empty {
+		return nil
+	}
+	var labels []models.ContentLabel
+	if note.Sensitive {
+		labels = append(labels, models.LabelSensitive)
+	}
+	if note.Summary != constants.Empty {
+		labels = append(labels, models.LabelSpoiler)
+	}
+	kind := models.KindOriginal
+	if replyToID != nil {
+		kind = models.KindReply
+	}
+
+	_, err = user.CreateRemotePost(db, shadow.ID, shadow.Nickname, shadow.Username, kind, replyToID, body, labels,
+		note.ID)
+	if errors.Is(err, block.ErrBlocked) || errors.Is(err, user.ErrReplyNotAllowed) ||
+		errors.Is(err, user.ErrPostAlreadyStored) {
+		return nil
+	}
+	return err
+}
+
+func concernsLocalUsers(db *gorm.DB, shadow models.User, note Note, replyToID *uint) (bool, error) {
+	if replyToID != nil {
+		return true, nil
+	}
+	for _, tag := range note.Tag {
+		if _, ok := localID(tag.Href, ActorURI(0)); ok && tag.Type == "Mention" {
+			return true, nil
+		}
+	}
+	var followers int64
+	err := db.Model(&models.Follow{}).Where("followed_username = ?", shadow.Username).Count(&followers).Error
+	return followers > 0, err
+}
+
+func deleteRemotePost(db *gorm.DB, shadow models.User, objectID string) error {
+	var post models.Post
+	err := db.Where("activity_uri = ? AND user_id = ?", objectID, shadow.ID).First(&post).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return user.RemovePost(db, post)
+}
+
+// addFollow and removeFollow keep the follower count in step, like the follow endpoints do.
+func addFollow(db *gorm.DB, followerUsername, followedUsername string) error {
+	// IsFollowing fails when there is no follow, which is the case expected here
+	if following, _ := user.IsFollowing(db, followedUsername, followerUsername); following {
+		return nil
+	}
+	if err := user.FollowAccount(db, followerUsername, followedUsername); err != nil {
+		return err
+	}
+	return db.Model(&models.User{}).Where("username = ?", followedUsername).
+		UpdateColumn("follower_count", gorm.Expr("follower_count + 1")).Error
+}
+
+func removeFollow(db *gorm.DB, followerUsername, followedUsername string) error {
+	if following, _ := user.IsFollowing(db, followedUsername, followerUsername); !following {
+		return nil
+	}
+	if err := user.UnfollowAccount(db, followerUsername, followedUsername); err != nil {
+		return err
+	}
+	return db.Model(&models.User{}).Where("username = ? AND follower_count > 0", followedUsername).
+		UpdateColumn("follower_count", gorm.Expr("follower_count - 1")).Error
+}
+
+// Remote actors.
+
+func remoteActorOf(db *gorm.DB, userID uint) (*models.RemoteActor, error) {
+	var remote models.RemoteActor
+	if err := db.Where("user_id = ?", userID).First(&remote).Error; err != nil {
+		return nil, err
+	}
+	return &remote, nil
+}
+
+// remoteActorForKey finds the stored remote actor owning a key, or nil when the key is not known.
+func remoteActorForKey(db *gorm.DB, keyID string) (*models.RemoteActor, error) {
+	var remote models.RemoteActor
+	err := db.Where("key_id = ?", keyID).First(&remote).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &remote, nil
+}
+
+// refreshRemoteActor fetches a remote actor and stores it.
+func refreshRemoteActor(db *gorm.DB, actorURI string) (*models.RemoteActor, *models.User, error) {
+	actor, err := fetchRemoteActor(actorURI)
+	if err != nil {
+		return nil, nil, err
+	}
+	return storeRemoteActor(db, actor)
+}
+
+// fetchRemoteActor fetches a remote actor without storing anything, checking that it owns its key.
+func fetchRemoteActor(actorURI string) (*Actor, error) {
+	var actor Actor
+	if err := fetch(actorURI, ContentType, &actor); err != nil {
+		return nil, err
+	}
+	if actor.ID != actorURI || actor.PreferredUsername == constants.Empty || actor.Inbox == constants.Empty {
+		return nil, ErrNoActor
+	}
+	if actor.PublicKey.Owner != actor.ID {
+		return nil, httpsig.ErrInvalidSignature
+	}
+	return &actor, nil
+}
+
+// storeRemoteActor stores a fetched actor along with the user mirroring it, named after its preferred username
+// and domain.
+func storeRemoteActor(db *gorm.DB, actor *Actor) (*models.RemoteActor, *models.User, error) {
+	parsed, err := url.Parse(actor.ID)
+	if err != nil {
+		return nil, nil, ErrNoActor
+	}
+
+	nickname := actor.Name
+	if nickname == constants.Empty {
+		nickname = actor.PreferredUsername
+	}
+	bio := htmlToText(actor.Summary)
+
+	var remote models.RemoteActor
+	var shadow models.User
+	errTx := db.Transaction(func(tx *gorm.DB) error {
+		err := tx.Where("actor_uri = ?", actor.ID).First(&remote).Error
+		switch {
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			shadow = models.User{IsRemote: true}
+		case err != nil:
+			return err
+		default:
+			if err := tx.First(&shadow, remote.UserID).Error; err != nil {
+				return err
+			}
+		}
+
+		shadow.Username = actor.PreferredUsername + "@" + parsed.Host
+		shadow.Nickname = nickname
+		shadow.Bio = &bio
+		if err := tx.Save(&shadow).Error; err != nil {
+			return err
+		}
+
+		remote.UserID = shadow.ID
+		remote.ActorURI = actor.ID
+		remote.KeyID = actor.PublicKey.ID
+		remote.PublicKeyPEM = actor.PublicKey.PublicKeyPEM
+		remote.Inbox = actor.Inbox
+		remote.SharedInbox = actor.Endpoints.SharedInbox
+		return tx.Save(&remote).Error
+	})
+	if errTx != nil {
+		return nil, nil, errTx
+	}
+	return &remote, &shadow, nil
+}
+
+// followerInboxes returns the inboxes of the servers following a local user, using shared inboxes so that
+// every server gets an activity once.
+func followerInboxes(db *gorm.DB, userID uint) ([]string, error) {
+	var inboxes []string
+	err := db.Raw(`
+		SELECT DISTINCT COALESCE(NULLIF(remote_actors.shared_inbox, ''), remote_actors.inbox)
+		FROM follows
+		JOIN users followed ON followed.username = follows.followed_username
+		JOIN users followers ON followers.username = follows.following_username
+		JOIN remote_actors ON remote_actors.user_id = followers.id
+		WHERE followed.id = ? AND follows.deleted_at IS NULL`, userID).Scan(&inboxes).Error
+	return inboxes, err
+}
+
+// Local documents.
+
+func localUser(db *gorm.DB, userID uint) (*models.User, error) {
+	var local models.User
+	err := db.Where("is_remote = ?", false).First(&local, userID).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrNoActor
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &local, nil
+}
+
+// actorKey returns the key pair of a local user, creating it on first use.
+func actorKey(db *gorm.DB, userID uint) (*models.ActorKey, error) {
+	var key models.ActorKey
+	err := db.Where("user_id = ?", userID).First(&key).Error
+	if err == nil {
+		return &key, nil
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, err
+	}
+
+	publicPEM, privatePEM, err := httpsig.GenerateKey()
+	if err != nil {
+		return nil, err
+	}
+	key = models.ActorKey{UserID: userID, PublicKeyPEM: publicPEM, PrivateKeyPEM: privatePEM}
+	// Another request may have created the key meanwhile, in which case that one is kept
+	if err := db.Clauses(clause.OnConflict{DoNothing: true}).Create(&key).Error; err != nil {
+		return nil, err
+	}
+	if err := db.Where("user_id = ?", userID).First(&key).Error; err != nil {
+		return nil, err
+	}
+	return &key, nil
+}
+
+// postActivity wraps a local post in the activity announcing it: an Announce for reposts, a Create otherwise.
+func postActivity(db *gorm.DB, post models.Post) (*Activity, error) {
+	actor := ActorURI(post.UserID)
+	if post.Kind == models.KindRepost {
+		activity := &Activity{
+			Context:   activityStreamsContext,
+			ID:        PostURI(post.ID) + "/activity",
+			Type:      "Announce",
+			Actor:     actor,
+			To:        []string{publicAddress},
+			Cc:        []string{actor + "/followers"},
+			Published: post.CreatedAt.UTC().Format(time.RFC3339),
+		}
+		if post.QuotedPostID != nil {
+			activity.Object = mustMarshal(objectURI(db, *post.QuotedPostID))
+		}
+		return activity, nil
+	}
+
+	note, err := noteFor(db, post)
+	if err != nil {
+		return nil, err
+	}
+	return &Activity{
+		Context:   activityStreamsContext,
+		ID:        note.ID + "/activity",
+		Type:      "Create",
+		Actor:     actor,
+		Object:    mustMarshal(note),
+		To:        note.To,
+		Cc:        note.Cc,
+		Published: note.Published,
+	}, nil
+}
+
+// noteFor renders a local post as a note. Quotes link the quoted post in their content, and labeled posts
+// are marked sensitive with their labels as content warning.
+func noteFor(db *gorm.DB, post models.Post) (*Note, error) {
+	var author models.User
+	if err := db.Select("id", "username").First(&author, post.UserID).Error; err != nil {
+		return nil, err
+	}
+
+	actor := ActorURI(post.UserID)
+	note := &Note{
+		ID:           PostURI(post.ID),
+		Type:         "Note",
+		AttributedTo: actor,
+		Content:      textToHTML(post.Body),
+		Published:    post.CreatedAt.UTC().Format(time.RFC3339),
+		URL:          fmt.Sprintf("%s/%s/status/%d", feed.FrontendURL(), author.Username, post.ID),
+		To:           []string{publicAddress},
+		Cc:           []string{actor + "/followers"},
+	}
+	if post.Kind == models.KindReply && post.ReplyToID != nil {
+		inReplyTo := objectURI(db, *post.ReplyToID)
+		note.InReplyTo = &inReplyTo
+		if post.ReplyTo != nil {
+			if remote, err := remoteActorOf(db, post.ReplyTo.UserID); err == nil {
+				note.Cc = append(note.Cc, remote.ActorURI)
+				note.Tag = append(note.Tag, Tag{Type: "Mention", Href: remote.ActorURI, Name: "@" + post.ReplyTo.Username})
+			}
+		}
+	}
+	if post.Kind == models.KindQuote && post.QuotedPostID != nil {
+		note.QuoteURL = objectURI(db, *post.QuotedPostID)
+		note.Content += fmt.Sprintf(`<p>RE: <a href="%s">%s</a></p>`, html.EscapeString(note.QuoteURL),
+			html.EscapeString(note.QuoteURL))
+	}
+	if len(post.Labels) > 0 {
+		names := make([]string, len(post.Labels))
+		for i, label := range post.Labels {
+			names[i] = string(label.Label)
+		}
+		note.Sensitive = true
+		note.Summary = strings.Join(names, ", ")
+	}
+	return note, nil
+}
+
+// objectURI is the ActivityPub ID of a post: the one it was received with, or its local one.
+func objectURI(db *gorm.DB, postID uint) string {
+	var post models.Post
+	if err := db.Select("id", "activity_uri").First(&post, postID).Error; err == nil && post.ActivityURI != nil {
+		return *post.ActivityURI
+	}
+	return PostURI(postID)
+}
+
+// postIDForObject finds the post an ActivityPub ID stands for, local or received.
+func postIDForObject(db *gorm.DB, objectID string) *uint {
+	if postID, ok := localID(objectID, PostURI(0)); ok {
+		var count int64
+		if db.Model(&models.Post{}).Where("id = ?", postID).Count(&count); count > 0 {
+			return &postID
+		}
+		return nil
+	}
+	var post models.Post
+	if err := db.Select("id").Where("activity_uri = ?", objectID).First(&post).Error; err != nil {
+		return nil
+	}
+	return &post.ID
+}
+
+// localID reads the ID at the end of a local URI, given the URI of ID 0 as template.
+func localID(uri, template string) (uint, bool) {
+	prefix := strings.TrimSuffix(template, "0")
+	if !strings.HasPrefix(uri, prefix) {
+		return 0, false
+	}
+	id, err := strconv.ParseUint(strings.TrimPrefix(uri, prefix), 10, 32)
+	if err != nil || id == 0 {
+		return 0, false
+	}
+	return uint(id), true
+}
+
+// Delivery.
+
+func enqueue(db *gorm.DB, senderID uint, activity interface{}, inboxes []string) error {
+	if len(inboxes) == 0 {
+		return nil
+	}
+	payload, err := json.Marshal(activity)
+	if err != nil {
+		return err
+	}
+
+	seen := make(map[string]bool, len(inboxes))
+	deliveries := make([]models.Delivery, 0, len(inboxes))
+	for _, inbox := range inboxes {
+		if inbox == constants.Empty || seen[inbox] {
+			continue
+		}
+		seen[inbox] = true
+		deliveries = append(deliveries, models.Delivery{
+			SenderID:      senderID,
+			Inbox:         inbox,
+			Payload:       string(payload),
+			NextAttemptAt: time.Now(),
+		})
+	}
+	return db.Create(&deliveries).Error
+}
+
+// StartDelivery sends the queued deliveries in the background every DeliveryPollInterval. Failed deliveries
+// are retried with an exponential backoff starting at DeliveryRetryBase, and dropped after DeliveryMaxAttempts
+// attempts or when the remote server refuses them for good.
+func StartDelivery(db *gorm.DB) {
+	go func() {
+		ticker := time.NewTicker(constants.DeliveryPollInterval)
+		defer ticker.Stop()
+		for range ticker.C {
+			if err := deliverDue(db); err != nil {
+				log.Println("Failed to deliver activities:", err)
+			}
+		}
+	}()
+}
+
+func deliverDue(db *gorm.DB) error {
+	// Due deliveries are claimed by pushing their next attempt back, so that several replicas never send the
+	// same one at the same time
+	var due []models.Delivery
+	if err := db.Raw(`
+		UPDATE deliveries SET next_attempt_at = @lease
+		WHERE id IN (
+			SELECT id FROM deliveries WHERE next_attempt_at <= @now
+			ORDER BY id LIMIT @limit FOR UPDATE SKIP LOCKED
+		)
+		RETURNING *`,
+		map[string]interface{}{
+			"now":   time.Now(),
+			"lease": time.Now().Add(constants.DeliveryRetryBase),
+			"limit": constants.DeliveryBatchSize,
+		}).Scan(&due).Error; err != nil {
+		return err
+	}
+
+	for _, delivery := range due {
+		permanent, err := deliver(db, delivery)
+		if err == nil {
+			db.Delete(&delivery)
+			continue
+		}
+
+		delivery.Attempts++
+		if permanent || delivery.Attempts >= constants.DeliveryMaxAttempts {
+			log.Printf("Dropping delivery to %s after %d attempts: %v", delivery.Inbox, delivery.Attempts, err)
+			db.Delete(&delivery)
+			continue
+		}
+		db.Model(&delivery).Updates(map[string]interface{}{
+			"attempts":        delivery.Attempts,
+			"next_attempt_at": time.Now().Add(retryDelay(delivery.Attempts)),
+			"last_error":      err.Error(),
+		})
+	}
+	return nil
+}
+
+// retryDelay is the wait before the next attempt of a delivery that failed the given number of times.
+func retryDelay(attempts int) time.Duration {
+	return constants.DeliveryRetryBase << (attempts - 1)
+}
+
+// deliver posts a delivery to its inbox, signed with the key of its sender. It tells whether a failure is
+// permanent, which is the case for client errors other than timeouts and rate limiting.
+func deliver(db *gorm.DB, delivery models.Delivery) (bool, error) {
+	key, err := actorKey(db, delivery.SenderID)
+	if err != nil {
+		return false, err
+	}
+	privateKey, err := httpsig.ParsePrivateKey(key.PrivateKeyPEM)
+	if err != nil {
+		return true, err
+	}
+	return send(delivery.Inbox, ActorURI(delivery.SenderID)+"#main-key", privateKey, []byte(delivery.Payload))
+}
+
+func send(inbox, keyID string, key *rsa.PrivateKey, body []byte) (bool, error) {
+	req, err := http.NewRequest(http.MethodPost, inbox, bytes.NewReader(body))
+	if err != nil {
+		return true, err
+	}
+	req.Header.Set("Content-Type", ldContentType)
+	req.Header.Set("Accept", ContentType)
+	if err := httpsig.Sign(req, keyID, key, body); err != nil {
+		return false, err
+	}
+
+	resp, err := remoteClient().Do(req)
+	if err != nil {
+		return false, err
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, constants.FederationMaxBodyBytes))
+
+	if resp.StatusCode >= http.StatusOK && resp.StatusCode < http.StatusMultipleChoices {
+		return false, nil
+	}
+	permanent := resp.StatusCode >= http.StatusBadRequest && resp.StatusCode < http.StatusInternalServerError &&
+		resp.StatusCode != http.StatusRequestTimeout && resp.StatusCode != http.StatusTooManyRequests
+	return permanent, fmt.Errorf("inbox answered %s", resp.Status)
+}
+
+// fetch reads a remote JSON document. Only https is used, unless this server itself runs over http, which
+// is the case of local setups talking to a mock remote server.
+func fetch(rawURL, accept string, v interface{}) error {
+	parsed, err := url.Parse(rawURL)
+	if err != nil || parsed.Host == constants.Empty ||
+		(parsed.Scheme != "https" && parsed.Scheme != remoteScheme()) {
+		return ErrRemoteFetch
+	}
+
+	req, err := http.NewRequest(http.MethodGet, rawURL, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", accept)
+	resp, err := remoteClient().Do(req)
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrRemoteFetch, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%w: %s answered %s", ErrRemoteFetch, parsed.Host, resp.Status)
+	}
+	return json.NewDecoder(io.LimitReader(resp.Body, constants.FederationMaxBodyBytes)).Decode(v)
+}
+
+func remoteScheme() string {
+	if strings.HasPrefix(BaseURL(), "http://") {
+		return "http"
+	}
+	return "https"
+}
+
+// HTML.
+
+var (
+	lineBreaks = regexp.MustCompile(`(?i)<br\s*/?>`)
+	paragraphs = regexp.MustCompile(`(?i)</p>\s*<p[^>]*>`)
+	tags       = regexp.MustCompile(`<[^>]*>`)
+)
+
+// htmlToText turns the HTML content of remote notes into the plain text posts are made of.
+func htmlToText(content string) string {
+	content = lineBreaks.ReplaceAllString(content, "\n")
+	content = paragraphs.ReplaceAllString(content, "\n\n")
+	content = tags.ReplaceAllString(content, constants.Empty)
+	return strings.TrimSpace(html.UnescapeString(content))
+}
+
+func textToHTML(text string) string {
+	escaped := strings.ReplaceAll(html.EscapeString(text), "\n", "<br>")
+	return "<p>" + escaped + "</p>"
+}
+
+func ignoreMissing(err error) error {
+	if err != nil && (err.Error() == constants.ErrNoPost || errors.Is(err, ErrNoActor) ||
+		errors.Is(err, block.ErrBlocked)) {
+		return nil
+	}
+	return err
+}
+
+func mustMarshal(v interface{}) json.RawMessage {
+	raw, err := json.Marshal(v)
+	if err != nil {
+		panic(err)
+	}
+	return raw
+}
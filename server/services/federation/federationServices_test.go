@@ -0,0 +1,487 @@
+package federation
+
+import (
+	"bytes"
+	"crypto/rsa"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"gorm.io/gorm"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+	"x-clone/server/constants"
+	"x-clone/server/models"
+	"x-clone/server/services/httpsig"
+	"x-clone/server/services/unfurl"
+	"x-clone/server/testdb"
+)
+
+const testBaseURL = "https://x-clone.example"
+
+// remoteServer is another ActivityPub server, serving one actor and recording the activities its inbox receives.
+type remoteServer struct {
+	*httptest.Server
+	key *rsa.PrivateKey
+
+	mu       sync.Mutex
+	actor    Actor
+	fetches  int
+	received []Activity
+}
+
+func newRemoteServer(t *testing.T) *remoteServer {
+	t.Helper()
+	t.Setenv("FEDERATION_URL", testBaseURL)
+	publicPEM, privatePEM, err := httpsig.GenerateKey()
+	if err != nil {
+		t.Fatalf("GenerateKey() error = %v", err)
+	}
+	key, err := httpsig.ParsePrivateKey(privatePEM)
+	if err != nil {
+		t.Fatalf("ParsePrivateKey() error = %v", err)
+	}
+
+	remote := &remoteServer{key: key}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/users/alice", func(w http.ResponseWriter, _ *http.Request) {
+		remote.mu.Lock()
+		defer remote.mu.Unlock()
+		remote.fetches++
+		w.Header().Set("Content-Type", ContentType)
+		_ = json.NewEncoder(w).Encode(remote.actor)
+	})
+	mux.HandleFunc("/inbox", func(w http.ResponseWriter, req *http.Request) {
+		var activity Activity
+		if err := json.NewDecoder(req.Body).Decode(&activity); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		remote.mu.Lock()
+		defer remote.mu.Unlock()
+		remote.received = append(remote.received, activity)
+		w.WriteHeader(http.StatusAccepted)
+	})
+	remote.Server = httptest.NewTLSServer(mux)
+	t.Cleanup(remote.Close)
+
+	actorURI := remote.URL + "/users/alice"
+	remote.actor = Actor{
+		ID:                actorURI,
+		Type:              "Person",
+		PreferredUsername: "alice",
+		Inbox:             remote.URL + "/inbox",
+		PublicKey:         PublicKey{ID: actorURI + "#main-key", Owner: actorURI, PublicKeyPEM: publicPEM},
+	}
+
+	useClient(t, remote.Client())
+	keyRefetches = &refetchLimiter{failed: make(map[string]time.Time)}
+	return remote
+}
+
+func (r *remoteServer) actorURI() string {
+	return r.URL + "/users/alice"
+}
+
+func (r *remoteServer) fetchCount() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.fetches
+}
+
+// inboxRequest builds a request to the shared inbox, signed with the key of the remote actor.
+func (r *remoteServer) inboxRequest(t *testing.T, activity interface{}) (*http.Request, []byte) {
+	t.Helper()
+	body, err := json.Marshal(activity)
+	if err != nil {
+		t.Fatalf("Marshal() error = %v", err)
+	}
+	req := httptest.NewRequest(http.MethodPost, testBaseURL+constants.InitialURLFederation+"/inbox",
+		bytes.NewReader(body))
+	if err := httpsig.Sign(req, r.actorURI()+"#main-key", r.key, body); err != nil {
+		t.Fatalf("Sign() error = %v", err)
+	}
+	return req, body
+}
+
+func useClient(t *testing.T, client *http.Client) {
+	t.Helper()
+	previous := httpClient
+	httpClient = client
+	t.Cleanup(func() {
+		httpClient = previous
+		httpClientOnce = sync.Once{}
+	})
+}
+
+func TestSendClassifiesInboxAnswers(t *testing.T) {
+	remote := newRemoteServer(t)
+	cases := []struct {
+		status    int
+		failed    bool
+		permanent bool
+	}{
+		{http.StatusOK, false, false},
+		{http.StatusAccepted, false, false},
+		{http.StatusBadRequest, true, true},
+		{http.StatusUnauthorized, true, true},
+		{http.StatusNotFound, true, true},
+		{http.StatusGone, true, true},
+		{http.StatusRequestTimeout, true, false},
+		{http.StatusTooManyRequests, true, false},
+		{http.StatusInternalServerError, true, false},
+		{http.StatusServiceUnavailable, true, false},
+	}
+
+	for _, tc := range cases {
+		inbox := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			signature, err := httpsig.Parse(req)
+			if err != nil || signature.Verify(req, []byte(`{}`), &remote.key.PublicKey) != nil {
+				t.Errorf("status %d: inbox received a request without a valid signature", tc.status)
+			}
+			w.WriteHeader(tc.status)
+		}))
+		useClient(t, inbox.Client())
+
+		permanent, err := send(inbox.URL+"/inbox", remote.actorURI()+"#main-key", remote.key, []byte(`{}`))
+		inbox.Close()
+		if (err != nil) != tc.failed || permanent != tc.permanent {
+			t.Errorf("status %d: send() = (%v, %v), want failed %v and permanent %v",
+				tc.status, permanent, err, tc.failed, tc.permanent)
+		}
+	}
+}
+
+func TestSendRetriesUnreachableInboxes(t *testing.T) {
+	remote := newRemoteServer(t)
+	inbox := httptest.NewTLSServer(http.NotFoundHandler())
+	useClient(t, inbox.Client())
+	inbox.Close()
+
+	permanent, err := send(inbox.URL+"/inbox", remote.actorURI()+"#main-key", remote.key, []byte(`{}`))
+	if err == nil || permanent {
+		t.Errorf("send() to a closed server = (%v, %v), want a failure to retry", permanent, err)
+	}
+}
+
+func TestRetryDelayDoubles(t *testing.T) {
+	for attempts, want := range map[int]time.Duration{
+		1:                                 constants.DeliveryRetryBase,
+		2:                                 2 * constants.DeliveryRetryBase,
+		3:                                 4 * constants.DeliveryRetryBase,
+		constants.DeliveryMaxAttempts - 1: constants.DeliveryRetryBase << (constants.DeliveryMaxAttempts - 2),
+	} {
+		if got := retryDelay(attempts); got != want {
+			t.Errorf("retryDelay(%d) = %s, want %s", attempts, got, want)
+		}
+	}
+}
+
+func TestFetchRemoteActorChecksIdentity(t *testing.T) {
+	remote := newRemoteServer(t)
+	valid := remote.actor
+	cases := []struct {
+		name   string
+		change func(actor *Actor)
+		want   error
+	}{
+		{"another ID", func(actor *Actor) { actor.ID = remote.URL + "/users/mallory" }, ErrNoActor},
+		{"no inbox", func(actor *Actor) { actor.Inbox = constants.Empty }, ErrNoActor},
+		{"no username", func(actor *Actor) { actor.PreferredUsername = constants.Empty }, ErrNoActor},
+		{"key of another actor", func(actor *Actor) { actor.PublicKey.Owner = remote.URL + "/users/mallory" },
+			httpsig.ErrInvalidSignature},
+	}
+
+	for _, tc := range cases {
+		actor := valid
+		tc.change(&actor)
+		remote.mu.Lock()
+		remote.actor = actor
+		remote.mu.Unlock()
+		if _, err := fetchRemoteActor(remote.actorURI()); !errors.Is(err, tc.want) {
+			t.Errorf("%s: fetchRemoteActor() error = %v, want %v", tc.name, err, tc.want)
+		}
+	}
+
+	remote.actor = valid
+	actor, err := fetchRemoteActor(remote.actorURI())
+	if err != nil {
+		t.Fatalf("fetchRemoteActor() error = %v", err)
+	}
+	if actor.PublicKey.ID != remote.actorURI()+"#main-key" {
+		t.Errorf("PublicKey.ID = %q, want the key of the actor", actor.PublicKey.ID)
+	}
+}
+
+func TestFetchRefusesPrivateAddresses(t *testing.T) {
+	t.Setenv("FEDERATION_ALLOW_PRIVATE_NETWORKS", constants.Empty)
+	var requests int
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		requests++
+	}))
+	defer server.Close()
+	useClient(t, nil)
+	httpClientOnce = sync.Once{}
+
+	var actor Actor
+	if err := fetch(server.URL+"/users/alice", ContentType, &actor); !errors.Is(err, unfurl.ErrBlockedAddress) {
+		t.Errorf("fetch() of a loopback address error = %v, want ErrBlockedAddress", err)
+	}
+	if requests != 0 {
+		t.Errorf("the loopback server received %d requests, want none", requests)
+	}
+}
+
+func TestVerifyWithFetchedKeyRejectsKeysOfOtherActors(t *testing.T) {
+	remote := newRemoteServer(t)
+	remote.actor.PublicKey.ID = remote.actorURI() + "#other-key"
+	req, body := remote.inboxRequest(t, Activity{Type: "Follow", Actor: remote.actorURI()})
+	signature, err := httpsig.Parse(req)
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+
+	// Nothing is stored on failure, which the nil database would make panic
+	for range 2 {
+		if _, err := verifyWithFetchedKey(nil, signature, req, body); !errors.Is(err, httpsig.ErrInvalidSignature) {
+			t.Errorf("verifyWithFetchedKey() error = %v, want ErrInvalidSignature", err)
+		}
+	}
+	if remote.fetchCount() != 1 {
+		t.Errorf("the actor was fetched %d times, want once within the refetch interval", remote.fetchCount())
+	}
+}
+
+func TestVerifyWithFetchedKeyRejectsForgedRequests(t *testing.T) {
+	remote := newRemoteServer(t)
+	_, forgerPEM, err := httpsig.GenerateKey()
+	if err != nil {
+		t.Fatalf("GenerateKey() error = %v", err)
+	}
+	forger, err := httpsig.ParsePrivateKey(forgerPEM)
+	if err != nil {
+		t.Fatalf("ParsePrivateKey() error = %v", err)
+	}
+
+	body := []byte(`{"type":"Delete"}`)
+	req := httptest.NewRequest(http.MethodPost, testBaseURL+"/ap/inbox", bytes.NewReader(body))
+	if err := httpsig.Sign(req, remote.actorURI()+"#main-key", forger, body); err != nil {
+		t.Fatalf("Sign() error = %v", err)
+	}
+	signature, err := httpsig.Parse(req)
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+
+	for range 3 {
+		if _, err := verifyWithFetchedKey(nil, signature, req, body); !errors.Is(err, httpsig.ErrInvalidSignature) {
+			t.Errorf("verifyWithFetchedKey() error = %v, want ErrInvalidSignature", err)
+		}
+	}
+	if remote.fetchCount() != 1 {
+		t.Errorf("the actor was fetched %d times, want once within the refetch interval", remote.fetchCount())
+	}
+
+	keyRefetches.failed[signature.KeyID] = time.Now().Add(-constants.FederationKeyRefetchInterval)
+	_, _ = verifyWithFetchedKey(nil, signature, req, body)
+	if remote.fetchCount() != 2 {
+		t.Errorf("the actor was fetched %d times, want again after the refetch interval", remote.fetchCount())
+	}
+}
+
+func TestRefetchLimiterStaysBounded(t *testing.T) {
+	limiter := &refetchLimiter{failed: make(map[string]time.Time)}
+	now := time.Now()
+	for i := range constants.FederationKeyRefetchMaxKeys + 1 {
+		limiter.fail(fmt.Sprintf("https://remote.example/users/%d#main-key", i), now)
+	}
+	if len(limiter.failed) > constants.FederationKeyRefetchMaxKeys {
+		t.Errorf("the limiter holds %d keys, want at most %d", len(limiter.failed),
+			constants.FederationKeyRefetchMaxKeys)
+	}
+	last := fmt.Sprintf("https://remote.example/users/%d#main-key", constants.FederationKeyRefetchMaxKeys)
+	if limiter.allow(last, now) {
+		t.Error("the last failed key may be fetched again right away")
+	}
+	if !limiter.allow(last, now.Add(constants.FederationKeyRefetchInterval)) {
+		t.Error("the last failed key may not be fetched again after the interval")
+	}
+}
+
+func TestHandleInboxChecksSignaturesBeforeFetching(t *testing.T) {
+	remote := newRemoteServer(t)
+	req, _ := remote.inboxRequest(t, Activity{Type: "Follow", Actor: remote.actorURI()})
+
+	// The nil database shows that nothing is looked up either
+	if err := HandleInbox(nil, req, []byte(`{"type":"Delete"}`)); !errors.Is(err, httpsig.ErrInvalidSignature) {
+		t.Errorf("HandleInbox() of a tampered body error = %v, want ErrInvalidSignature", err)
+	}
+	if remote.fetchCount() != 0 {
+		t.Errorf("the actor was fetched %d times, want never", remote.fetchCount())
+	}
+}
+
+// The tests below need the database of testdb.
+
+func handle(t *testing.T, db *gorm.DB, remote *remoteServer, activity interface{}) error {
+	t.Helper()
+	req, body := remote.inboxRequest(t, activity)
+	return HandleInbox(db, req, body)
+}
+
+func TestInboxFollowIsAcceptedAndUndone(t *testing.T) {
+	db := testdb.Open(t)
+	remote := newRemoteServer(t)
+	bob := testdb.CreateUser(t, db, "bob")
+
+	follow := Activity{
+		ID:     remote.actorURI() + "#follows/1",
+		Type:   "Follow",
+		Actor:  remote.actorURI(),
+		Object: mustMarshal(ActorURI(bob.ID)),
+	}
+	if err := handle(t, db, remote, follow); err != nil {
+		t.Fatalf("HandleInbox(Follow) error = %v", err)
+	}
+
+	var stored models.RemoteActor
+	if err := db.Where("actor_uri = ?", remote.actorURI()).First(&stored).Error; err != nil {
+		t.Fatalf("the remote actor was not stored: %v", err)
+	}
+	var shadow models.User
+	if err := db.First(&shadow, stored.UserID).Error; err != nil {
+		t.Fatalf("the user mirroring the remote actor was not stored: %v", err)
+	}
+	var follows int64
+	db.Model(&models.Follow{}).Where("following_username = ? AND followed_username = ?", shadow.Username, "bob").
+		Count(&follows)
+	if follows != 1 {
+		t.Errorf("%d follows of bob by %s, want 1", follows, shadow.Username)
+	}
+
+	if err := deliverDue(db); err != nil {
+		t.Fatalf("deliverDue() error = %v", err)
+	}
+	remote.mu.Lock()
+	received := remote.received
+	remote.mu.Unlock()
+	if len(received) != 1 || received[0].Type != "Accept" || received[0].Actor != ActorURI(bob.ID) {
+		t.Fatalf("the remote inbox received %+v, want one Accept from bob", received)
+	}
+	var accepted Activity
+	if err := json.Unmarshal(received[0].Object, &accepted); err != nil || accepted.ID != follow.ID {
+		t.Errorf("the Accept is about %s, want the follow %s", received[0].Object, follow.ID)
+	}
+
+	follow.Context = constants.Empty
+	undo := Activity{
+		ID:     remote.actorURI() + "#follows/1/undo",
+		Type:   "Undo",
+		Actor:  remote.actorURI(),
+		Object: mustMarshal(follow),
+	}
+	if err := handle(t, db, remote, undo); err != nil {
+		t.Fatalf("HandleInbox(Undo) error = %v", err)
+	}
+	db.Model(&models.Follow{}).Where("following_username = ? AND followed_username = ?", shadow.Username, "bob").
+		Count(&follows)
+	if follows != 0 {
+		t.Errorf("%d follows of bob by %s after the Undo, want none", follows, shadow.Username)
+	}
+}
+
+func TestInboxCreateAndDeleteNote(t *testing.T) {
+	db := testdb.Open(t)
+	remote := newRemoteServer(t)
+	testdb.CreateUser(t, db, "bob")
+	_, shadow, err := refreshRemoteActor(db, remote.actorURI())
+	if err != nil {
+		t.Fatalf("refreshRemoteActor() error = %v", err)
+	}
+	if err := addFollow(db, "bob", shadow.Username); err != nil {
+		t.Fatalf("addFollow() error = %v", err)
+	}
+
+	note := Note{
+		ID:           remote.URL + "/notes/1",
+		Type:         "Note",
+		AttributedTo: remote.actorURI(),
+		Content:      "<p>Hello from another server</p>",
+	}
+	create := Activity{ID: note.ID + "/activity", Type: "Create", Actor: remote.actorURI(), Object: mustMarshal(note)}
+	// A note delivered twice is stored once
+	for range 2 {
+		if err := handle(t, db, remote, create); err != nil {
+			t.Fatalf("HandleInbox(Create) error = %v", err)
+		}
+	}
+
+	var posts []models.Post
+	db.Where("activity_uri = ?", note.ID).Find(&posts)
+	if len(posts) != 1 || posts[0].UserID != shadow.ID || posts[0].Body != "Hello from another server" {
+		t.Fatalf("stored posts = %+v, want the note once, as a post of %s", posts, shadow.Username)
+	}
+
+	del := Activity{ID: note.ID + "#delete", Type: "Delete", Actor: remote.actorURI(), Object: mustMarshal(note.ID)}
+	if err := handle(t, db, remote, del); err != nil {
+		t.Fatalf("HandleInbox(Delete) error = %v", err)
+	}
+	var remaining int64
+	db.Model(&models.Post{}).Where("activity_uri = ?", note.ID).Count(&remaining)
+	if remaining != 0 {
+		t.Errorf("%d posts left after the Delete, want none", remaining)
+	}
+}
+
+func TestInboxDropsRepliesOutsideTheReplyAudience(t *testing.T) {
+	db := testdb.Open(t)
+	remote := newRemoteServer(t)
+	bob := testdb.CreateUser(t, db, "bob")
+
+	for i, audience := range []models.ReplyAudience{models.ReplyNobody, models.ReplyEveryone} {
+		post := models.Post{UserID: bob.ID, Username: bob.Username, Nickname: bob.Nickname, Kind: models.KindOriginal,
+			Body: "Who replies?", ReplyAudience: audience}
+		if err := db.Create(&post).Error; err != nil {
+			t.Fatalf("failed to create a post: %v", err)
+		}
+		inReplyTo := PostURI(post.ID)
+		note := Note{
+			ID:           fmt.Sprintf("%s/notes/reply-%d", remote.URL, i),
+			Type:         "Note",
+			AttributedTo: remote.actorURI(),
+			InReplyTo:    &inReplyTo,
+			Content:      "<p>Me</p>",
+		}
+		create := Activity{ID: note.ID + "/activity", Type: "Create", Actor: remote.actorURI(),
+			Object: mustMarshal(note)}
+		if err := handle(t, db, remote, create); err != nil {
+			t.Fatalf("HandleInbox(Create) of a reply to a post open to %s error = %v", audience, err)
+		}
+
+		var replies int64
+		db.Model(&models.Post{}).Where("reply_to_id = ?", post.ID).Count(&replies)
+		if want := int64(i); replies != want {
+			t.Errorf("%d replies stored to a post open to %s, want %d", replies, audience, want)
+		}
+	}
+}
+
+func TestInboxRejectsActivitiesOfOtherActors(t *testing.T) {
+	db := testdb.Open(t)
+	remote := newRemoteServer(t)
+	bob := testdb.CreateUser(t, db, "bob")
+	mallory := remote.URL + "/users/mallory"
+
+	follow := Activity{Type: "Follow", Actor: mallory, Object: mustMarshal(ActorURI(bob.ID))}
+	if err := handle(t, db, remote, follow); !errors.Is(err, ErrActorMismatch) {
+		t.Errorf("HandleInbox() of an activity of another actor error = %v, want ErrActorMismatch", err)
+	}
+
+	note := Note{ID: remote.URL + "/notes/2", Type: "Note", AttributedTo: mallory, Content: "Impersonated"}
+	create := Activity{Type: "Create", Actor: remote.actorURI(), Object: mustMarshal(note)}
+	if err := handle(t, db, remote, create); !errors.Is(err, ErrActorMismatch) {
+		t.Errorf("HandleInbox() of a note of another actor error = %v, want ErrActorMismatch", err)
+	}
+}
@@ -0,0 +1,299 @@
+package feed
+
+import (
+	"encoding/xml"
+	"fmt"
+	"gorm.io/gorm"
+	"html"
+	"os"
+	"strings"
+	"time"
+	"unicode/utf8"
+	"x-clone/server/constants"
+	"x-clone/server/models"
+)
+
+// Format is the syndication format of a feed.
+type Format string
+
+const (
+	FormatRSS  Format = "rss"
+	FormatAtom Format = "atom"
+)
+
+// ContentType is the media type a feed of the format is served with.
+func (f Format) ContentType() string {
+	if f == FormatAtom {
+		return "application/atom+xml; charset=utf-8"
+	}
+	return "application/rss+xml; charset=utf-8"
+}
+
+// FrontendURL is where the links of the feeds point to: FRONTEND_URL, or the local client by default.
+func FrontendURL() string {
+	if url := os.Getenv("FRONTEND_URL"); url != constants.Empty {
+		return strings.TrimRight(url, "/")
+	}
+	return constants.DefaultFrontendURL
+}
+
+// item is a post rendered for feed readers, whatever the format.
+type item struct {
+	id        string
+	link      string
+	title     string
+	content   string
+	published time.Time
+	labels    []string
+}
+
+// GetLatestPosts returns the FeedMaxItems latest posts of a user, newest first, which is all a feed shows.
+func GetLatestPosts(db *gorm.DB, authorID uint) ([]models.Post, error) {
+	var posts []models.Post
+	err := db.Scopes(models.WithPostRelations).
+		Where("user_id = ?", authorID).
+		Order("id desc").
+		Limit(constants.FeedMaxItems).
+		Find(&posts).Error
+	if err != nil {
+		return nil, fmt.Errorf("internal server error: %w", err)
+	}
+	return posts, nil
+}
+
+// BuildUserFeed renders the latest posts of a user, newest first, as an RSS or Atom document. selfURL is the
+// address the feed is served at. Only the first FeedMaxItems posts are used.
+func BuildUserFeed(format Format, author models.User, posts []models.Post, selfURL string) ([]byte, error) {
+	if len(posts) > constants.FeedMaxItems {
+		posts = posts[:constants.FeedMaxItems]
+	}
+	baseURL := FrontendURL()
+	items := make([]item, len(posts))
+	for i, post := range posts {
+		items[i] = render(post, baseURL)
+	}
+
+	// An empty feed was last updated when its author joined
+	updated := author.CreatedAt
+	if len(items) > 0 {
+		updated = items[0].published
+	}
+
+	title := fmt.Sprintf("%s (@%s)", author.Nickname, author.Username)
+	profileURL := baseURL + "/" + author.Username
+	description := fmt.Sprintf("Posts by @%s", author.Username)
+	if author.Bio != nil && *author.Bio != constants.Empty {
+		description = *author.Bio
+	}
+
+	var document interface{}
+	if format == FormatAtom {
+		document = atomDocument(author, title, description, profileURL, selfURL, updated, items)
+	} else {
+		document = rssDocument(title, description, profileURL, selfURL, updated, items)
+	}
+
+	body, err := xml.MarshalIndent(document, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte(xml.Header), body...), nil
+}
+
+// render turns a post into a feed item. Replies and quotes carry the text of the post they answer or quote,
+// while reposts show the shared post and link to it. Labeled posts keep their text out of the feed, since
+// feed readers cannot blur it.
+func render(post models.Post, baseURL string) item {
+	it := item{
+		id:        fmt.Sprintf("urn:x-clone:post:%d", post.ID),
+		link:      permalink(baseURL, post.Username, post.ID),
+		title:     headline(post),
+		content:   text(post),
+		published: post.CreatedAt,
+		labels:    labelNames(post.Labels),
+	}
+
+	referenced := post.ReferencedPost()
+	switch {
+	case post.Kind == models.KindRepost && referenced == nil:
+		it.title = fmt.Sprintf("@%s reposted a post that is no longer available", post.Username)
+	case post.Kind == models.KindRepost:
+		it.link = permalink(baseURL, referenced.Username, referenced.ID)
+		it.title = fmt.Sprintf("@%s reposted @%s: %s", post.Username, referenced.Username, headline(*referenced))
+		it.content = text(*referenced)
+		it.labels = labelNames(referenced.Labels)
+	case post.Kind == models.KindReply && referenced != nil:
+		it.title = fmt.Sprintf("Replying to @%s: %s", referenced.Username, it.title)
+		it.content += fmt.Sprintf("\n\nIn reply to @%s: %s", referenced.Username, text(*referenced))
+	case post.Kind == models.KindQuote && referenced != nil:
+		it.content += fmt.Sprintf("\n\nQuoting @%s: %s", referenced.Username, text(*referenced))
+	}
+	return it
+}
+
+func permalink(baseURL, username string, postID uint) string {
+	return fmt.Sprintf("%s/%s/status/%d", baseURL, username, postID)
+}
+
+func text(post models.Post) string {
+	if len(post.Labels) > 0 {
+		return fmt.Sprintf("Content warning (%s): open the post to see it.",
+			strings.Join(labelNames(post.Labels), ", "))
+	}
+	return post.Body
+}
+
+// headline is the text of a post cut to FeedTitleLength characters, on one line.
+func headline(post models.Post) string {
+	title := strings.Join(strings.Fields(text(post)), " ")
+	if utf8.RuneCountInString(title) <= constants.FeedTitleLength {
+		return title
+	}
+	return string([]rune(title)[:constants.FeedTitleLength-1]) + "…"
+}
+
+func labelNames(labels []models.PostLabel) []string {
+	names := make([]string, len(labels))
+	for i, label := range labels {
+		names[i] = string(label.Label)
+	}
+	return names
+}
+
+// asHTML escapes plain text for the HTML fields of the feeds, keeping its line breaks.
+func asHTML(content string) string {
+	return strings.ReplaceAll(html.EscapeString(content), "\n", "<br/>")
+}
+
+type rss struct {
+	XMLName xml.Name   `xml:"rss"`
+	Version string     `xml:"version,attr"`
+	AtomNS  string     `xml:"xmlns:atom,attr"`
+	Channel rssChannel `xml:"channel"`
+}
+
+type rssChannel struct {
+	Title         string    `xml:"title"`
+	Link          string    `xml:"link"`
+	Description   string    `xml:"description"`
+	Self          rssSelf   `xml:"atom:link"`
+	LastBuildDate string    `xml:"lastBuildDate"`
+	TTL           int       `xml:"ttl"`
+	Items         []rssItem `xml:"item"`
+}
+
+type rssSelf struct {
+	Href string `xml:"href,attr"`
+	Rel  string `xml:"rel,attr"`
+	Type string `xml:"type,attr"`
+}
+
+type rssItem struct {
+	Title       string   `xml:"title"`
+	Link        string   `xml:"link"`
+	Description string   `xml:"description"`
+	Categories  []string `xml:"category"`
+	GUID        rssGUID  `xml:"guid"`
+	PubDate     string   `xml:"pubDate"`
+}
+
+type rssGUID struct {
+	IsPermaLink bool   `xml:"isPermaLink,attr"`
+	Value       string `xml:",chardata"`
+}
+
+func rssDocument(title, description, link, selfURL string, updated time.Time, items []item) rss {
+	channel := rssChannel{
+		Title:         title,
+		Link:          link,
+		Description:   description,
+		Self:          rssSelf{Href: selfURL, Rel: "self", Type: FormatRSS.ContentType()},
+		LastBuildDate: updated.UTC().Format(time.RFC1123Z),
+		TTL:           int(constants.FeedMaxAge.Minutes()),
+		Items:         make([]rssItem, len(items)),
+	}
+	for i, it := range items {
+		channel.Items[i] = rssItem{
+			Title:       it.title,
+			Link:        it.link,
+			Description: asHTML(it.content),
+			Categories:  it.labels,
+			GUID:        rssGUID{IsPermaLink: false, Value: it.id},
+			PubDate:     it.published.UTC().Format(time.RFC1123Z),
+		}
+	}
+	return rss{Version: "2.0", AtomNS: "http://www.w3.org/2005/Atom", Channel: channel}
+}
+
+type atomFeed struct {
+	XMLName  xml.Name    `xml:"http://www.w3.org/2005/Atom feed"`
+	ID       string      `xml:"id"`
+	Title    string      `xml:"title"`
+	Subtitle string      `xml:"subtitle"`
+	Updated  string      `xml:"updated"`
+	Links    []atomLink  `xml:"link"`
+	Author   atomPerson  `xml:"author"`
+	Entries  []atomEntry `xml:"entry"`
+}
+
+type atomLink struct {
+	Href string `xml:"href,attr"`
+	Rel  string `xml:"rel,attr,omitempty"`
+	Type string `xml:"type,attr,omitempty"`
+}
+
+type atomPerson struct {
+	Name string `xml:"name"`
+	URI  string `xml:"uri"`
+}
+
+type atomText struct {
+	Type  string `xml:"type,attr"`
+	Value string `xml:",chardata"`
+}
+
+type atomCategory struct {
+	Term string `xml:"term,attr"`
+}
+
+type atomEntry struct {
+	ID         string         `xml:"id"`
+	Title      string         `xml:"title"`
+	Link       atomLink       `xml:"link"`
+	Published  string         `xml:"published"`
+	Updated    string         `xml:"updated"`
+	Content    atomText       `xml:"content"`
+	Categories []atomCategory `xml:"category"`
+}
+
+func atomDocument(author models.User, title, description, link, selfURL string, updated time.Time,
+	items []item) atomFeed {
+	feed := atomFeed{
+		ID:       fmt.Sprintf("urn:x-clone:user:%d", author.ID),
+		Title:    title,
+		Subtitle: description,
+		Updated:  updated.UTC().Format(time.RFC3339),
+		Links: []atomLink{
+			{Href: link, Rel: "alternate", Type: "text/html"},
+			{Href: selfURL, Rel: "self", Type: FormatAtom.ContentType()},
+		},
+		Author:  atomPerson{Name: author.Nickname, URI: link},
+		Entries: make([]atomEntry, len(items)),
+	}
+	for i, it := range items {
+		published := it.published.UTC().Format(time.RFC3339)
+		entry := atomEntry{
+			ID:        it.id,
+			Title:     it.title,
+			Link:      atomLink{Href: it.link, Rel: "alternate", Type: "text/html"},
+			Published: published,
+			Updated:   published,
+			Content:   atomText{Type: "html", Value: asHTML(it.content)},
+		}
+		for _, label := range it.labels {
+			entry.Categories = append(entry.Categories, atomCategory{Term: label})
+		}
+		feed.Entries[i] = entry
+	}
+	return feed
+}
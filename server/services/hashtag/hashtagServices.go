@@ -0,0 +1,214 @@
+package hashtag
+
+import (
+	"errors"
+	"fmt"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+	"x-clone/server/constants"
+	"x-clone/server/models"
+	"x-clone/server/services/timeline"
+	"x-clone/server/text"
+)
+
+var ErrInvalidHashtag = errors.New("invalid hashtag")
+
+type Trend struct {
+	Tag      string  `json:"tag"`
+	Count    int64   `json:"count"`
+	Baseline float64 `json:"baseline"`
+	Velocity float64 `json:"velocity"`
+}
+
+// Normalize lowercases a tag and strips the leading '#', returning an empty string when the tag is not valid.
+func Normalize(tag string) string {
+	tag = strings.TrimSpace(tag)
+	tag = strings.TrimLeft(tag, "#＃")
+	tag = strings.ToLower(tag)
+
+	if tag == constants.Empty || len([]rune(tag)) > constants.MaxHashtagLen || isNumeric(tag) {
+		return constants.Empty
+	}
+	for _, r := range tag {
+		if !unicode.IsLetter(r) && !unicode.IsNumber(r) && !unicode.IsMark(r) && r != '_' {
+			return constants.Empty
+		}
+	}
+
+	return tag
+}
+
+// ExtractHashtags returns the unique normalized tags of a body in order of appearance.
+func ExtractHashtags(body string) []string {
+	var tags []string
+	seen := make(map[string]bool)
+
+	for _, e := range text.ExtractType(body, text.Hashtag) {
+		tag := Normalize(e.Value)
+		if tag == constants.Empty || seen[tag] {
+			continue
+		}
+		seen[tag] = true
+		tags = append(tags, tag)
+	}
+
+	return tags
+}
+
+// SyncPostHashtags replaces the tags linked to a post with the ones currently found in its body.
+func SyncPostHashtags(db *gorm.DB, post *models.Post) error {
+	if err := RemovePostHashtags(db, post.ID); err != nil {
+		return err
+	}
+
+	tags := ExtractHashtags(post.Body)
+	if len(tags) == 0 {
+		return nil
+	}
+
+	hashtags := make([]models.Hashtag, len(tags))
+	for i, tag := range tags {
+		hashtags[i] = models.Hashtag{Tag: tag}
+	}
+	if err := db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "tag"}},
+		DoNothing: true,
+	}).Create(&hashtags).Error; err != nil {
+		return err
+	}
+
+	var hashtagIDs []uint
+	if err := db.Model(&models.Hashtag{}).Where("tag IN ?", tags).Pluck("id", &hashtagIDs).Error; err != nil {
+		return err
+	}
+
+	links := make([]models.PostHashtag, len(hashtagIDs))
+	for i, hashtagID := range hashtagIDs {
+		links[i] = models.PostHashtag{
+			PostID:    post.ID,
+			HashtagID: hashtagID,
+			CreatedAt: post.CreatedAt,
+		}
+	}
+
+	return db.Create(&links).Error
+}
+
+func RemovePostHashtags(db *gorm.DB, postID uint) error {
+	return db.Where("post_id = ?", postID).Delete(&models.PostHashtag{}).Error
+}
+
+// GetPostsByHashtag returns a page of the posts using a tag newer than since.
+func GetPostsByHashtag(db *gorm.DB, viewerID uint, tag string, limit int, cursor uint,
+	since timeline.Since) ([]models.Post, uint, error) {
+	normalized := Normalize(tag)
+	if normalized == constants.Empty {
+		return nil, 0, ErrInvalidHashtag
+	}
+
+	query := db.Scopes(models.WithPostRelations, models.WithoutBlocked(viewerID), models.WithoutMuted(viewerID),
+		since.Scope).
+		Joins("JOIN post_hashtags ON post_hashtags.post_id = posts.id").
+		Joins("JOIN hashtags ON hashtags.id = post_hashtags.hashtag_id").
+		Where("hashtags.tag = ?", normalized)
+	return timeline.Page(query, limit, cursor)
+}
+
+// Backfill links the posts written before hashtags were indexed to their tags, batchSize posts at a time, and
+// returns how many posts it indexed. Posts already linked to a tag are skipped, so it can safely run again.
+func Backfill(db *gorm.DB, batchSize int) (int, error) {
+	var indexed int
+	var cursor uint
+	for {
+		var posts []models.Post
+		if err := db.Select("id", "body", "created_at").
+			Where("id > ? AND body LIKE ?", cursor, "%#%").
+			Where("NOT EXISTS (SELECT 1 FROM post_hashtags WHERE post_hashtags.post_id = posts.id)").
+			Order("id").Limit(batchSize).Find(&posts).Error; err != nil {
+			return indexed, err
+		}
+		if len(posts) == 0 {
+			return indexed, nil
+		}
+
+		for i := range posts {
+			if len(ExtractHashtags(posts[i].Body)) == 0 {
+				continue
+			}
+			if err := SyncPostHashtags(db, &posts[i]); err != nil {
+				return indexed, err
+			}
+			indexed++
+		}
+		cursor = posts[len(posts)-1].ID
+	}
+}
+
+// GetTrendingHashtags compares how often each tag was used in the latest window against its average usage
+// over the preceding baseline windows. Tags accelerating the most relative to their baseline rank first.
+func GetTrendingHashtags(db *gorm.DB, window time.Duration, limit int) ([]Trend, error) {
+	now := time.Now()
+	windowStart := now.Add(-window)
+	baselineStart := windowStart.Add(-window * constants.TrendingBaselineWindows)
+
+	var rows []struct {
+		Tag           string
+		Count         int64
+		BaselineCount int64
+	}
+	err := db.Raw(`
+		SELECT hashtags.tag,
+		       COUNT(*) FILTER (WHERE post_hashtags.created_at >= @windowStart) AS count,
+		       COUNT(*) FILTER (WHERE post_hashtags.created_at < @windowStart) AS baseline_count
+		FROM post_hashtags
+		JOIN hashtags ON hashtags.id = post_hashtags.hashtag_id
+		WHERE post_hashtags.created_at >= @baselineStart AND post_hashtags.created_at <= @now
+		GROUP BY hashtags.tag
+		HAVING COUNT(*) FILTER (WHERE post_hashtags.created_at >= @windowStart) >= @minCount`,
+		map[string]interface{}{
+			"windowStart":   windowStart,
+			"baselineStart": baselineStart,
+			"now":           now,
+			"minCount":      constants.TrendingMinCount,
+		}).Scan(&rows).Error
+	if err != nil {
+		return nil, fmt.Errorf("internal server error: %w", err)
+	}
+
+	trends := make([]Trend, len(rows))
+	for i, row := range rows {
+		baseline := float64(row.BaselineCount) / constants.TrendingBaselineWindows
+		trends[i] = Trend{
+			Tag:      row.Tag,
+			Count:    row.Count,
+			Baseline: baseline,
+			Velocity: (float64(row.Count) + 1) / (baseline + 1),
+		}
+	}
+
+	sort.Slice(trends, func(i, j int) bool {
+		if trends[i].Velocity != trends[j].Velocity {
+			return trends[i].Velocity > trends[j].Velocity
+		}
+		return trends[i].Count > trends[j].Count
+	})
+
+	if len(trends) > limit {
+		trends = trends[:limit]
+	}
+
+	return trends, nil
+}
+
+func isNumeric(tag string) bool {
+	for _, r := range tag {
+		if !unicode.IsDigit(r) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,197 @@
+package httpsig
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+	"x-clone/server/constants"
+)
+
+var (
+	ErrNoSignature      = errors.New("request is not signed")
+	ErrInvalidSignature = errors.New("invalid request signature")
+)
+
+// signedHeaders are the parts of a request covered by the signatures made here, and the ones a signature
+// must cover to be accepted. The digest ties the signature to the body of POST requests.
+var (
+	signedHeaders       = []string{"(request-target)", "host", "date", "digest"}
+	signedHeadersNoBody = []string{"(request-target)", "host", "date"}
+)
+
+// Sign signs a request following the HTTP Signatures draft used across the fediverse, with rsa-sha256. It sets
+// the Date header, and the Digest header when there is a body.
+func Sign(req *http.Request, keyID string, key *rsa.PrivateKey, body []byte) error {
+	req.Header.Set("Date", time.Now().UTC().Format(http.TimeFormat))
+	headers := signedHeadersNoBody
+	if body != nil {
+		req.Header.Set("Digest", digest(body))
+		headers = signedHeaders
+	}
+
+	hashed := sha256.Sum256([]byte(signingString(req, headers)))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, hashed[:])
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Signature", fmt.Sprintf(`keyId="%s",algorithm="rsa-sha256",headers="%s",signature="%s"`,
+		keyID, strings.Join(headers, " "), base64.StdEncoding.EncodeToString(signature)))
+	return nil
+}
+
+// Signature is the parsed Signature header of a request.
+type Signature struct {
+	KeyID     string
+	Headers   []string
+	signature []byte
+}
+
+// Parse reads the Signature header of a request, so that the key it names can be looked up.
+func Parse(req *http.Request) (*Signature, error) {
+	header := req.Header.Get("Signature")
+	if header == constants.Empty {
+		return nil, ErrNoSignature
+	}
+
+	params := make(map[string]string)
+	for _, part := range strings.Split(header, ",") {
+		name, value, found := strings.Cut(strings.TrimSpace(part), "=")
+		if !found {
+			continue
+		}
+		params[name] = strings.Trim(value, `"`)
+	}
+
+	raw, err := base64.StdEncoding.DecodeString(params["signature"])
+	if err != nil || params["keyId"] == constants.Empty || len(raw) == 0 {
+		return nil, ErrInvalidSignature
+	}
+	// Signatures without a headers parameter only cover the date
+	headers := []string{"date"}
+	if params["headers"] != constants.Empty {
+		headers = strings.Fields(strings.ToLower(params["headers"]))
+	}
+	return &Signature{KeyID: params["keyId"], Headers: headers, signature: raw}, nil
+}
+
+// Verify checks the signature of a request against the public key of its sender, after the checks of Check.
+func (s *Signature) Verify(req *http.Request, body []byte, key *rsa.PublicKey) error {
+	if err := s.Check(req, body); err != nil {
+		return err
+	}
+
+	hashed := sha256.Sum256([]byte(signingString(req, s.Headers)))
+	if err := rsa.VerifyPKCS1v15(key, crypto.SHA256, hashed[:], s.signature); err != nil {
+		return ErrInvalidSignature
+	}
+	return nil
+}
+
+// Check runs the checks that need no key, so that requests bound to fail are refused before the key of their
+// sender is fetched. The signature must cover the request target, host and date, and the digest of the body
+// when there is one. Requests dated more than FederationSignatureMaxSkew away from now are refused, which
+// limits replays.
+func (s *Signature) Check(req *http.Request, body []byte) error {
+	required := signedHeadersNoBody
+	if len(body) > 0 {
+		required = signedHeaders
+		if req.Header.Get("Digest") != digest(body) {
+			return fmt.Errorf("%w: digest does not match the body", ErrInvalidSignature)
+		}
+	}
+	for _, header := range required {
+		if !slices.Contains(s.Headers, header) {
+			return fmt.Errorf("%w: %s is not signed", ErrInvalidSignature, header)
+		}
+	}
+
+	date, err := http.ParseTime(req.Header.Get("Date"))
+	if err != nil {
+		return fmt.Errorf("%w: invalid date", ErrInvalidSignature)
+	}
+	if skew := time.Since(date); skew > constants.FederationSignatureMaxSkew ||
+		skew < -constants.FederationSignatureMaxSkew {
+		return fmt.Errorf("%w: date is too far from now", ErrInvalidSignature)
+	}
+	return nil
+}
+
+// GenerateKey creates an RSA key pair, returned as PEM blocks.
+func GenerateKey() (publicPEM, privatePEM string, err error) {
+	key, err := rsa.GenerateKey(rand.Reader, constants.FederationKeyBits)
+	if err != nil {
+		return constants.Empty, constants.Empty, err
+	}
+	public, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	if err != nil {
+		return constants.Empty, constants.Empty, err
+	}
+	publicPEM = string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: public}))
+	privatePEM = string(pem.EncodeToMemory(&pem.Block{
+		Type:  "RSA PRIVATE KEY",
+		Bytes: x509.MarshalPKCS1PrivateKey(key),
+	}))
+	return publicPEM, privatePEM, nil
+}
+
+func ParsePrivateKey(privatePEM string) (*rsa.PrivateKey, error) {
+	block, _ := pem.Decode([]byte(privatePEM))
+	if block == nil {
+		return nil, errors.New("invalid private key")
+	}
+	return x509.ParsePKCS1PrivateKey(block.Bytes)
+}
+
+// ParsePublicKey reads an RSA public key in either PKIX or PKCS #1 form, both being found in the wild.
+func ParsePublicKey(publicPEM string) (*rsa.PublicKey, error) {
+	block, _ := pem.Decode([]byte(publicPEM))
+	if block == nil {
+		return nil, errors.New("invalid public key")
+	}
+	if key, err := x509.ParsePKCS1PublicKey(block.Bytes); err == nil {
+		return key, nil
+	}
+	parsed, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	key, ok := parsed.(*rsa.PublicKey)
+	if !ok {
+		return nil, errors.New("public key is not an RSA key")
+	}
+	return key, nil
+}
+
+func signingString(req *http.Request, headers []string) string {
+	lines := make([]string, len(headers))
+	for i, header := range headers {
+		switch header {
+		case "(request-target)":
+			lines[i] = header + ": " + strings.ToLower(req.Method) + " " + req.URL.RequestURI()
+		case "host":
+			host := req.Host
+			if host == constants.Empty {
+				host = req.URL.Host
+			}
+			lines[i] = header + ": " + host
+		default:
+			lines[i] = header + ": " + req.Header.Get(header)
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+func digest(body []byte) string {
+	sum := sha256.Sum256(body)
+	return "SHA-256=" + base64.StdEncoding.EncodeToString(sum[:])
+}
@@ -0,0 +1,206 @@
+package httpsig
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+	"x-clone/server/constants"
+)
+
+const testKeyID = "https://remote.example/users/alice#main-key"
+
+func newTestKey(t *testing.T) *rsa.PrivateKey {
+	t.Helper()
+	_, privatePEM, err := GenerateKey()
+	if err != nil {
+		t.Fatalf("GenerateKey() error = %v", err)
+	}
+	key, err := ParsePrivateKey(privatePEM)
+	if err != nil {
+		t.Fatalf("ParsePrivateKey() error = %v", err)
+	}
+	return key
+}
+
+func newInboxRequest(body []byte) *http.Request {
+	return httptest.NewRequest(http.MethodPost, "https://x-clone.example/ap/inbox", bytes.NewReader(body))
+}
+
+// signAt signs a request like Sign does, but with the given date and covered headers.
+func signAt(t *testing.T, req *http.Request, key *rsa.PrivateKey, date time.Time, headers []string, body []byte) {
+	t.Helper()
+	req.Header.Set("Date", date.UTC().Format(http.TimeFormat))
+	req.Header.Set("Digest", digest(body))
+	hashed := sha256.Sum256([]byte(signingString(req, headers)))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, hashed[:])
+	if err != nil {
+		t.Fatalf("SignPKCS1v15() error = %v", err)
+	}
+	req.Header.Set("Signature", fmt.Sprintf(`keyId="%s",algorithm="rsa-sha256",headers="%s",signature="%s"`,
+		testKeyID, strings.Join(headers, " "), base64.StdEncoding.EncodeToString(signature)))
+}
+
+func parseAndVerify(req *http.Request, body []byte, key *rsa.PublicKey) error {
+	signature, err := Parse(req)
+	if err != nil {
+		return err
+	}
+	return signature.Verify(req, body, key)
+}
+
+func TestSignThenVerify(t *testing.T) {
+	key := newTestKey(t)
+	body := []byte(`{"type":"Follow"}`)
+	req := newInboxRequest(body)
+	if err := Sign(req, testKeyID, key, body); err != nil {
+		t.Fatalf("Sign() error = %v", err)
+	}
+
+	signature, err := Parse(req)
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+	if signature.KeyID != testKeyID {
+		t.Errorf("KeyID = %q, want %q", signature.KeyID, testKeyID)
+	}
+	if err := signature.Verify(req, body, &key.PublicKey); err != nil {
+		t.Errorf("Verify() error = %v", err)
+	}
+}
+
+func TestSignThenVerifyWithoutBody(t *testing.T) {
+	key := newTestKey(t)
+	req := httptest.NewRequest(http.MethodGet, "https://x-clone.example/ap/users/1", nil)
+	if err := Sign(req, testKeyID, key, nil); err != nil {
+		t.Fatalf("Sign() error = %v", err)
+	}
+	if req.Header.Get("Digest") != constants.Empty {
+		t.Errorf("Digest = %q, want none without a body", req.Header.Get("Digest"))
+	}
+	if err := parseAndVerify(req, nil, &key.PublicKey); err != nil {
+		t.Errorf("Verify() error = %v", err)
+	}
+}
+
+func TestVerifyRejectsDigestMismatch(t *testing.T) {
+	key := newTestKey(t)
+	body := []byte(`{"type":"Follow"}`)
+	req := newInboxRequest(body)
+	if err := Sign(req, testKeyID, key, body); err != nil {
+		t.Fatalf("Sign() error = %v", err)
+	}
+
+	if err := parseAndVerify(req, []byte(`{"type":"Delete"}`), &key.PublicKey); !errors.Is(err, ErrInvalidSignature) {
+		t.Errorf("Verify() error = %v, want ErrInvalidSignature", err)
+	}
+}
+
+func TestVerifyRejectsDateSkew(t *testing.T) {
+	key := newTestKey(t)
+	body := []byte(`{"type":"Follow"}`)
+	for _, date := range []time.Time{
+		time.Now().Add(-constants.FederationSignatureMaxSkew - time.Minute),
+		time.Now().Add(constants.FederationSignatureMaxSkew + time.Minute),
+	} {
+		req := newInboxRequest(body)
+		signAt(t, req, key, date, signedHeaders, body)
+		if err := parseAndVerify(req, body, &key.PublicKey); !errors.Is(err, ErrInvalidSignature) {
+			t.Errorf("Verify() of a request dated %s error = %v, want ErrInvalidSignature", date, err)
+		}
+	}
+
+	req := newInboxRequest(body)
+	signAt(t, req, key, time.Now().Add(-time.Minute), signedHeaders, body)
+	if err := parseAndVerify(req, body, &key.PublicKey); err != nil {
+		t.Errorf("Verify() of a request dated a minute ago error = %v", err)
+	}
+}
+
+func TestVerifyRequiresSignedHeaders(t *testing.T) {
+	key := newTestKey(t)
+	body := []byte(`{"type":"Follow"}`)
+	for _, headers := range [][]string{
+		{"date"},
+		{"(request-target)", "host", "date"},
+		{"host", "date", "digest"},
+	} {
+		req := newInboxRequest(body)
+		signAt(t, req, key, time.Now(), headers, body)
+		if err := parseAndVerify(req, body, &key.PublicKey); !errors.Is(err, ErrInvalidSignature) {
+			t.Errorf("Verify() of a signature covering %v error = %v, want ErrInvalidSignature", headers, err)
+		}
+	}
+}
+
+func TestVerifyRejectsOtherKeysAndTampering(t *testing.T) {
+	key := newTestKey(t)
+	body := []byte(`{"type":"Follow"}`)
+	req := newInboxRequest(body)
+	if err := Sign(req, testKeyID, key, body); err != nil {
+		t.Fatalf("Sign() error = %v", err)
+	}
+
+	if err := parseAndVerify(req, body, &newTestKey(t).PublicKey); !errors.Is(err, ErrInvalidSignature) {
+		t.Errorf("Verify() with another key error = %v, want ErrInvalidSignature", err)
+	}
+
+	req.URL.Path = "/ap/users/2/inbox"
+	if err := parseAndVerify(req, body, &key.PublicKey); !errors.Is(err, ErrInvalidSignature) {
+		t.Errorf("Verify() of another target error = %v, want ErrInvalidSignature", err)
+	}
+}
+
+func TestParseRejectsMissingOrMalformedSignatures(t *testing.T) {
+	req := newInboxRequest(nil)
+	if _, err := Parse(req); !errors.Is(err, ErrNoSignature) {
+		t.Errorf("Parse() of an unsigned request error = %v, want ErrNoSignature", err)
+	}
+
+	for _, header := range []string{
+		`algorithm="rsa-sha256",headers="date",signature="c2lnbmF0dXJl"`,
+		`keyId="` + testKeyID + `",headers="date",signature="not base64!"`,
+		`keyId="` + testKeyID + `",headers="date"`,
+	} {
+		req.Header.Set("Signature", header)
+		if _, err := Parse(req); !errors.Is(err, ErrInvalidSignature) {
+			t.Errorf("Parse(%s) error = %v, want ErrInvalidSignature", header, err)
+		}
+	}
+}
+
+func TestParsePublicKeyForms(t *testing.T) {
+	key := newTestKey(t)
+	pkix, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	if err != nil {
+		t.Fatalf("MarshalPKIXPublicKey() error = %v", err)
+	}
+	for name, block := range map[string]*pem.Block{
+		"PKIX":    {Type: "PUBLIC KEY", Bytes: pkix},
+		"PKCS #1": {Type: "RSA PUBLIC KEY", Bytes: x509.MarshalPKCS1PublicKey(&key.PublicKey)},
+	} {
+		parsed, err := ParsePublicKey(string(pem.EncodeToMemory(block)))
+		if err != nil {
+			t.Errorf("ParsePublicKey(%s) error = %v", name, err)
+			continue
+		}
+		if !parsed.Equal(&key.PublicKey) {
+			t.Errorf("ParsePublicKey(%s) returned another key", name)
+		}
+	}
+
+	if _, err := ParsePublicKey("not a key"); err == nil {
+		t.Error("ParsePublicKey() of garbage succeeded")
+	}
+}
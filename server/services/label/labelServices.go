@@ -0,0 +1,84 @@
+package label
+
+import (
+	"errors"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"strings"
+	"x-clone/server/models"
+)
+
+var (
+	ErrInvalidLabel      = errors.New("label must be one of sensitive, nudity, violence or spoiler")
+	ErrInvalidPreference = errors.New("preference must be one of show, blur or hide")
+	ErrNotModerator      = errors.New("only moderators can label posts")
+)
+
+// NormalizeLabels lowercases and deduplicates labels, rejecting unknown ones.
+func NormalizeLabels(raw []models.ContentLabel) ([]models.ContentLabel, error) {
+	seen := make(map[models.ContentLabel]bool, len(raw))
+	labels := make([]models.ContentLabel, 0, len(raw))
+	for _, l := range raw {
+		normalized := models.ContentLabel(strings.ToLower(strings.TrimSpace(string(l))))
+		if !normalized.IsValid() {
+			return nil, ErrInvalidLabel
+		}
+		if !seen[normalized] {
+			seen[normalized] = true
+			labels = append(labels, normalized)
+		}
+	}
+	return labels, nil
+}
+
+// AddLabels labels a post; labels it already has are kept as they were.
+func AddLabels(db *gorm.DB, postID, appliedByID uint, byModerator bool, labels []models.ContentLabel) error {
+	if len(labels) == 0 {
+		return nil
+	}
+
+	rows := make([]models.PostLabel, len(labels))
+	for i, l := range labels {
+		rows[i] = models.PostLabel{PostID: postID, Label: l, AppliedByID: appliedByID, ByModerator: byModerator}
+	}
+	return db.Clauses(clause.OnConflict{DoNothing: true}).Create(&rows).Error
+}
+
+// RemoveLabel removes one label from a post; removing a missing label is not an error.
+func RemoveLabel(db *gorm.DB, postID uint, l models.ContentLabel) error {
+	return db.Where("post_id = ? AND label = ?", postID, l).Delete(&models.PostLabel{}).Error
+}
+
+// RemovePostLabels deletes every label of a post, used when the post itself is deleted.
+func RemovePostLabels(db *gorm.DB, postID uint) error {
+	return db.Where("post_id = ?", postID).Delete(&models.PostLabel{}).Error
+}
+
+func IsModerator(db *gorm.DB, userID uint) (bool, error) {
+	var u models.User
+	if err := db.Select("is_moderator").First(&u, userID).Error; err != nil {
+		return false, err
+	}
+	return u.IsModerator, nil
+}
+
+// GetPreference returns how the user wants labeled posts to be shown. Anonymous viewers (userID 0) get
+// labeled posts blurred.
+func GetPreference(db *gorm.DB, userID uint) (models.SensitivePreference, error) {
+	if userID == 0 {
+		return models.SensitiveBlur, nil
+	}
+
+	var u models.User
+	if err := db.Select("sensitive_content").First(&u, userID).Error; err != nil {
+		return models.SensitiveBlur, err
+	}
+	return u.SensitiveContent, nil
+}
+
+func SetPreference(db *gorm.DB, userID uint, preference models.SensitivePreference) error {
+	if !preference.IsValid() {
+		return ErrInvalidPreference
+	}
+	return db.Model(&models.User{}).Where("id = ?", userID).Update("sensitive_content", preference).Error
+}
@@ -0,0 +1,210 @@
+package list
+
+import (
+	"errors"
+	"fmt"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"strings"
+	"unicode/utf8"
+	"x-clone/server/constants"
+	"x-clone/server/models"
+	"x-clone/server/services/timeline"
+)
+
+var (
+	ErrNoList             = errors.New("no list found")
+	ErrNoUser             = errors.New("no user found")
+	ErrNotListOwner       = errors.New("you are not the owner of this list")
+	ErrInvalidListName    = fmt.Errorf("list name must be between 1 and %d characters", constants.MaxListNameLength)
+	ErrDescriptionTooLong = fmt.Errorf("list description cannot be longer than %d characters",
+		constants.MaxListDescriptionLength)
+	ErrListFull = errors.New("list has reached the maximum number of members")
+	ErrOwnList  = errors.New("you cannot subscribe to your own list")
+)
+
+func CreateList(db *gorm.DB, ownerID uint, name, description string, private bool) (*models.List, error) {
+	name, description = strings.TrimSpace(name), strings.TrimSpace(description)
+	if name == constants.Empty || utf8.RuneCountInString(name) > constants.MaxListNameLength {
+		return nil, ErrInvalidListName
+	}
+	if utf8.RuneCountInString(description) > constants.MaxListDescriptionLength {
+		return nil, ErrDescriptionTooLong
+	}
+
+	list := models.List{OwnerID: ownerID, Name: name, Description: description, Private: private}
+	if err := db.Create(&list).Error; err != nil {
+		return nil, err
+	}
+	return &list, nil
+}
+
+// GetList returns a list the viewer can see. Private lists of other users are reported as missing.
+// Anonymous viewers have a viewerID of 0.
+func GetList(db *gorm.DB, viewerID, listID uint) (*models.List, error) {
+	var list models.List
+	err := db.Where("id = ? AND (private = ? OR owner_id = ?)", listID, false, viewerID).First(&list).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrNoList
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &list, nil
+}
+
+// GetListsOfOwner returns the lists of a user the viewer can see, newest first.
+func GetListsOfOwner(db *gorm.DB, viewerID, ownerID uint) ([]models.List, error) {
+	query := db.Where("owner_id = ?", ownerID)
+	if viewerID != ownerID {
+		query = query.Where("private = ?", false)
+	}
+
+	var lists []models.List
+	if err := query.Order("id desc").Find(&lists).Error; err != nil {
+		return nil, err
+	}
+	return lists, nil
+}
+
+// GetSubscribedLists returns the lists a user subscribed to, most recently subscribed first.
+func GetSubscribedLists(db *gorm.DB, userID uint) ([]models.List, error) {
+	var lists []models.List
+	if err := db.Joins("JOIN list_subscriptions ON list_subscriptions.list_id = lists.id").
+		Where("list_subscriptions.user_id = ? AND lists.private = ?", userID, false).
+		Order("list_subscriptions.id desc").
+		Find(&lists).Error; err != nil {
+		return nil, err
+	}
+	return lists, nil
+}
+
+// DeleteList removes a list along with its members and subscriptions.
+func DeleteList(db *gorm.DB, ownerID, listID uint) error {
+	if _, err := getOwnedList(db, ownerID, listID); err != nil {
+		return err
+	}
+
+	return db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("list_id = ?", listID).Delete(&models.ListMember{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("list_id = ?", listID).Delete(&models.ListSubscription{}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&models.List{}, listID).Error
+	})
+}
+
+// AddMember adds a user to a list; adding a user who is already a member is not an error.
+func AddMember(db *gorm.DB, ownerID, listID uint, username string) error {
+	if _, err := getOwnedList(db, ownerID, listID); err != nil {
+		return err
+	}
+	memberID, err := userIDByUsername(db, username)
+	if err != nil {
+		return err
+	}
+
+	var memberCount int64
+	if err := db.Model(&models.ListMember{}).Where("list_id = ?", listID).Count(&memberCount).Error; err != nil {
+		return err
+	}
+	if memberCount >= constants.MaxListMembers {
+		return ErrListFull
+	}
+
+	member := models.ListMember{ListID: listID, UserID: memberID}
+	return db.Clauses(clause.OnConflict{DoNothing: true}).Create(&member).Error
+}
+
+// RemoveMember removes a user from a list; removing a user who is not a member is not an error.
+func RemoveMember(db *gorm.DB, ownerID, listID uint, username string) error {
+	if _, err := getOwnedList(db, ownerID, listID); err != nil {
+		return err
+	}
+	memberID, err := userIDByUsername(db, username)
+	if err != nil {
+		return err
+	}
+
+	return db.Where("list_id = ? AND user_id = ?", listID, memberID).Delete(&models.ListMember{}).Error
+}
+
+// GetMembers returns the members of a list the viewer can see, most recently added first.
+func GetMembers(db *gorm.DB, viewerID, listID uint) ([]models.User, error) {
+	if _, err := GetList(db, viewerID, listID); err != nil {
+		return nil, err
+	}
+
+	var members []models.User
+	if err := db.Joins("JOIN list_members ON list_members.user_id = users.id").
+		Where("list_members.list_id = ?", listID).
+		Order("list_members.id desc").
+		Find(&members).Error; err != nil {
+		return nil, err
+	}
+	return members, nil
+}
+
+// Subscribe adds a public list of another user to the user's lists; subscribing twice is not an error.
+func Subscribe(db *gorm.DB, userID, listID uint) error {
+	list, err := GetList(db, userID, listID)
+	if err != nil {
+		return err
+	}
+	if list.OwnerID == userID {
+		return ErrOwnList
+	}
+
+	subscription := models.ListSubscription{ListID: listID, UserID: userID}
+	return db.Clauses(clause.OnConflict{DoNothing: true}).Create(&subscription).Error
+}
+
+// Unsubscribe removes a list subscription; unsubscribing from a list not subscribed to is not an error.
+func Unsubscribe(db *gorm.DB, userID, listID uint) error {
+	return db.Where("list_id = ? AND user_id = ?", listID, userID).Delete(&models.ListSubscription{}).Error
+}
+
+// GetListTimeline returns a page of the posts written by the members of a list newer than since.
+func GetListTimeline(db *gorm.DB, viewerID, listID uint, limit int, cursor uint,
+	since timeline.Since) ([]models.Post, uint, error) {
+	if _, err := GetList(db, viewerID, listID); err != nil {
+		return nil, 0, err
+	}
+
+	query := db.Scopes(models.WithPostRelations, models.WithoutBlocked(viewerID), models.WithoutMuted(viewerID),
+		since.Scope).
+		Where("user_id IN (?)", db.Model(&models.ListMember{}).Select("user_id").Where("list_id = ?", listID))
+	return timeline.Page(query, limit, cursor)
+}
+
+func getOwnedList(db *gorm.DB, ownerID, listID uint) (*models.List, error) {
+	var list models.List
+	err := db.First(&list, listID).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrNoList
+	}
+	if err != nil {
+		return nil, err
+	}
+	if list.OwnerID != ownerID {
+		if list.Private {
+			return nil, ErrNoList
+		}
+		return nil, ErrNotListOwner
+	}
+	return &list, nil
+}
+
+func userIDByUsername(db *gorm.DB, username string) (uint, error) {
+	var u models.User
+	err := db.Select("id").Where("username = ?", username).First(&u).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return 0, ErrNoUser
+	}
+	if err != nil {
+		return 0, err
+	}
+	return u.ID, nil
+}
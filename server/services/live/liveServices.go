@@ -0,0 +1,162 @@
+package live
+
+import (
+	"container/list"
+	"gorm.io/gorm"
+	"log"
+	"sync"
+	"x-clone/server/constants"
+	"x-clone/server/models"
+)
+
+// EventType tells what changed about a post.
+type EventType string
+
+const (
+	EventPost     EventType = "post"
+	EventCounters EventType = "counters"
+	EventDelete   EventType = "delete"
+)
+
+// Event is a change pushed to the clients watching a timeline. It only carries IDs and counters, so that it
+// can travel between replicas as is; the post itself is loaded for each viewer when needed.
+type Event struct {
+	Type         EventType `json:"type"`
+	PostID       uint      `json:"post_id"`
+	AuthorID     uint      `json:"author_id"`
+	LikesCount   uint      `json:"likes_count"`
+	RepostsCount uint      `json:"reposts_count"`
+}
+
+// Broker delivers events to every subscriber. MemoryBroker only reaches the clients of the current process;
+// running several replicas needs a broker shared by all of them, for instance one relaying events through
+// Postgres LISTEN/NOTIFY.
+type Broker interface {
+	Publish(event Event)
+	// Subscribe returns the events published from now on, until cancel is called.
+	Subscribe() (events <-chan Event, cancel func())
+}
+
+// MemoryBroker is the in-process Broker. Publishing never waits on a subscriber: a subscriber too slow to
+// keep up with LiveSubscriberBuffer pending events misses the next ones.
+type MemoryBroker struct {
+	mu          sync.RWMutex
+	subscribers map[chan Event]struct{}
+}
+
+func NewMemoryBroker() *MemoryBroker {
+	return &MemoryBroker{subscribers: make(map[chan Event]struct{})}
+}
+
+func (b *MemoryBroker) Publish(event Event) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	for subscriber := range b.subscribers {
+		select {
+		case subscriber <- event:
+		default:
+		}
+	}
+}
+
+func (b *MemoryBroker) Subscribe() (<-chan Event, func()) {
+	events := make(chan Event, constants.LiveSubscriberBuffer)
+	b.mu.Lock()
+	b.subscribers[events] = struct{}{}
+	b.mu.Unlock()
+
+	var once sync.Once
+	return events, func() {
+		once.Do(func() {
+			b.mu.Lock()
+			delete(b.subscribers, events)
+			b.mu.Unlock()
+			close(events)
+		})
+	}
+}
+
+// SentPosts remembers the posts last sent on a stream, so that their counters and deletions are relayed too.
+// Only the LiveSentPostsMax most recently sent posts are kept, older ones being forgotten first.
+type SentPosts struct {
+	order *list.List
+	ids   map[uint]*list.Element
+}
+
+func NewSentPosts() *SentPosts {
+	return &SentPosts{order: list.New(), ids: make(map[uint]*list.Element)}
+}
+
+func (s *SentPosts) Add(postID uint) {
+	if element, ok := s.ids[postID]; ok {
+		s.order.MoveToFront(element)
+		return
+	}
+	s.ids[postID] = s.order.PushFront(postID)
+	if s.order.Len() > constants.LiveSentPostsMax {
+		oldest := s.order.Back()
+		s.order.Remove(oldest)
+		delete(s.ids, oldest.Value.(uint))
+	}
+}
+
+func (s *SentPosts) Has(postID uint) bool {
+	_, ok := s.ids[postID]
+	return ok
+}
+
+func (s *SentPosts) Remove(postID uint) {
+	if element, ok := s.ids[postID]; ok {
+		s.order.Remove(element)
+		delete(s.ids, postID)
+	}
+}
+
+var (
+	brokerMu      sync.RWMutex
+	defaultBroker Broker = NewMemoryBroker()
+)
+
+// SetBroker replaces the broker used by Publish and Subscribe. It must be called before serving requests.
+func SetBroker(broker Broker) {
+	brokerMu.Lock()
+	defer brokerMu.Unlock()
+	defaultBroker = broker
+}
+
+func currentBroker() Broker {
+	brokerMu.RLock()
+	defer brokerMu.RUnlock()
+	return defaultBroker
+}
+
+func Subscribe() (<-chan Event, func()) {
+	return currentBroker().Subscribe()
+}
+
+// PublishPost announces a new post. It must be called once the post is committed.
+func PublishPost(post models.Post) {
+	currentBroker().Publish(Event{Type: EventPost, PostID: post.ID, AuthorID: post.UserID})
+}
+
+// PublishDeletion announces a removed post.
+func PublishDeletion(post models.Post) {
+	currentBroker().Publish(Event{Type: EventDelete, PostID: post.ID, AuthorID: post.UserID})
+}
+
+// PublishCounters announces the current like and repost counts of a post, after they changed. Failing to load
+// them is only logged, since the change itself already succeeded.
+func PublishCounters(db *gorm.DB, postID uint) {
+	var post models.Post
+	if err := db.Select("id", "user_id", "likes_count", "reposts_count").First(&post, postID).Error; err != nil {
+		log.Println("Failed to load counters of post for live updates:", err)
+		return
+	}
+	currentBroker().Publish(Event{
+		Type:         EventCounters,
+		PostID:       post.ID,
+		AuthorID:     post.UserID,
+		LikesCount:   post.LikesCount,
+		RepostsCount: post.RepostsCount,
+	})
+}
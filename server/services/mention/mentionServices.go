@@ -0,0 +1,88 @@
+package mention
+
+import (
+	"gorm.io/gorm"
+	"strings"
+	"x-clone/server/models"
+	"x-clone/server/services/timeline"
+	"x-clone/server/text"
+)
+
+// SyncPostMentions resolves the @usernames of a post against existing users and replaces its stored mentions.
+// Handles of remote accounts, such as @alice@mastodon.social, resolve to the users mirroring them.
+// Mentions resolved before keep their user, so that editing a post does not lose the mentions of users renamed
+// since it was written.
+func SyncPostMentions(db *gorm.DB, post *models.Post) error {
+	var previous []models.Mention
+	if err := db.Where("post_id = ?", post.ID).Find(&previous).Error; err != nil {
+		return err
+	}
+	if err := RemovePostMentions(db, post.ID); err != nil {
+		return err
+	}
+
+	spans := text.ExtractType(post.Body, text.Mention)
+	if len(spans) == 0 {
+		return nil
+	}
+
+	known := make(map[string]uint, len(previous))
+	for _, m := range previous {
+		known[strings.ToLower(m.Username)] = m.UserID
+	}
+
+	resolved := make(map[string]uint, len(spans))
+	spellings := make(map[string]string, len(spans))
+	usernames := make([]string, 0, len(spans))
+	for _, span := range spans {
+		written := strings.ToLower(span.Value)
+		spellings[written] = span.Value
+		if userID, ok := known[written]; ok {
+			resolved[written] = userID
+			continue
+		}
+		usernames = append(usernames, written)
+	}
+
+	if len(usernames) > 0 {
+		var mentionedUsers []models.User
+		if err := db.Select("id", "username").
+			Where("LOWER(username) IN ?", usernames).
+			Find(&mentionedUsers).Error; err != nil {
+			return err
+		}
+		for _, mentionedUser := range mentionedUsers {
+			resolved[strings.ToLower(mentionedUser.Username)] = mentionedUser.ID
+		}
+	}
+	if len(resolved) == 0 {
+		return nil
+	}
+
+	mentions := make([]models.Mention, 0, len(resolved))
+	seen := make(map[uint]bool, len(resolved))
+	for written, userID := range resolved {
+		if seen[userID] {
+			continue
+		}
+		seen[userID] = true
+		mentions = append(mentions, models.Mention{PostID: post.ID, UserID: userID, Username: spellings[written]})
+	}
+
+	return db.Create(&mentions).Error
+}
+
+func RemovePostMentions(db *gorm.DB, postID uint) error {
+	return db.Where("post_id = ?", postID).Delete(&models.Mention{}).Error
+}
+
+// GetMentionsOfUser returns a page of the posts mentioning a user newer than since, leaving out the accounts the
+// user blocked or muted.
+func GetMentionsOfUser(db *gorm.DB, userID uint, limit int, cursor uint,
+	since timeline.Since) ([]models.Post, uint, error) {
+	query := db.Scopes(models.WithPostRelations, models.WithoutBlocked(userID), models.WithoutMuted(userID),
+		since.Scope).
+		Joins("JOIN mentions ON mentions.post_id = posts.id").
+		Where("mentions.user_id = ?", userID)
+	return timeline.Page(query, limit, cursor)
+}
@@ -0,0 +1,329 @@
+package mute
+
+import (
+	"errors"
+	"fmt"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+	"x-clone/server/constants"
+	"x-clone/server/mappers"
+	"x-clone/server/models"
+)
+
+var (
+	ErrCannotMuteSelf = errors.New("you cannot mute yourself")
+	ErrExpiryInPast   = errors.New("expiry must be in the future")
+	ErrInvalidPhrase  = fmt.Errorf("muted words must be between 1 and %d characters",
+		constants.MaxMutedPhraseLength)
+	ErrTooManyMutedWords = fmt.Errorf("you can mute at most %d words", constants.MaxMutedWords)
+)
+
+// MuteAccount mutes an account; muting twice is not an error.
+func MuteAccount(db *gorm.DB, userID uint, username string) error {
+	mutedID, err := userIDByUsername(db, username)
+	if err != nil {
+		return err
+	}
+	if mutedID == userID {
+		return ErrCannotMuteSelf
+	}
+	return db.Clauses(clause.OnConflict{DoNothing: true}).
+		Create(&models.MutedAccount{UserID: userID, MutedID: mutedID}).Error
+}
+
+// UnmuteAccount unmutes an account; unmuting an account that is not muted is not an error.
+func UnmuteAccount(db *gorm.DB, userID uint, username string) error {
+	mutedID, err := userIDByUsername(db, username)
+	if err != nil {
+		return err
+	}
+	return db.Where("user_id = ? AND muted_id = ?", userID, mutedID).Delete(&models.MutedAccount{}).Error
+}
+
+// GetMutedAccounts returns the accounts muted by the user, most recently muted first.
+func GetMutedAccounts(db *gorm.DB, userID uint) ([]models.User, error) {
+	var users []models.User
+	if err := db.Joins("JOIN muted_accounts ON muted_accounts.muted_id = users.id").
+		Where("muted_accounts.user_id = ?", userID).
+		Order("muted_accounts.id desc").
+		Find(&users).Error; err != nil {
+		return nil, err
+	}
+	return users, nil
+}
+
+// MuteWord mutes a word or phrase, matched regardless of case. Muting a phrase again replaces its expiry.
+func MuteWord(db *gorm.DB, userID uint, phrase string, expiresAt *time.Time) (*models.MutedWord, error) {
+	phrase = normalize(phrase)
+	if phrase == constants.Empty || utf8.RuneCountInString(phrase) > constants.MaxMutedPhraseLength {
+		return nil, ErrInvalidPhrase
+	}
+	if expiresAt != nil && !expiresAt.After(time.Now()) {
+		return nil, ErrExpiryInPast
+	}
+
+	var count int64
+	if err := activeWords(db, userID).Where("phrase <> ?", phrase).Count(&count).Error; err != nil {
+		return nil, err
+	}
+	if count >= constants.MaxMutedWords {
+		return nil, ErrTooManyMutedWords
+	}
+
+	word := models.MutedWord{UserID: userID, Phrase: phrase, ExpiresAt: expiresAt}
+	if err := db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "user_id"}, {Name: "phrase"}},
+		DoUpdates: clause.AssignmentColumns([]string{"expires_at"}),
+	}).Create(&word).Error; err != nil {
+		return nil, err
+	}
+	return &word, nil
+}
+
+// UnmuteWord removes a muted word of the user; removing one that does not exist is not an error.
+func UnmuteWord(db *gorm.DB, userID, wordID uint) error {
+	return db.Where("id = ? AND user_id = ?", wordID, userID).Delete(&models.MutedWord{}).Error
+}
+
+// GetMutedWords returns the words muted by the user that have not expired yet, most recently muted first.
+func GetMutedWords(db *gorm.DB, userID uint) ([]models.MutedWord, error) {
+	words := []models.MutedWord{}
+	if err := activeWords(db, userID).Order("id desc").Find(&words).Error; err != nil {
+		return nil, err
+	}
+	return words, nil
+}
+
+// MuteConversation mutes the whole thread the post belongs to, from the post that started it down to every
+// reply. Muting twice is not an error.
+func MuteConversation(db *gorm.DB, userID, postID uint) error {
+	rootID, err := conversationRoot(db, postID)
+	if err != nil {
+		return err
+	}
+	return db.Clauses(clause.OnConflict{DoNothing: true}).
+		Create(&models.MutedConversation{UserID: userID, RootPostID: rootID}).Error
+}
+
+// UnmuteConversation unmutes the thread the post belongs to; unmuting a thread that is not muted is not an error.
+func UnmuteConversation(db *gorm.DB, userID, postID uint) error {
+	rootID, err := conversationRoot(db, postID)
+	if err != nil {
+		return err
+	}
+	return db.Where("user_id = ? AND root_post_id = ?", userID, rootID).Delete(&models.MutedConversation{}).Error
+}
+
+// GetMutedConversations returns the posts that started the threads muted by the user, most recently muted first.
+func GetMutedConversations(db *gorm.DB, userID uint) ([]models.Post, error) {
+	var posts []models.Post
+	if err := db.Scopes(models.WithPostRelations).
+		Joins("JOIN muted_conversations ON muted_conversations.root_post_id = posts.id").
+		Where("muted_conversations.user_id = ?", userID).
+		Order("muted_conversations.id desc").
+		Find(&posts).Error; err != nil {
+		return nil, err
+	}
+	return posts, nil
+}
+
+// RemovePostConversations forgets the mutes of a thread whose first post is deleted.
+func RemovePostConversations(db *gorm.DB, postID uint) error {
+	return db.Where("root_post_id = ?", postID).Delete(&models.MutedConversation{}).Error
+}
+
+// Filter hides what a user muted. It is the one place deciding what muting hides, so that timelines, search
+// results and mentions agree.
+type Filter struct {
+	userID        uint
+	accounts      map[uint]bool
+	phrases       []string
+	conversations map[uint]bool
+}
+
+// LoadFilter loads the accounts, unexpired words and conversations muted by the user. Anonymous users
+// (userID 0) get an empty filter.
+func LoadFilter(db *gorm.DB, userID uint) (*Filter, error) {
+	filter := &Filter{userID: userID, accounts: make(map[uint]bool), conversations: make(map[uint]bool)}
+	if userID == 0 {
+		return filter, nil
+	}
+
+	var accountIDs, rootIDs []uint
+	if err := db.Model(&models.MutedAccount{}).Where("user_id = ?", userID).
+		Pluck("muted_id", &accountIDs).Error; err != nil {
+		return nil, err
+	}
+	if err := activeWords(db, userID).Pluck("phrase", &filter.phrases).Error; err != nil {
+		return nil, err
+	}
+	if err := db.Model(&models.MutedConversation{}).Where("user_id = ?", userID).
+		Pluck("root_post_id", &rootIDs).Error; err != nil {
+		return nil, err
+	}
+	for _, id := range accountIDs {
+		filter.accounts[id] = true
+	}
+	for _, id := range rootIDs {
+		filter.conversations[id] = true
+	}
+	return filter, nil
+}
+
+// IsEmpty tells whether the filter hides nothing.
+func (f *Filter) IsEmpty() bool {
+	return len(f.accounts) == 0 && len(f.phrases) == 0 && len(f.conversations) == 0
+}
+
+// Apply leaves out the posts that are written by a muted account, contain a muted word or belong to a muted
+// conversation, and the posts replying to, sharing or quoting such a post. The posts of the user are kept.
+func (f *Filter) Apply(db *gorm.DB, posts []mappers.PostResponse) ([]mappers.PostResponse, error) {
+	if f.IsEmpty() || len(posts) == 0 {
+		return posts, nil
+	}
+
+	var roots map[uint]uint
+	if len(f.conversations) > 0 {
+		postIDs := make([]uint, 0, len(posts))
+		for _, post := range posts {
+			postIDs = append(postIDs, post.ID)
+			if post.ParentPost != nil {
+				postIDs = append(postIDs, post.ParentPost.ID)
+			}
+		}
+		var err error
+		if roots, err = conversationRoots(db, postIDs); err != nil {
+			return nil, err
+		}
+	}
+
+	kept := posts[:0]
+	for _, post := range posts {
+		if post.UserID == f.userID {
+			kept = append(kept, post)
+			continue
+		}
+		hidden := f.hides(post.ID, post.UserID, post.Body, roots)
+		if post.ParentPost != nil {
+			hidden = hidden || f.hides(post.ParentPost.ID, post.ParentPost.UserID, post.ParentPost.Body, roots)
+		}
+		if !hidden {
+			kept = append(kept, post)
+		}
+	}
+	return kept, nil
+}
+
+// FilterPosts is LoadFilter followed by Apply.
+func FilterPosts(db *gorm.DB, userID uint, posts []mappers.PostResponse) ([]mappers.PostResponse, error) {
+	filter, err := LoadFilter(db, userID)
+	if err != nil {
+		return nil, err
+	}
+	return filter.Apply(db, posts)
+}
+
+func (f *Filter) hides(postID, authorID uint, body string, roots map[uint]uint) bool {
+	if f.accounts[authorID] {
+		return true
+	}
+	if root, ok := roots[postID]; ok && f.conversations[root] {
+		return true
+	}
+	if len(f.phrases) == 0 {
+		return false
+	}
+	text := normalize(body)
+	for _, phrase := range f.phrases {
+		if containsPhrase(text, phrase) {
+			return true
+		}
+	}
+	return false
+}
+
+// containsPhrase tells whether the phrase appears in the text as whole words, so that muting "cat" does not
+// hide posts about "category". Both must already be normalized.
+func containsPhrase(text, phrase string) bool {
+	for start := 0; start <= len(text)-len(phrase); {
+		i := strings.Index(text[start:], phrase)
+		if i < 0 {
+			return false
+		}
+		i += start
+		before, _ := utf8.DecodeLastRuneInString(text[:i])
+		after, _ := utf8.DecodeRuneInString(text[i+len(phrase):])
+		if !isWordRune(before) && !isWordRune(after) {
+			return true
+		}
+		start = i + 1
+	}
+	return false
+}
+
+func isWordRune(r rune) bool {
+	return r != utf8.RuneError && (unicode.IsLetter(r) || unicode.IsDigit(r))
+}
+
+// normalize lower-cases a text and collapses its white space.
+func normalize(text string) string {
+	return strings.ToLower(strings.Join(strings.Fields(text), " "))
+}
+
+func activeWords(db *gorm.DB, userID uint) *gorm.DB {
+	return db.Model(&models.MutedWord{}).
+		Where("user_id = ? AND (expires_at IS NULL OR expires_at > ?)", userID, time.Now())
+}
+
+// conversationRoot returns the post that started the thread of the given post.
+func conversationRoot(db *gorm.DB, postID uint) (uint, error) {
+	roots, err := conversationRoots(db, []uint{postID})
+	if err != nil {
+		return 0, err
+	}
+	root, ok := roots[postID]
+	if !ok {
+		return 0, errors.New(constants.ErrNoPost)
+	}
+	return root, nil
+}
+
+// conversationRoots walks the replies of many posts up to the posts that started their threads, in one query.
+func conversationRoots(db *gorm.DB, postIDs []uint) (map[uint]uint, error) {
+	var rows []struct {
+		PostID uint
+		RootID uint
+	}
+	if err := db.Raw(`
+		WITH RECURSIVE chain AS (
+			SELECT id AS post_id, id, reply_to_id FROM posts WHERE id IN @posts
+			UNION ALL
+			SELECT chain.post_id, posts.id, posts.reply_to_id FROM chain JOIN posts ON posts.id = chain.reply_to_id
+		)
+		SELECT post_id, id AS root_id FROM chain WHERE reply_to_id IS NULL`,
+		map[string]interface{}{"posts": postIDs}).Scan(&rows).Error; err != nil {
+		return nil, err
+	}
+
+	roots := make(map[uint]uint, len(rows))
+	for _, row := range rows {
+		roots[row.PostID] = row.RootID
+	}
+	return roots, nil
+}
+
+func userIDByUsername(db *gorm.DB, username string) (uint, error) {
+	var u models.User
+	err := db.Select("id").Where("username = ?", username).First(&u).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return 0, errors.New(constants.ErrNoUser)
+	}
+	if err != nil {
+		return 0, err
+	}
+	return u.ID, nil
+}
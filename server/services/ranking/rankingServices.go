@@ -0,0 +1,390 @@
+package ranking
+
+import (
+	"errors"
+	"fmt"
+	"gorm.io/gorm"
+	"math"
+	"sort"
+	"sync"
+	"time"
+	"x-clone/server/constants"
+	"x-clone/server/models"
+	"x-clone/server/services/timeline"
+)
+
+// ErrSnapshotExpired is returned for a cursor into an order that is no longer kept, after which the timeline has
+// to be read again from the first page.
+var ErrSnapshotExpired = errors.New("the For You timeline has changed, restart from cursor 0")
+
+// Candidate is a post competing for a place in the For You timeline of a viewer.
+type Candidate struct {
+	Post       models.Post
+	Source     models.RankingSource
+	ReplyCount int64
+	// Affinity counts the recent likes and replies of the viewer on posts of the author.
+	Affinity int64
+}
+
+// Scorer scores candidates; higher scores are shown first. Scorers must not depend on the other candidates,
+// since the diversity rules are applied afterwards.
+type Scorer interface {
+	Name() string
+	Score(candidate Candidate, now time.Time) models.RankingExplanation
+}
+
+// Ranked is a post of the For You timeline along with the explanation of its position.
+type Ranked struct {
+	Post        models.Post
+	Explanation models.RankingExplanation
+}
+
+// Viewer is who the timeline is ranked for. Anonymous viewers have a UserID of 0 and only get trending posts.
+type Viewer struct {
+	UserID   uint
+	Username string
+}
+
+// Scoring weights of EngagementScorer.
+const (
+	likeWeight      = 1.0
+	repostWeight    = 2.0
+	replyWeight     = 1.5
+	affinityWeight  = 0.5
+	recencyHalfLife = 6 * time.Hour
+)
+
+// sourceWeights favor the posts of followed accounts over the ones found further away.
+var sourceWeights = map[models.RankingSource]float64{
+	models.SourceFollow:   1.0,
+	models.SourceNetwork:  0.7,
+	models.SourceTrending: 0.5,
+}
+
+// EngagementScorer is the default scorer: the engagement of a post, boosted by the affinity of the viewer
+// with its author, halved every recencyHalfLife and weighted by the source of the candidate.
+type EngagementScorer struct{}
+
+func (EngagementScorer) Name() string {
+	return "engagement"
+}
+
+func (EngagementScorer) Score(candidate Candidate, now time.Time) models.RankingExplanation {
+	post := candidate.Post
+	engagement := likeWeight*float64(post.LikesCount) + repostWeight*float64(post.RepostsCount) +
+		replyWeight*float64(candidate.ReplyCount)
+	recency := math.Exp2(-now.Sub(post.CreatedAt).Hours() / recencyHalfLife.Hours())
+	affinity := 1 + affinityWeight*math.Log1p(float64(candidate.Affinity))
+	sourceWeight := sourceWeights[candidate.Source]
+
+	return models.RankingExplanation{
+		Scorer:       EngagementScorer{}.Name(),
+		Source:       candidate.Source,
+		Score:        (1 + math.Log1p(engagement)) * recency * affinity * sourceWeight,
+		Engagement:   engagement,
+		Recency:      recency,
+		Affinity:     affinity,
+		SourceWeight: sourceWeight,
+	}
+}
+
+// Rank returns a page of the For You timeline of the viewer. The candidates are the recent posts of the
+// accounts the viewer follows, of the accounts those follow and the trending ones. Replies, reposts and the
+// posts of the viewer are left out. It pages like timeline.Page.
+//
+// The order is computed for the first page and kept for ForYouSnapshotTTL, so that the next pages neither
+// repeat nor skip posts while the scores move. Posts deleted since are left out. When since is set, only the
+// posts newer than it are ranked, and the order is computed again whenever since changes. The next pages fail
+// with ErrSnapshotExpired once the order expired, was computed for another since or does not hold the cursor.
+func Rank(db *gorm.DB, viewer Viewer, scorer Scorer, limit int, cursor uint,
+	since timeline.Since) ([]Ranked, uint, error) {
+	now := time.Now()
+	order, ok := snapshots.get(viewer.UserID, since, now)
+	if cursor != 0 && !ok {
+		return nil, 0, ErrSnapshotExpired
+	}
+	if cursor == 0 {
+		ranked, err := rankAll(db, viewer, scorer, since, now)
+		if err != nil {
+			return nil, 0, fmt.Errorf("internal server error: %w", err)
+		}
+		order = make([]rankedID, len(ranked))
+		for i, r := range ranked {
+			order[i] = rankedID{PostID: r.Post.ID, Explanation: r.Explanation}
+		}
+		snapshots.put(viewer.UserID, order, since, now)
+	}
+
+	start := 0
+	if cursor != 0 {
+		start = -1
+		for i, r := range order {
+			if r.PostID == cursor {
+				start = i + 1
+				break
+			}
+		}
+		if start < 0 {
+			return nil, 0, ErrSnapshotExpired
+		}
+	}
+	end := start + limit
+	if end > len(order) {
+		end = len(order)
+	}
+	page := order[start:end]
+
+	var nextCursor uint
+	if end < len(order) && len(page) > 0 {
+		nextCursor = page[len(page)-1].PostID
+	}
+
+	ranked, err := loadRanked(db, page)
+	if err != nil {
+		return nil, 0, fmt.Errorf("internal server error: %w", err)
+	}
+	return ranked, nextCursor, nil
+}
+
+// rankAll scores every candidate and orders them for the viewer.
+func rankAll(db *gorm.DB, viewer Viewer, scorer Scorer, since timeline.Since, now time.Time) ([]Ranked, error) {
+	candidates, err := gatherCandidates(db, viewer, since)
+	if err != nil {
+		return nil, err
+	}
+
+	ranked := make([]Ranked, len(candidates))
+	for i, candidate := range candidates {
+		ranked[i] = Ranked{Post: candidate.Post, Explanation: scorer.Score(candidate, now)}
+	}
+	sort.SliceStable(ranked, func(i, j int) bool {
+		return ranked[i].Explanation.Score > ranked[j].Explanation.Score
+	})
+	ranked = diversify(ranked)
+	if len(ranked) > constants.ForYouMaxResults {
+		ranked = ranked[:constants.ForYouMaxResults]
+	}
+	return ranked, nil
+}
+
+// loadRanked loads the posts of a page of a snapshot, in the order of the snapshot.
+func loadRanked(db *gorm.DB, page []rankedID) ([]Ranked, error) {
+	ranked := make([]Ranked, 0, len(page))
+	if len(page) == 0 {
+		return ranked, nil
+	}
+	ids := make([]uint, len(page))
+	for i, r := range page {
+		ids[i] = r.PostID
+	}
+
+	var posts []models.Post
+	if err := db.Scopes(models.WithPostRelations).Where("id IN ?", ids).Find(&posts).Error; err != nil {
+		return nil, err
+	}
+	byID := make(map[uint]models.Post, len(posts))
+	for _, post := range posts {
+		byID[post.ID] = post
+	}
+	for _, r := range page {
+		if post, ok := byID[r.PostID]; ok {
+			ranked = append(ranked, Ranked{Post: post, Explanation: r.Explanation})
+		}
+	}
+	return ranked, nil
+}
+
+type rankedID struct {
+	PostID      uint
+	Explanation models.RankingExplanation
+}
+
+type snapshot struct {
+	order   []rankedID
+	since   timeline.Since
+	expires time.Time
+}
+
+// snapshotCache keeps the order of the For You timeline of each viewer while they page through it. It holds at
+// most ForYouSnapshotMaxViewers snapshots, dropping the expired ones first and then all of them when full.
+type snapshotCache struct {
+	mu      sync.Mutex
+	viewers map[uint]snapshot
+}
+
+var snapshots = snapshotCache{viewers: make(map[uint]snapshot)}
+
+func (c *snapshotCache) get(viewerID uint, since timeline.Since, now time.Time) ([]rankedID, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	s, ok := c.viewers[viewerID]
+	if !ok || now.After(s.expires) || s.since.ID != since.ID || !s.since.Time.Equal(since.Time) {
+		return nil, false
+	}
+	return s.order, true
+}
+
+func (c *snapshotCache) put(viewerID uint, order []rankedID, since timeline.Since, now time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if len(c.viewers) >= constants.ForYouSnapshotMaxViewers {
+		for id, s := range c.viewers {
+			if now.After(s.expires) {
+				delete(c.viewers, id)
+			}
+		}
+		if len(c.viewers) >= constants.ForYouSnapshotMaxViewers {
+			c.viewers = make(map[uint]snapshot)
+		}
+	}
+	c.viewers[viewerID] = snapshot{order: order, since: since, expires: now.Add(constants.ForYouSnapshotTTL)}
+}
+
+// diversify keeps at most ForYouMaxPerAuthor posts per author near the top, moving the others to the end,
+// and avoids showing two posts of the same author in a row when another post can be put in between.
+func diversify(ranked []Ranked) []Ranked {
+	perAuthor := make(map[uint]int)
+	kept := make([]Ranked, 0, len(ranked))
+	var demoted []Ranked
+	for _, r := range ranked {
+		perAuthor[r.Post.UserID]++
+		if perAuthor[r.Post.UserID] > constants.ForYouMaxPerAuthor {
+			r.Explanation.Rules = append(r.Explanation.Rules, "demoted: too many posts by the same author")
+			demoted = append(demoted, r)
+			continue
+		}
+		kept = append(kept, r)
+	}
+
+	for i := 1; i < len(kept); i++ {
+		if kept[i].Post.UserID != kept[i-1].Post.UserID {
+			continue
+		}
+		for j := i + 1; j < len(kept); j++ {
+			if kept[j].Post.UserID != kept[i-1].Post.UserID {
+				moved := kept[j]
+				moved.Explanation.Rules = append(moved.Explanation.Rules, "moved up: separates posts by the same author")
+				copy(kept[i+1:j+1], kept[i:j])
+				kept[i] = moved
+				break
+			}
+		}
+	}
+
+	return append(kept, demoted...)
+}
+
+type candidateSource struct {
+	source models.RankingSource
+	query  *gorm.DB
+}
+
+func gatherCandidates(db *gorm.DB, viewer Viewer, since timeline.Since) ([]Candidate, error) {
+	window := time.Now().Add(-constants.ForYouWindow)
+	recent := func() *gorm.DB {
+		return db.Scopes(models.WithPostRelations, models.WithoutBlocked(viewer.UserID), models.WithoutMuted(viewer.UserID),
+			since.Scope).
+			Where("kind IN ? AND created_at > ? AND user_id <> ?",
+				[]models.PostKind{models.KindOriginal, models.KindQuote}, window, viewer.UserID).
+			Limit(constants.ForYouCandidatesPerSource)
+	}
+
+	var sources []candidateSource
+	if viewer.UserID != 0 {
+		followed := db.Model(&models.User{}).Select("users.id").
+			Joins("JOIN follows ON follows.followed_username = users.username AND follows.deleted_at IS NULL").
+			Where("follows.following_username = ?", viewer.Username)
+		network := db.Table("follows AS direct").Select("users.id").
+			Joins(`JOIN follows AS indirect ON indirect.following_username = direct.followed_username
+				AND indirect.deleted_at IS NULL`).
+			Joins("JOIN users ON users.username = indirect.followed_username").
+			Where("direct.following_username = ? AND direct.deleted_at IS NULL", viewer.Username)
+
+		sources = append(sources,
+			candidateSource{models.SourceFollow, recent().Where("user_id IN (?)", followed).Order("id desc")},
+			candidateSource{models.SourceNetwork, recent().Where("user_id IN (?) AND user_id NOT IN (?)", network, followed).
+				Order("likes_count + reposts_count desc")})
+	}
+	sources = append(sources,
+		candidateSource{models.SourceTrending, recent().Order("likes_count + reposts_count desc, id desc")})
+
+	// A post found by several sources keeps the first one, which is the closest to the viewer.
+	seen := make(map[uint]bool)
+	var candidates []Candidate
+	for _, s := range sources {
+		var posts []models.Post
+		if err := s.query.Find(&posts).Error; err != nil {
+			return nil, err
+		}
+		for _, post := range posts {
+			if !seen[post.ID] {
+				seen[post.ID] = true
+				candidates = append(candidates, Candidate{Post: post, Source: s.source})
+			}
+		}
+	}
+
+	if err := fillSignals(db, viewer, candidates); err != nil {
+		return nil, err
+	}
+	return candidates, nil
+}
+
+// fillSignals loads the reply counts of the candidates and the affinity of the viewer with their authors.
+func fillSignals(db *gorm.DB, viewer Viewer, candidates []Candidate) error {
+	if len(candidates) == 0 {
+		return nil
+	}
+	postIDs := make([]uint, len(candidates))
+	authorIDs := make([]uint, len(candidates))
+	for i, candidate := range candidates {
+		postIDs[i] = candidate.Post.ID
+		authorIDs[i] = candidate.Post.UserID
+	}
+
+	var replies []struct {
+		PostID uint
+		Count  int64
+	}
+	if err := db.Model(&models.Post{}).Select("reply_to_id AS post_id, COUNT(*) AS count").
+		Where("reply_to_id IN ?", postIDs).Group("reply_to_id").Scan(&replies).Error; err != nil {
+		return err
+	}
+	replyCounts := make(map[uint]int64, len(replies))
+	for _, r := range replies {
+		replyCounts[r.PostID] = r.Count
+	}
+
+	affinities := make(map[uint]int64)
+	if viewer.UserID != 0 {
+		var rows []struct {
+			AuthorID uint
+			Count    int64
+		}
+		if err := db.Raw(`
+			SELECT author_id, COUNT(*) AS count FROM (
+				SELECT posts.user_id AS author_id FROM likes JOIN posts ON posts.id = likes.post_id
+				WHERE likes.user_id = @viewer AND likes.created_at > @since AND posts.user_id IN @authors
+				UNION ALL
+				SELECT parent.user_id FROM posts reply JOIN posts parent ON parent.id = reply.reply_to_id
+				WHERE reply.user_id = @viewer AND reply.created_at > @since AND parent.user_id IN @authors
+			) AS interactions
+			GROUP BY author_id`,
+			map[string]interface{}{
+				"viewer":  viewer.UserID,
+				"since":   time.Now().Add(-constants.ForYouAffinityWindow),
+				"authors": authorIDs,
+			}).Scan(&rows).Error; err != nil {
+			return err
+		}
+		for _, row := range rows {
+			affinities[row.AuthorID] = row.Count
+		}
+	}
+
+	for i := range candidates {
+		candidates[i].ReplyCount = replyCounts[candidates[i].Post.ID]
+		candidates[i].Affinity = affinities[candidates[i].Post.UserID]
+	}
+	return nil
+}
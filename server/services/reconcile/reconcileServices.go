@@ -0,0 +1,155 @@
+package reconcile
+
+import (
+	"fmt"
+	"gorm.io/gorm"
+	"log"
+	"time"
+)
+
+// counter describes a denormalized column and the query computing its real value for a row of table.
+type counter struct {
+	table  string
+	column string
+	actual string
+}
+
+// counters are checked in this order. Every actual query is a correlated subquery on the row being checked,
+// so fixing a counter never overwrites a concurrent increment with a stale value.
+var counters = []counter{
+	{
+		table:  "posts",
+		column: "likes_count",
+		actual: `SELECT COUNT(*) FROM likes WHERE likes.post_id = posts.id`,
+	},
+	{
+		table:  "posts",
+		column: "reposts_count",
+		actual: `SELECT COUNT(*) FROM posts shares
+			WHERE shares.quoted_post_id = posts.id AND shares.kind IN ('repost', 'quote')`,
+	},
+	{
+		table:  "users",
+		column: "follower_count",
+		actual: `SELECT COUNT(*) FROM follows
+			WHERE follows.followed_username = users.username AND follows.deleted_at IS NULL`,
+	},
+	{
+		table:  "communities",
+		column: "member_count",
+		actual: `SELECT COUNT(*) FROM community_members WHERE community_members.community_id = communities.id`,
+	},
+}
+
+type Discrepancy struct {
+	Table  string `json:"table"`
+	ID     uint   `json:"id"`
+	Column string `json:"column"`
+	Stored int64  `json:"stored"`
+	Actual int64  `json:"actual"`
+}
+
+type Report struct {
+	Checked       int64         `json:"checked"`
+	Discrepancies []Discrepancy `json:"discrepancies"`
+	Fixed         int64         `json:"fixed"`
+}
+
+type Options struct {
+	// Fix rewrites the drifted counters; without it the job only reports them.
+	Fix       bool
+	BatchSize int
+}
+
+// Run recomputes every counter from the likes, posts, follows and community_members tables, walking each
+// table by ID in batches so no query holds locks on the whole table.
+func Run(db *gorm.DB, opts Options) (*Report, error) {
+	report := &Report{Discrepancies: []Discrepancy{}}
+	for _, c := range counters {
+		if err := c.run(db, opts, report); err != nil {
+			return report, fmt.Errorf("failed to reconcile %s.%s: %w", c.table, c.column, err)
+		}
+	}
+	return report, nil
+}
+
+func (c counter) run(db *gorm.DB, opts Options, report *Report) error {
+	var afterID uint
+	for {
+		var rows []struct {
+			ID     uint
+			Stored int64
+			Actual int64
+		}
+		err := db.Raw(fmt.Sprintf(`
+			SELECT id, %[2]s AS stored, (%[3]s) AS actual
+			FROM %[1]s
+			WHERE id > ?%[4]s
+			ORDER BY id
+			LIMIT ?`, c.table, c.column, c.actual, c.softDeleteFilter()), afterID, opts.BatchSize).
+			Scan(&rows).Error
+		if err != nil {
+			return err
+		}
+		if len(rows) == 0 {
+			return nil
+		}
+
+		var drifted []uint
+		for _, row := range rows {
+			report.Checked++
+			if row.Stored != row.Actual {
+				report.Discrepancies = append(report.Discrepancies, Discrepancy{
+					Table:  c.table,
+					ID:     row.ID,
+					Column: c.column,
+					Stored: row.Stored,
+					Actual: row.Actual,
+				})
+				drifted = append(drifted, row.ID)
+			}
+		}
+		afterID = rows[len(rows)-1].ID
+
+		if opts.Fix && len(drifted) > 0 {
+			result := db.Exec(fmt.Sprintf(`UPDATE %[1]s SET %[2]s = (%[3]s) WHERE id IN ?`,
+				c.table, c.column, c.actual), drifted)
+			if result.Error != nil {
+				return result.Error
+			}
+			report.Fixed += result.RowsAffected
+		}
+	}
+}
+
+func (c counter) softDeleteFilter() string {
+	if c.table == "users" {
+		return " AND deleted_at IS NULL"
+	}
+	return ""
+}
+
+// LogReport prints a summary of the report, with one line per discrepancy.
+func LogReport(report *Report) {
+	for _, d := range report.Discrepancies {
+		log.Printf("Counter drift: %s %d %s stored %d, actual %d", d.Table, d.ID, d.Column, d.Stored, d.Actual)
+	}
+	log.Printf("Counter reconciliation: %d rows checked, %d discrepancies, %d fixed",
+		report.Checked, len(report.Discrepancies), report.Fixed)
+}
+
+// Schedule runs the job in the background every interval, logging what it finds.
+func Schedule(db *gorm.DB, interval time.Duration, opts Options) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for range ticker.C {
+			report, err := Run(db, opts)
+			if err != nil {
+				log.Println("Counter reconciliation failed:", err)
+				continue
+			}
+			LogReport(report)
+		}
+	}()
+}
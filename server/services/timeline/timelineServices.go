@@ -0,0 +1,215 @@
+package timeline
+
+import (
+	"fmt"
+	"gorm.io/gorm"
+	"time"
+	"x-clone/server/constants"
+	"x-clone/server/models"
+)
+
+// FanOut writes a new post to the home timeline of its author and of their followers. Posts of accounts with
+// at least FanOutMaxFollowers followers only go to their author, and are merged into the timelines of their
+// followers when those are read. Which of the two happened is stored on the post, so that its followers keep
+// seeing it once the follower count of the author crosses the threshold either way.
+func FanOut(db *gorm.DB, post models.Post) error {
+	var author models.User
+	if err := db.Select("id", "username", "follower_count").First(&author, post.UserID).Error; err != nil {
+		return err
+	}
+
+	if err := db.Exec(`
+		INSERT INTO timeline_entries (user_id, post_id, author_id, created_at)
+		VALUES (@author, @post, @author, @createdAt)
+		ON CONFLICT DO NOTHING`,
+		map[string]interface{}{"author": author.ID, "post": post.ID, "createdAt": post.CreatedAt}).Error; err != nil {
+		return err
+	}
+	if author.FollowerCount >= constants.FanOutMaxFollowers {
+		return nil
+	}
+
+	if err := db.Model(&models.Post{}).Where("id = ?", post.ID).Update("fanned_out", true).Error; err != nil {
+		return err
+	}
+	return db.Exec(`
+		INSERT INTO timeline_entries (user_id, post_id, author_id, created_at)
+		SELECT followers.id, @post, @author, @createdAt
+		FROM follows
+		JOIN users followers ON followers.username = follows.following_username
+		WHERE follows.followed_username = @username AND follows.deleted_at IS NULL
+		ON CONFLICT DO NOTHING`,
+		map[string]interface{}{
+			"author":    author.ID,
+			"post":      post.ID,
+			"createdAt": post.CreatedAt,
+			"username":  author.Username,
+		}).Error
+}
+
+// Backfill copies the latest fanned out posts of a followed account to the timeline of its new follower. The
+// others are merged on read.
+func Backfill(db *gorm.DB, followerUsername, followedUsername string) error {
+	return db.Exec(`
+		INSERT INTO timeline_entries (user_id, post_id, author_id, created_at)
+		SELECT follower.id, recent.id, recent.user_id, recent.created_at
+		FROM users follower
+		JOIN users followed ON followed.username = @followed
+		CROSS JOIN LATERAL (
+			SELECT posts.id, posts.user_id, posts.created_at FROM posts
+			WHERE posts.user_id = followed.id AND posts.fanned_out
+			ORDER BY posts.id DESC
+			LIMIT @limit
+		) recent
+		WHERE follower.username = @follower
+		ON CONFLICT DO NOTHING`,
+		map[string]interface{}{
+			"follower": followerUsername,
+			"followed": followedUsername,
+			"limit":    constants.TimelineBackfillSize,
+		}).Error
+}
+
+// RemoveAuthor takes the posts of an unfollowed account off the timeline of its former follower.
+func RemoveAuthor(db *gorm.DB, followerUsername, followedUsername string) error {
+	return db.Where("user_id = (?) AND author_id = (?)",
+		db.Model(&models.User{}).Select("id").Where("username = ?", followerUsername),
+		db.Model(&models.User{}).Select("id").Where("username = ?", followedUsername)).
+		Delete(&models.TimelineEntry{}).Error
+}
+
+// RemovePostEntries takes a post off every timeline, used when the post itself is deleted.
+func RemovePostEntries(db *gorm.DB, postID uint) error {
+	return db.Where("post_id = ?", postID).Delete(&models.TimelineEntry{}).Error
+}
+
+// HomeAuthorIDs returns the users whose posts make up the home timeline of a user: the user and the accounts
+// they follow.
+func HomeAuthorIDs(db *gorm.DB, userID uint, username string) (map[uint]bool, error) {
+	var ids []uint
+	if err := db.Model(&models.User{}).
+		Joins("JOIN follows ON follows.followed_username = users.username AND follows.deleted_at IS NULL").
+		Where("follows.following_username = ?", username).
+		Pluck("users.id", &ids).Error; err != nil {
+		return nil, err
+	}
+
+	authors := map[uint]bool{userID: true}
+	for _, id := range ids {
+		authors[id] = true
+	}
+	return authors, nil
+}
+
+// Since bounds a timeline to the posts newer than a post, a time, or both, for clients polling for new posts.
+// The zero value bounds nothing.
+type Since struct {
+	ID   uint
+	Time time.Time
+}
+
+func (s Since) IsZero() bool {
+	return s.ID == 0 && s.Time.IsZero()
+}
+
+// Scope keeps the posts newer than s. Both bounds are range scans, on the primary key and on posts.created_at.
+func (s Since) Scope(db *gorm.DB) *gorm.DB {
+	if s.ID != 0 {
+		db = db.Where("posts.id > ?", s.ID)
+	}
+	if !s.Time.IsZero() {
+		db = db.Where("posts.created_at > ?", s.Time)
+	}
+	return db
+}
+
+// Page returns a page of the posts of query, newest first. The cursor is the post ID to continue after (0 for the
+// first page), and the returned cursor is 0 when there are no more pages.
+func Page(query *gorm.DB, limit int, cursor uint) ([]models.Post, uint, error) {
+	if cursor != 0 {
+		query = query.Where("posts.id < ?", cursor)
+	}
+
+	var posts []models.Post
+	if err := query.Order("posts.id desc").Limit(limit + 1).Find(&posts).Error; err != nil {
+		return nil, 0, fmt.Errorf("internal server error: %w", err)
+	}
+
+	var nextCursor uint
+	if len(posts) > limit {
+		posts = posts[:limit]
+		nextCursor = posts[limit-1].ID
+	}
+	return posts, nextCursor, nil
+}
+
+// GetHomeTimeline returns a page of the home timeline of a user newer than since: their own posts, the posts
+// fanned out to them and the posts the accounts they follow wrote while they were too large to fan out.
+func GetHomeTimeline(db *gorm.DB, userID uint, username string, limit int, cursor uint,
+	since Since) ([]models.Post, uint, error) {
+	return Page(homePosts(db, userID, username, since).Scopes(models.WithPostRelations), limit, cursor)
+}
+
+// CountNewHomePosts counts the posts of the home timeline of a user newer than since, up to NewPostsMaxCount.
+func CountNewHomePosts(db *gorm.DB, userID uint, username string, since Since) (int64, error) {
+	return countNew(db, homePosts(db, userID, username, since), userID)
+}
+
+// CountNewPosts counts the posts of the timeline of all posts newer than since, up to NewPostsMaxCount.
+func CountNewPosts(db *gorm.DB, viewerID uint, since Since) (int64, error) {
+	posts := db.Model(&models.Post{}).
+		Scopes(models.WithoutBlocked(viewerID), models.WithoutMuted(viewerID), since.Scope)
+	return countNew(db, posts, viewerID)
+}
+
+// homePosts selects the posts of the home timeline of a user newer than since. The bounds are applied to the
+// timeline entries too, so that only the newest entries of the user are read from idx_timeline_entry or
+// idx_timeline_entry_recent.
+// GetFollowedPosts returns every post of the accounts a user follows, newest first, without their own posts. It
+// backs the following search, which is not paged.
+func GetFollowedPosts(db *gorm.DB, userID uint, username string) ([]models.Post, error) {
+	var posts []models.Post
+	err := db.Scopes(models.WithPostRelations, models.WithoutBlocked(userID), models.WithoutMuted(userID)).
+		Where("posts.user_id IN (?)", followedIDs(db, username)).
+		Order("posts.id desc").
+		Find(&posts).Error
+	if err != nil {
+		return nil, fmt.Errorf("internal server error: %w", err)
+	}
+	return posts, nil
+}
+
+func followedIDs(db *gorm.DB, username string) *gorm.DB {
+	return db.Model(&models.User{}).Select("users.id").
+		Joins("JOIN follows ON follows.followed_username = users.username AND follows.deleted_at IS NULL").
+		Where("follows.following_username = ?", username)
+}
+
+func homePosts(db *gorm.DB, userID uint, username string, since Since) *gorm.DB {
+	entries := db.Model(&models.TimelineEntry{}).Select("post_id").Where("user_id = ?", userID)
+	if since.ID != 0 {
+		entries = entries.Where("post_id > ?", since.ID)
+	}
+	if !since.Time.IsZero() {
+		entries = entries.Where("created_at > ?", since.Time)
+	}
+	return db.Model(&models.Post{}).
+		Where("(posts.id IN (?) OR (posts.user_id IN (?) AND NOT posts.fanned_out))", entries, followedIDs(db, username)).
+		Scopes(models.WithoutBlocked(userID), models.WithoutMuted(userID), since.Scope)
+}
+
+// countNew counts the posts selected by a query that the viewer would be shown as new: the ones of other users,
+// the query leaving out blocked and muted users already. Counting stops at NewPostsMaxCount,
+// which is all a "new posts" banner needs and keeps the count to a short scan however far behind the client is.
+// Posts hidden by muted words or conversations are still counted, since finding them means reading every post.
+func countNew(db *gorm.DB, posts *gorm.DB, viewerID uint) (int64, error) {
+	newer := posts.Select("posts.id").
+		Where("posts.user_id <> ?", viewerID).
+		Limit(constants.NewPostsMaxCount)
+
+	var count int64
+	if err := db.Table("(?) AS newer", newer).Count(&count).Error; err != nil {
+		return 0, fmt.Errorf("internal server error: %w", err)
+	}
+	return count, nil
+}
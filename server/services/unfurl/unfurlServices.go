@@ -0,0 +1,349 @@
+package unfurl
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"golang.org/x/net/html"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"io"
+	"log"
+	"mime"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"syscall"
+	"time"
+	"x-clone/server/constants"
+	"x-clone/server/models"
+	"x-clone/server/text"
+)
+
+var (
+	ErrUnsupportedURL  = errors.New("unsupported URL")
+	ErrBlockedAddress  = errors.New("destination address is not allowed")
+	ErrTooManyRedirect = errors.New("too many redirects")
+	ErrNotHTML         = errors.New("response is not an HTML page")
+)
+
+// carrierGradeNAT is shared address space (RFC 6598) that net.IP.IsPrivate does not cover.
+var _, carrierGradeNAT, _ = net.ParseCIDR("100.64.0.0/10")
+
+// Metadata is what a page advertises about itself through OpenGraph and Twitter card tags.
+type Metadata struct {
+	Title       string
+	Description string
+	ImageURL    string
+	SiteName    string
+	CardType    string
+}
+
+// Unfurler fetches pages to build link previews. Every connection is checked after DNS resolution,
+// so neither the original host nor any redirect can reach loopback, private or link-local addresses.
+type Unfurler struct {
+	client   *http.Client
+	maxBytes int64
+	// AllowPrivateNetworks disables the address and port checks; it must only be enabled against local test servers.
+	AllowPrivateNetworks bool
+}
+
+func NewUnfurler() *Unfurler {
+	u := &Unfurler{maxBytes: constants.UnfurlMaxBodyBytes}
+
+	u.client = &http.Client{
+		Timeout:   constants.UnfurlRequestTimeout,
+		Transport: newTransport(u.checkAddress),
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if len(via) >= constants.UnfurlMaxRedirects {
+				return ErrTooManyRedirect
+			}
+			return u.validateURL(req.URL)
+		},
+	}
+
+	return u
+}
+
+// NewTransport returns a transport that refuses to connect to loopback, private or link-local addresses, checked
+// after DNS resolution, for the other features fetching URLs chosen by users or remote servers. allowPrivate
+// disables the check, which must only be done against local test servers.
+func NewTransport(allowPrivate bool) *http.Transport {
+	return newTransport(func(address string) error {
+		if allowPrivate {
+			return nil
+		}
+		return checkPublicAddress(address)
+	})
+}
+
+func newTransport(check func(address string) error) *http.Transport {
+	dialer := &net.Dialer{
+		Timeout: constants.UnfurlDialTimeout,
+		Control: func(_, address string, _ syscall.RawConn) error {
+			return check(address)
+		},
+	}
+
+	return &http.Transport{
+		Proxy:                 nil,
+		DialContext:           dialer.DialContext,
+		TLSHandshakeTimeout:   constants.UnfurlDialTimeout,
+		ResponseHeaderTimeout: constants.UnfurlRequestTimeout,
+		MaxIdleConns:          constants.UnfurlMaxIdleConns,
+		IdleConnTimeout:       constants.UnfurlRequestTimeout,
+	}
+}
+
+// Fetch downloads a page, reading at most the configured number of bytes, and parses its card metadata.
+func (u *Unfurler) Fetch(ctx context.Context, rawURL string) (*Metadata, error) {
+	parsed, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, ErrUnsupportedURL
+	}
+	if errValidate := u.validateURL(parsed); errValidate != nil {
+		return nil, errValidate
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, parsed.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", constants.UnfurlUserAgent)
+	req.Header.Set("Accept", "text/html,application/xhtml+xml")
+
+	resp, err := u.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer func(body io.ReadCloser) {
+		if errClose := body.Close(); errClose != nil {
+			log.Println("Failed to close unfurl response:", errClose)
+		}
+	}(resp.Body)
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+
+	mediaType, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	if mediaType != "text/html" && mediaType != "application/xhtml+xml" {
+		return nil, ErrNotHTML
+	}
+
+	return parseMetadata(io.LimitReader(resp.Body, u.maxBytes), resp.Request.URL), nil
+}
+
+func (u *Unfurler) checkAddress(address string) error {
+	if u.AllowPrivateNetworks {
+		return nil
+	}
+	return checkPublicAddress(address)
+}
+
+func checkPublicAddress(address string) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+
+	ip := net.ParseIP(host)
+	if ip == nil || !isPublicIP(ip) {
+		return ErrBlockedAddress
+	}
+	return nil
+}
+
+func isPublicIP(ip net.IP) bool {
+	if ip4 := ip.To4(); ip4 != nil {
+		ip = ip4
+	}
+
+	return !ip.IsLoopback() &&
+		!ip.IsPrivate() &&
+		!ip.IsLinkLocalUnicast() &&
+		!ip.IsLinkLocalMulticast() &&
+		!ip.IsInterfaceLocalMulticast() &&
+		!ip.IsMulticast() &&
+		!ip.IsUnspecified() &&
+		!carrierGradeNAT.Contains(ip) &&
+		!ip.Equal(net.IPv4bcast) &&
+		ip[0] != 0
+}
+
+// validateURL only accepts plain http(s) URLs on default ports, without embedded credentials.
+func (u *Unfurler) validateURL(target *url.URL) error {
+	if target.Scheme != "http" && target.Scheme != "https" {
+		return ErrUnsupportedURL
+	}
+	if target.Hostname() == constants.Empty || target.User != nil {
+		return ErrUnsupportedURL
+	}
+	port := target.Port()
+	if !u.AllowPrivateNetworks && port != constants.Empty && port != "80" && port != "443" {
+		return ErrUnsupportedURL
+	}
+	return nil
+}
+
+// parseMetadata reads OpenGraph and Twitter card tags from the document head, falling back to
+// <title> and the description meta tag. OpenGraph values win over Twitter ones.
+func parseMetadata(body io.Reader, pageURL *url.URL) *Metadata {
+	values := make(map[string]string)
+	var title string
+
+	tokenizer := html.NewTokenizer(body)
+	for {
+		tokenType := tokenizer.Next()
+		if tokenType == html.ErrorToken {
+			break
+		}
+
+		token := tokenizer.Token()
+		if tokenType == html.EndTagToken && token.Data == "head" {
+			break
+		}
+		if tokenType != html.StartTagToken && tokenType != html.SelfClosingTagToken {
+			continue
+		}
+
+		switch token.Data {
+		case "title":
+			if title == constants.Empty && tokenizer.Next() == html.TextToken {
+				title = strings.TrimSpace(string(tokenizer.Text()))
+			}
+		case "meta":
+			key, content := metaAttributes(token)
+			if _, seen := values[key]; key != constants.Empty && !seen {
+				values[key] = strings.TrimSpace(content)
+			}
+		}
+	}
+
+	return &Metadata{
+		Title:       firstNonEmpty(values["og:title"], values["twitter:title"], title),
+		Description: firstNonEmpty(values["og:description"], values["twitter:description"], values["description"]),
+		ImageURL:    resolveURL(pageURL, firstNonEmpty(values["og:image"], values["twitter:image"])),
+		SiteName:    firstNonEmpty(values["og:site_name"], pageURL.Hostname()),
+		CardType:    firstNonEmpty(values["twitter:card"], "summary"),
+	}
+}
+
+func metaAttributes(token html.Token) (string, string) {
+	var key, content string
+	for _, attr := range token.Attr {
+		switch strings.ToLower(attr.Key) {
+		case "property", "name":
+			if key == constants.Empty {
+				key = strings.ToLower(attr.Val)
+			}
+		case "content":
+			content = attr.Val
+		}
+	}
+	return key, content
+}
+
+func resolveURL(base *url.URL, ref string) string {
+	if ref == constants.Empty {
+		return constants.Empty
+	}
+	parsed, err := base.Parse(ref)
+	if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") {
+		return constants.Empty
+	}
+	return parsed.String()
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, v := range values {
+		if v != constants.Empty {
+			return v
+		}
+	}
+	return constants.Empty
+}
+
+// defaultUnfurler is shared by every request so connections to popular sites are reused.
+var defaultUnfurler = NewUnfurler()
+
+// GetCard returns the cached card of a URL, fetching the page again when the cache entry is stale.
+func GetCard(ctx context.Context, db *gorm.DB, rawURL string) (*models.LinkCard, error) {
+	var card models.LinkCard
+	err := db.Where("url = ?", rawURL).First(&card).Error
+	if err == nil && isFresh(card, time.Now()) {
+		if card.FetchError != constants.Empty {
+			return nil, errors.New(card.FetchError)
+		}
+		return &card, nil
+	}
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, err
+	}
+
+	card = models.LinkCard{URL: rawURL, FetchedAt: time.Now()}
+	metadata, fetchErr := defaultUnfurler.Fetch(ctx, rawURL)
+	if fetchErr != nil {
+		card.FetchError = fetchErr.Error()
+	} else {
+		card.Title = metadata.Title
+		card.Description = metadata.Description
+		card.ImageURL = metadata.ImageURL
+		card.SiteName = metadata.SiteName
+		card.CardType = metadata.CardType
+	}
+
+	if errSave := db.Clauses(clause.OnConflict{
+		Columns: []clause.Column{{Name: "url"}},
+		DoUpdates: clause.AssignmentColumns([]string{
+			"title", "description", "image_url", "site_name", "card_type", "fetched_at", "fetch_error",
+		}),
+	}).Create(&card).Error; errSave != nil {
+		return nil, errSave
+	}
+
+	if fetchErr != nil {
+		return nil, fetchErr
+	}
+	return &card, nil
+}
+
+// isFresh tells whether a cached card can still be used. Failures are only kept for UnfurlErrorCacheTTL, so
+// that a page that was slow or down once is fetched again soon.
+func isFresh(card models.LinkCard, now time.Time) bool {
+	ttl := constants.UnfurlCacheTTL
+	if card.FetchError != constants.Empty {
+		ttl = constants.UnfurlErrorCacheTTL
+	}
+	return now.Sub(card.FetchedAt) < ttl
+}
+
+// AttachCard links a post to the preview card of the first URL in its body, or clears the link when
+// the body no longer has one or the page cannot be previewed.
+func AttachCard(ctx context.Context, db *gorm.DB, postID uint, body string) error {
+	var cardID *uint
+
+	if urls := text.ExtractType(body, text.URL); len(urls) > 0 {
+		card, err := GetCard(ctx, db, urls[0].Value)
+		if err != nil {
+			log.Printf("Failed to unfurl %s: %v", urls[0].Value, err)
+		} else if card.Title != constants.Empty {
+			cardID = &card.ID
+		}
+	}
+
+	return db.Model(&models.Post{}).Where("id = ?", postID).Update("link_card_id", cardID).Error
+}
+
+// AttachCardAsync unfurls in the background so creating or editing a post never waits on a remote site.
+func AttachCardAsync(db *gorm.DB, postID uint, body string) {
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), constants.UnfurlRequestTimeout)
+		defer cancel()
+
+		if err := AttachCard(ctx, db, postID, body); err != nil {
+			log.Printf("Failed to attach link card to post %d: %v", postID, err)
+		}
+	}()
+}
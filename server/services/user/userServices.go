@@ -5,11 +5,24 @@ import (
 	"fmt"
 	"github.com/gin-gonic/gin"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 	"log"
 	"regexp"
 	"x-clone/server/constants"
 	"x-clone/server/mappers"
 	"x-clone/server/models"
+	"x-clone/server/services/analytics"
+	"x-clone/server/services/block"
+	"x-clone/server/services/bookmark"
+	"x-clone/server/services/community"
+	"x-clone/server/services/hashtag"
+	"x-clone/server/services/label"
+	"x-clone/server/services/live"
+	"x-clone/server/services/mention"
+	"x-clone/server/services/mute"
+	"x-clone/server/services/timeline"
+	"x-clone/server/services/unfurl"
+	"x-clone/server/text"
 )
 
 func FollowAccount(db *gorm.DB, followingUsername, followedUsername string) error {
@@ -21,16 +34,17 @@ func FollowAccount(db *gorm.DB, followingUsername, followedUsername string) erro
 		return errors.New("already following this user")
 	}
 
-	// 2. Create a new Follow record
+	// 2. Create a new Follow record and bring the recent posts of the followed user to the home timeline
 	follow := models.Follow{
 		FollowingUsername: followingUsername,
 		FollowedUsername:  followedUsername,
 	}
-	if err := db.Create(&follow).Error; err != nil {
-		return err // This error triggers "Failed to follow user"
-	}
-
-	return nil
+	return db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&follow).Error; err != nil {
+			return err // This error triggers "Failed to follow user"
+		}
+		return timeline.Backfill(tx, followingUsername, followedUsername)
+	})
 }
 
 func UnfollowAccount(db *gorm.DB, followingUsername, followedUsername string) error {
@@ -38,64 +52,298 @@ func UnfollowAccount(db *gorm.DB, followingUsername, followedUsername string) er
 		return errors.New("invalid ID: user cannot unfollow themselves")
 	}
 
-	result := db.Where("following_username = ? AND followed_username = ?", followingUsername, followedUsername).
-		Delete(&models.Follow{})
+	return db.Transaction(func(tx *gorm.DB) error {
+		result := tx.Where("following_username = ? AND followed_username = ?", followingUsername, followedUsername).
+			Delete(&models.Follow{})
 
-	if result.Error != nil {
-		log.Printf("Error deleting follow record: %v", result.Error)
-		return result.Error
-	}
+		if result.Error != nil {
+			log.Printf("Error deleting follow record: %v", result.Error)
+			return result.Error
+		}
 
-	if result.RowsAffected == 0 {
-		return errors.New("no follow relationship found to delete")
-	}
+		if result.RowsAffected == 0 {
+			return errors.New("no follow relationship found to delete")
+		}
 
-	return nil
+		return timeline.RemoveAuthor(tx, followingUsername, followedUsername)
+	})
 }
 
 // IsLiked Like-specific functions.
-func IsLiked(db *gorm.DB, userID uint, postID uint) bool {
+func IsLiked(db *gorm.DB, userID uint, postID uint) (bool, error) {
 	var count int64
-	db.Model(&models.Like{}).Where("user_id = ? AND post_id = ?", userID, postID).Count(&count)
-	return count > 0
+	err := db.Model(&models.Like{}).Where("user_id = ? AND post_id = ?", userID, postID).Count(&count).Error
+	return count > 0, err
 }
 
-func ToggleLike(db *gorm.DB, userID uint, postID uint) (ToggleInfo, error) {
+// LikePost likes a post; liking an already liked post changes nothing, and liking a post of a blocked user
+// fails with block.ErrBlocked. The like and the counter are
+// written in one transaction, and the unique index on likes keeps concurrent requests from counting twice.
+func LikePost(db *gorm.DB, userID uint, postID uint) error {
 	if !userExists(db, userID) {
-		return ToggleInfo{}, errors.New(constants.ErrNoUser)
+		return errors.New(constants.ErrNoUser)
 	}
 
-	var toggleResult ToggleInfo
+	changed := false
+	errTx := db.Transaction(func(tx *gorm.DB) error {
+		if err := ensurePostExists(tx, postID); err != nil {
+			return err
+		}
+		if err := ensureNotBlocked(tx, userID, postID); err != nil {
+			return err
+		}
 
-	if IsLiked(db, userID, postID) {
-		db.Where("user_id = ? AND post_id = ?", userID, postID).Delete(&models.Like{})
-		db.Model(&models.Post{}).Where("id = ?", postID).Update("likes_count", gorm.Expr("likes_count - 1"))
+		result := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&models.Like{PostID: postID, UserID: userID})
+		if result.Error != nil || result.RowsAffected == 0 {
+			return result.Error
+		}
+		changed = true
+		return tx.Model(&models.Post{}).Where("id = ?", postID).
+			Update("likes_count", gorm.Expr("likes_count + 1")).Error
+	})
+	if errTx == nil && changed {
+		live.PublishCounters(db, postID)
+	}
+	return errTx
+}
 
-		toggleResult = ToggleInfo{
-			IsLiked:       false,
-			MessageStatus: "unliked successfully",
+// UnlikePost removes a like; unliking a post that was not liked changes nothing.
+func UnlikePost(db *gorm.DB, userID uint, postID uint) error {
+	changed := false
+	errTx := db.Transaction(func(tx *gorm.DB) error {
+		result := tx.Where("user_id = ? AND post_id = ?", userID, postID).Delete(&models.Like{})
+		if result.Error != nil || result.RowsAffected == 0 {
+			return result.Error
 		}
-	} else {
-		newLike := models.Like{PostID: postID, UserID: userID}
-		db.Create(&newLike)
-		db.Model(&models.Post{}).Where("id = ?", postID).Update("likes_count", gorm.Expr("likes_count + 1"))
+		changed = true
+		return tx.Model(&models.Post{}).Where("id = ? AND likes_count > 0", postID).
+			Update("likes_count", gorm.Expr("likes_count - 1")).Error
+	})
+	if errTx == nil && changed {
+		live.PublishCounters(db, postID)
+	}
+	return errTx
+}
+
+// IsReposted tells whether the user has a plain repost of the post.
+func IsReposted(db *gorm.DB, userID uint, postID uint) (bool, error) {
+	var count int64
+	err := db.Model(&models.Post{}).
+		Where("user_id = ? AND quoted_post_id = ? AND kind = ?", userID, postID, models.KindRepost).
+		Count(&count).Error
+	return count > 0, err
+}
+
+// Repost reposts a post for the user and returns the repost, telling whether it was created. Reposting an
+// already reposted post returns the existing repost and changes nothing.
+func Repost(db *gorm.DB, userID uint, nickname, username string, postID uint) (*models.Post, bool, error) {
+	post, err := CreatePost(db, userID, nickname, username, models.KindRepost, &postID, constants.Empty,
+		models.ReplyEveryone, nil, nil)
+	if errors.Is(err, errAlreadyReposted) {
+		var existing models.Post
+		errExisting := db.Where("user_id = ? AND quoted_post_id = ? AND kind = ?", userID, postID, models.KindRepost).
+			First(&existing).Error
+		return &existing, false, errExisting
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	return post, true, nil
+}
 
-		toggleResult = ToggleInfo{
-			IsLiked:       true,
-			MessageStatus: "liked successfully",
+// Unrepost removes the plain repost of a post and returns it; removing a repost that does not exist changes
+// nothing and returns nil.
+func Unrepost(db *gorm.DB, userID uint, postID uint) (*models.Post, error) {
+	var repost models.Post
+	errTx := db.Transaction(func(tx *gorm.DB) error {
+		result := tx.Clauses(clause.Returning{Columns: []clause.Column{
+			{Name: "id"}, {Name: "user_id"}, {Name: "kind"}, {Name: "quoted_post_id"}, {Name: "activity_uri"},
+		}}).
+			Where("user_id = ? AND quoted_post_id = ? AND kind = ?", userID, postID, models.KindRepost).
+			Delete(&repost)
+		if result.Error != nil || result.RowsAffected == 0 {
+			return result.Error
 		}
+		return DecrementRepostCount(tx, postID)
+	})
+	if errTx != nil || repost.ID == 0 {
+		return nil, errTx
 	}
+	live.PublishDeletion(repost)
+	live.PublishCounters(db, postID)
+	return &repost, nil
+}
 
-	return toggleResult, nil
+// DecrementRepostCount is called when a repost or quote of the post is removed, and never goes below zero.
+func DecrementRepostCount(db *gorm.DB, postID uint) error {
+	return db.Model(&models.Post{}).Where("id = ? AND reposts_count > 0", postID).
+		Update("reposts_count", gorm.Expr("reposts_count - 1")).Error
+}
+
+// RemovePost deletes a post along with its hashtags, mentions, labels, analytics events, bookmarks, likes, pin and
+// timeline entries, and takes back the repost it counted for. The plain reposts of the post are deleted with it,
+// while its replies and quotes are kept and no longer point to it, since those references are foreign keys.
+func RemovePost(db *gorm.DB, post models.Post) error {
+	var reposts []models.Post
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("kind = ? AND quoted_post_id = ?", models.KindRepost, post.ID).
+			Find(&reposts).Error; err != nil {
+			return err
+		}
+		for _, repost := range reposts {
+			if err := removePostRows(tx, repost); err != nil {
+				return err
+			}
+		}
+		if err := tx.Model(&models.Post{}).Where("reply_to_id = ?", post.ID).
+			Update("reply_to_id", nil).Error; err != nil {
+			return err
+		}
+		if err := tx.Model(&models.Post{}).Where("quoted_post_id = ?", post.ID).
+			Update("quoted_post_id", nil).Error; err != nil {
+			return err
+		}
+		return removePostRows(tx, post)
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, repost := range reposts {
+		live.PublishDeletion(repost)
+	}
+	live.PublishDeletion(post)
+	if post.QuotedPostID != nil {
+		live.PublishCounters(db, *post.QuotedPostID)
+	}
+	return nil
+}
+
+// removePostRows deletes a post and the rows that refer to it, but not the posts that reply to or quote it.
+func removePostRows(tx *gorm.DB, post models.Post) error {
+	if err := hashtag.RemovePostHashtags(tx, post.ID); err != nil {
+		return err
+	}
+	if err := mention.RemovePostMentions(tx, post.ID); err != nil {
+		return err
+	}
+	if err := bookmark.RemovePostBookmarks(tx, post.ID); err != nil {
+		return err
+	}
+	if err := label.RemovePostLabels(tx, post.ID); err != nil {
+		return err
+	}
+	if err := analytics.RemovePostEvents(tx, post.ID); err != nil {
+		return err
+	}
+	if err := timeline.RemovePostEntries(tx, post.ID); err != nil {
+		return err
+	}
+	if err := mute.RemovePostConversations(tx, post.ID); err != nil {
+		return err
+	}
+	if err := ClearPinnedPost(tx, post.ID); err != nil {
+		return err
+	}
+	if err := tx.Where("post_id = ?", post.ID).Delete(&models.Like{}).Error; err != nil {
+		return err
+	}
+	if post.QuotedPostID != nil {
+		if err := DecrementRepostCount(tx, *post.QuotedPostID); err != nil {
+			return err
+		}
+	}
+	return tx.Delete(&post).Error
+}
+
+// ensureNotBlocked fails with block.ErrBlocked when the user and the author of the post blocked each other.
+func ensureNotBlocked(db *gorm.DB, userID, postID uint) error {
+	var post models.Post
+	if err := db.Select("user_id").First(&post, postID).Error; err != nil {
+		return err
+	}
+	blocked, err := block.IsBlocked(db, userID, post.UserID)
+	if err != nil {
+		return err
+	}
+	if blocked {
+		return block.ErrBlocked
+	}
+	return nil
+}
+
+func ensurePostExists(db *gorm.DB, postID uint) error {
+	var count int64
+	if err := db.Model(&models.Post{}).Where("id = ?", postID).Count(&count).Error; err != nil {
+		return err
+	}
+	if count == 0 {
+		return errors.New(constants.ErrNoPost)
+	}
+	return nil
+}
+
+// GetUsersByIDs loads many users at once; unknown IDs are left out.
+func GetUsersByIDs(db *gorm.DB, userIDs []uint) ([]models.User, error) {
+	var users []models.User
+	if len(userIDs) == 0 {
+		return users, nil
+	}
+	if err := db.Where("id IN ?", userIDs).Find(&users).Error; err != nil {
+		return nil, fmt.Errorf("internal server error: %w", err)
+	}
+	return users, nil
+}
+
+// PostState gathers the counters of a post and the flags of the viewer, which are false for anonymous viewers.
+type PostState struct {
+	PostID        uint  `json:"post_id"`
+	LikesCount    int64 `json:"likes_count"`
+	RepostsCount  int64 `json:"reposts_count"`
+	CommentsCount int64 `json:"comments_count"`
+	Liked         bool  `json:"liked"`
+	Reposted      bool  `json:"reposted"`
+	Bookmarked    bool  `json:"bookmarked"`
+}
+
+// GetPostStates returns the state of many posts in a single query. Unknown post IDs are left out.
+func GetPostStates(db *gorm.DB, viewerID uint, postIDs []uint) ([]PostState, error) {
+	states := []PostState{}
+	if len(postIDs) == 0 {
+		return states, nil
+	}
+
+	err := db.Raw(`
+		SELECT posts.id AS post_id, posts.likes_count, posts.reposts_count,
+		       (SELECT COUNT(*) FROM posts replies WHERE replies.reply_to_id = posts.id) AS comments_count,
+		       EXISTS (SELECT 1 FROM likes
+		               WHERE likes.post_id = posts.id AND likes.user_id = @viewerID) AS liked,
+		       EXISTS (SELECT 1 FROM posts reposts
+		               WHERE reposts.quoted_post_id = posts.id AND reposts.user_id = @viewerID
+		               AND reposts.kind = @repost) AS reposted,
+		       EXISTS (SELECT 1 FROM bookmarks
+		               WHERE bookmarks.post_id = posts.id AND bookmarks.user_id = @viewerID) AS bookmarked
+		FROM posts
+		WHERE posts.id IN @postIDs
+		ORDER BY posts.id`,
+		map[string]interface{}{
+			"viewerID": viewerID,
+			"postIDs":  postIDs,
+			"repost":   models.KindRepost,
+		}).Scan(&states).Error
+	if err != nil {
+		return nil, fmt.Errorf("internal server error: %w", err)
+	}
+	return states, nil
 }
 
 // searchPostsByKeywords is a helper.
-func searchPostsByKeywords(db *gorm.DB, keyword, orderBy string) ([]mappers.PostResponse, error) {
+func searchPostsByKeywords(db *gorm.DB, viewerID uint, keyword, orderBy string) ([]mappers.PostResponse, error) {
 	var rawPosts []models.Post
 	var result *gorm.DB
 
 	// Start building the query with Preload to fetch ParentPost
-	query := db.Preload("ParentPost")
+	query := db.Scopes(models.WithPostRelations, models.WithoutBlocked(viewerID), models.WithoutMuted(viewerID))
 
 	switch {
 	case keyword == constants.Empty:
@@ -138,12 +386,12 @@ func searchPostsByKeywords(db *gorm.DB, keyword, orderBy string) ([]mappers.Post
 	return processedPosts, nil
 }
 
-func SearchPostsByKeywords(db *gorm.DB, keyword string) ([]mappers.PostResponse, error) {
-	return searchPostsByKeywords(db, keyword, "likes_count DESC")
+func SearchPostsByKeywords(db *gorm.DB, viewerID uint, keyword string) ([]mappers.PostResponse, error) {
+	return searchPostsByKeywords(db, viewerID, keyword, "likes_count DESC")
 }
 
-func SearchPostsByKeywordsSortedByLatest(db *gorm.DB, keyword string) ([]mappers.PostResponse, error) {
-	return searchPostsByKeywords(db, keyword, "created_at DESC")
+func SearchPostsByKeywordsSortedByLatest(db *gorm.DB, viewerID uint, keyword string) ([]mappers.PostResponse, error) {
+	return searchPostsByKeywords(db, viewerID, keyword, "created_at DESC")
 }
 
 func SearchUsersByUsername(db *gorm.DB, username string) ([]mappers.Response, error) {
@@ -184,12 +432,15 @@ func SearchUniqueMailUsername(db *gorm.DB, field string, value string) (bool, er
 	return count > 0, nil
 }
 
-func GetAllPosts(db *gorm.DB) ([]models.Post, error) {
-	var posts []models.Post
+// GetAllPosts returns every post newer than since the viewer may see, newest first. Having no posts at all is an
+// error, while having no new posts is not.
+func GetAllPosts(db *gorm.DB, viewerID uint, since timeline.Since) ([]models.Post, error) {
+	posts := []models.Post{}
 
 	// Ensure ParentPost is loaded to support reposts
-	result := db.Preload("ParentPost").Order("created_at desc").Find(&posts)
-	if result.RowsAffected == 0 {
+	result := db.Scopes(models.WithPostRelations, models.WithoutBlocked(viewerID), models.WithoutMuted(viewerID),
+		since.Scope).Order("created_at desc").Find(&posts)
+	if result.RowsAffected == 0 && since.IsZero() {
 		return nil, gorm.ErrRecordNotFound
 	}
 	if result.Error != nil {
@@ -210,7 +461,7 @@ func GetAllPostsByUsername(db *gorm.DB, username string) ([]models.Post, error)
 		return nil, fmt.Errorf("internal server error: %w", err)
 	}
 
-	result := db.Preload("ParentPost").Where("user_id = ?", user.ID).Order("created_at desc").Find(&posts)
+	result := db.Scopes(models.WithPostRelations).Where("user_id = ?", user.ID).Order("created_at desc").Find(&posts)
 	if result.Error != nil {
 		return nil, fmt.Errorf("internal server error: %w", result.Error)
 	}
@@ -230,11 +481,9 @@ func GetAllRepliesByUsername(db *gorm.DB, username string) ([]models.Post, error
 		return nil, fmt.Errorf("internal server error: %w", err)
 	}
 
-	// Fetch posts where IsRepost is false and ParentID is not nil
-	result := db.Preload("ParentPost").
-		Where("user_id = ?", user.ID).
-		Where("is_repost = ?", false).  // Ensure it's not a repost
-		Where("parent_id IS NOT NULL"). // Ensure ParentID is not nil
+	// Fetch the replies of the user
+	result := db.Scopes(models.WithPostRelations).
+		Where("user_id = ? AND kind = ?", user.ID, models.KindReply).
 		Order("created_at desc").
 		Find(&posts)
 
@@ -259,7 +508,7 @@ func PostsWLikesByUsername(db *gorm.DB, username string) ([]models.Post, error)
 
 	// Fetch the posts liked by the user
 	result := db.Joins("JOIN likes ON likes.post_id = posts.id").
-		Preload("ParentPost").
+		Scopes(models.WithPostRelations).
 		Where("likes.user_id = ?", user.ID).
 		Order("posts.created_at desc").
 		Find(&posts)
@@ -271,46 +520,151 @@ func PostsWLikesByUsername(db *gorm.DB, username string) ([]models.Post, error)
 	return posts, nil
 }
 
+// CreatePost saves a post of the given kind. The referenced post is the one answered by a reply or shared by
+// a repost or quote, and is ignored for original posts. The audience limits who can reply to the post, and
+// the labels are the content warnings added by the author. The community is only used for original posts,
+// since replies always join the community of the post they answer. Referencing a post of a user who blocked
+// the author, or whom the author blocked, fails with block.ErrBlocked, and replying outside the reply audience
+// of the post fails with ErrReplyNotAllowed.
 func CreatePost(db *gorm.DB,
 	userID uint,
 	nickname string,
-	parentID *uint,
 	username string,
-	quote *string,
+	kind models.PostKind,
+	referencedPostID *uint,
 	body string,
-	isRepost bool) (*models.Post, error) {
+	audience models.ReplyAudience,
+	labels []models.ContentLabel,
+	communityID *uint) (*models.Post, error) {
+	post := models.Post{
+		UserID:        userID,
+		Username:      username,
+		Nickname:      nickname,
+		Kind:          kind,
+		Body:          body,
+		ReplyAudience: audience,
+	}
+	return insertPost(db, post, referencedPostID, labels, communityID)
+}
+
+// CreateRemotePost saves a post received from another server along with its ActivityPub ID, in the same insert,
+// so that a note delivered twice at the same time is only stored once. It fails with ErrPostAlreadyStored when
+// a post with that ID exists, and like CreatePost otherwise.
+func CreateRemotePost(db *gorm.DB,
+	userID uint,
+	nickname string,
+	username string,
+	kind models.PostKind,
+	replyToID *uint,
+	body string,
+	labels []models.ContentLabel,
+	activityURI string) (*models.Post, error) {
+	post := models.Post{
+		UserID:        userID,
+		Username:      username,
+		Nickname:      nickname,
+		Kind:          kind,
+		Body:          body,
+		ReplyAudience: models.ReplyEveryone,
+		ActivityURI:   &activityURI,
+	}
+	return insertPost(db, post, replyToID, labels, nil)
+}
+
+func insertPost(db *gorm.DB,
+	post models.Post,
+	referencedPostID *uint,
+	labels []models.ContentLabel,
+	communityID *uint) (*models.Post, error) {
+	userID, kind := post.UserID, post.Kind
 	if !userExists(db, userID) {
 		return nil, errors.New(constants.ErrNoUser)
 	}
 
-	post := models.Post{
-		UserID:   userID,
-		Username: username,
-		Nickname: nickname,
-		ParentID: parentID,
-		Quote:    quote,
-		Body:     body,
-		IsRepost: isRepost,
+	var referenced models.Post
+	if kind != models.KindOriginal && referencedPostID != nil {
+		err := db.Select("id", "user_id", "username", "reply_audience", "community_id").
+			First(&referenced, *referencedPostID).Error
+		if err != nil {
+			return nil, err
+		}
+		blocked, err := block.IsBlocked(db, userID, referenced.UserID)
+		if err != nil {
+			return nil, err
+		}
+		if blocked {
+			return nil, block.ErrBlocked
+		}
+	}
+	if kind == models.KindReply && referencedPostID != nil {
+		allowed, err := CanReply(db, userID, post.Username, referenced)
+		if err != nil {
+			return nil, err
+		}
+		if !allowed {
+			return nil, ErrReplyNotAllowed
+		}
 	}
 
-	if err := db.Create(&post).Error; err != nil {
-		return nil, err
+	switch kind {
+	case models.KindReply:
+		post.ReplyToID = referencedPostID
+		post.CommunityID = referenced.CommunityID
+	case models.KindRepost, models.KindQuote:
+		post.QuotedPostID = referencedPostID
+	case models.KindOriginal:
+		post.CommunityID = communityID
+	}
+
+	errTx := db.Transaction(func(tx *gorm.DB) error {
+		// A user has at most one plain repost of a post, and a remote note is stored once, which unique indexes
+		// enforce
+		result := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&post)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 && post.ActivityURI != nil {
+			return ErrPostAlreadyStored
+		}
+		if result.RowsAffected == 0 {
+			return errAlreadyReposted
+		}
+		if post.QuotedPostID != nil {
+			if err := tx.Model(&models.Post{}).Where("id = ?", *post.QuotedPostID).
+				Update("reposts_count", gorm.Expr("reposts_count + 1")).Error; err != nil {
+				return err
+			}
+		}
+		if err := label.AddLabels(tx, post.ID, userID, false, labels); err != nil {
+			return err
+		}
+		if err := timeline.FanOut(tx, post); err != nil {
+			return err
+		}
+		if err := hashtag.SyncPostHashtags(tx, &post); err != nil {
+			return err
+		}
+		return mention.SyncPostMentions(tx, &post)
+	})
+	if errTx != nil {
+		return nil, errTx
 	}
 	// Ensure ID is assigned after creation
 	if post.ID == 0 {
 		return nil, errors.New("failed to create post: ID not assigned")
 	}
+	if len(text.ExtractType(post.Body, text.URL)) > 0 {
+		unfurl.AttachCardAsync(db, post.ID, post.Body)
+	}
+	live.PublishPost(post)
+	if post.QuotedPostID != nil {
+		live.PublishCounters(db, *post.QuotedPostID)
+	}
 	return &post, nil
 }
 
 // AUX.
 
-type ToggleInfo struct {
-	IsLiked       bool
-	IsReposted    bool
-	MessageStatus string
-}
-
 func MailAlreadyUsed(db *gorm.DB, mail string) bool {
 	var user models.User
 	err := db.Where("Mail = ?", mail).First(&user).Error
@@ -379,6 +733,206 @@ func GetSimplePostByID(db *gorm.DB, postID uint) (models.Post, error) {
 	return post, nil
 }
 
+var ErrCannotPinPost = errors.New("only your own posts can be pinned")
+
+// PinPost features one of the user's own posts on their profile, replacing any previously pinned post.
+func PinPost(db *gorm.DB, userID, postID uint) error {
+	post, err := GetSimplePostByID(db, postID)
+	if err != nil {
+		return err
+	}
+	if post.UserID != userID || post.Kind == models.KindRepost {
+		return ErrCannotPinPost
+	}
+
+	return db.Model(&models.User{}).Where("id = ?", userID).Update("pinned_post_id", postID).Error
+}
+
+// UnpinPost removes the pinned post of the user if it is the given one.
+func UnpinPost(db *gorm.DB, userID, postID uint) error {
+	return db.Model(&models.User{}).
+		Where("id = ? AND pinned_post_id = ?", userID, postID).
+		Update("pinned_post_id", nil).Error
+}
+
+// ClearPinnedPost unpins a post from whichever profile features it, used when the post is deleted.
+func ClearPinnedPost(db *gorm.DB, postID uint) error {
+	return db.Model(&models.User{}).Where("pinned_post_id = ?", postID).Update("pinned_post_id", nil).Error
+}
+
+// GetPinnedPost returns the post pinned by a user; the boolean is false when there is none.
+func GetPinnedPost(db *gorm.DB, u models.User) (models.Post, bool, error) {
+	var post models.Post
+	if u.PinnedPostID == nil {
+		return post, false, nil
+	}
+
+	err := db.Scopes(models.WithPostRelations).First(&post, *u.PinnedPostID).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return post, false, nil
+	}
+	if err != nil {
+		return post, false, err
+	}
+	return post, true, nil
+}
+
+// errAlreadyReposted is returned by CreatePost when the user already reposted the post.
+var errAlreadyReposted = errors.New("post already reposted")
+
+// ErrPostAlreadyStored is returned by CreateRemotePost when the note was already received.
+var ErrPostAlreadyStored = errors.New("post already stored")
+
+var (
+	ErrInvalidReplyAudience = errors.New("reply audience must be one of everyone, following, mentioned or nobody")
+	ErrReplyNotAllowed      = errors.New("you cannot reply to this post")
+	ErrNotPostOwner         = errors.New("you are not the owner of this post")
+)
+
+// SetReplyAudience changes who can reply to one of the user's posts.
+func SetReplyAudience(db *gorm.DB, userID, postID uint, audience models.ReplyAudience) error {
+	if !audience.IsValid() {
+		return ErrInvalidReplyAudience
+	}
+
+	post, err := GetSimplePostByID(db, postID)
+	if err != nil {
+		return err
+	}
+	if post.UserID != userID {
+		return ErrNotPostOwner
+	}
+
+	return db.Model(&models.Post{}).Where("id = ?", postID).Update("reply_audience", audience).Error
+}
+
+// replyTarget is a post a reply would be attached to, identified by the ID of the listed post.
+type replyTarget struct {
+	key            uint
+	postID         uint
+	authorID       uint
+	authorUsername string
+	audience       models.ReplyAudience
+	communityID    *uint
+}
+
+// CanReply tells whether a user may reply to a post under its reply audience. Posts of a community only take
+// replies from its members.
+func CanReply(db *gorm.DB, userID uint, username string, post models.Post) (bool, error) {
+	allowed, err := replyablePosts(db, userID, username, []replyTarget{{
+		key:            post.ID,
+		postID:         post.ID,
+		authorID:       post.UserID,
+		authorUsername: post.Username,
+		audience:       post.ReplyAudience,
+		communityID:    post.CommunityID,
+	}})
+	if err != nil {
+		return false, err
+	}
+	return allowed[post.ID], nil
+}
+
+// ReplyablePostIDs tells which of the given posts the user may reply to. Reposts are checked against the
+// post they share, since replying to a repost replies to the original.
+func ReplyablePostIDs(db *gorm.DB, userID uint, username string, posts []mappers.PostResponse) (map[uint]bool, error) {
+	targets := make([]replyTarget, 0, len(posts))
+	for _, post := range posts {
+		target := replyTarget{
+			key:            post.ID,
+			postID:         post.ID,
+			authorID:       post.UserID,
+			authorUsername: post.Username,
+			audience:       post.ReplyAudience,
+			communityID:    post.CommunityID,
+		}
+		if post.Kind == models.KindRepost && post.ParentPost != nil {
+			target.postID = post.ParentPost.ID
+			target.authorID = post.ParentPost.UserID
+			target.authorUsername = post.ParentPost.Username
+			target.audience = post.ParentPost.ReplyAudience
+			target.communityID = post.ParentPost.CommunityID
+		}
+		targets = append(targets, target)
+	}
+	return replyablePosts(db, userID, username, targets)
+}
+
+// replyablePosts resolves the reply audiences of many posts with at most one follow, one mention, one
+// community membership and one block query. Nobody can reply to the posts of a user they blocked or were
+// blocked by.
+func replyablePosts(db *gorm.DB, userID uint, username string, targets []replyTarget) (map[uint]bool, error) {
+	allowed := make(map[uint]bool, len(targets))
+	var authors []string
+	var mentionPostIDs []uint
+	var communityIDs []uint
+	for _, target := range targets {
+		if target.communityID != nil {
+			communityIDs = append(communityIDs, *target.communityID)
+		}
+		switch {
+		case target.authorID == userID, target.audience == models.ReplyEveryone:
+			allowed[target.key] = true
+		case target.audience == models.ReplyFollowing:
+			authors = append(authors, target.authorUsername)
+		case target.audience == models.ReplyMentioned:
+			mentionPostIDs = append(mentionPostIDs, target.postID)
+		}
+	}
+
+	followedBy := make(map[string]bool)
+	if len(authors) > 0 {
+		var usernames []string
+		if err := db.Model(&models.Follow{}).
+			Where("followed_username = ? AND following_username IN ?", username, authors).
+			Pluck("following_username", &usernames).Error; err != nil {
+			return nil, err
+		}
+		for _, u := range usernames {
+			followedBy[u] = true
+		}
+	}
+
+	mentionedIn := make(map[uint]bool)
+	if len(mentionPostIDs) > 0 {
+		var postIDs []uint
+		if err := db.Model(&models.Mention{}).
+			Where("user_id = ? AND post_id IN ?", userID, mentionPostIDs).
+			Pluck("post_id", &postIDs).Error; err != nil {
+			return nil, err
+		}
+		for _, id := range postIDs {
+			mentionedIn[id] = true
+		}
+	}
+
+	for _, target := range targets {
+		switch target.audience {
+		case models.ReplyFollowing:
+			allowed[target.key] = allowed[target.key] || followedBy[target.authorUsername]
+		case models.ReplyMentioned:
+			allowed[target.key] = allowed[target.key] || mentionedIn[target.postID]
+		case models.ReplyEveryone, models.ReplyNobody:
+			// Decided without a query.
+		}
+	}
+
+	memberOf, err := community.MemberCommunityIDs(db, userID, communityIDs)
+	if err != nil {
+		return nil, err
+	}
+	blocked, err := block.BlockedUserIDs(db, userID)
+	if err != nil {
+		return nil, err
+	}
+	for _, target := range targets {
+		if target.communityID != nil && !memberOf[*target.communityID] || blocked[target.authorID] {
+			allowed[target.key] = false
+		}
+	}
+	return allowed, nil
+}
+
 func UpdateProfile(db *gorm.DB, username string, user *models.User) error {
 	return db.Where("username = ?", username).Updates(user).Error
 }
@@ -610,31 +1164,7 @@ func ProcessPosts(rawPosts []models.Post) []mappers.PostResponse {
 }
 
 func ProcessPost(post models.Post) mappers.PostResponse {
-	var parentPost *mappers.ParentPostResponse
-	if post.ParentPost != nil {
-		parentPost = &mappers.ParentPostResponse{
-			ID:        post.ParentPost.ID,
-			CreatedAt: post.ParentPost.CreatedAt.Format("2006-01-02 15:04:05.999999999 -0700 MST"),
-			Username:  post.ParentPost.Username,
-			Nickname:  post.ParentPost.Nickname,
-			Body:      post.ParentPost.Body,
-		}
-	}
-
-	return mappers.PostResponse{
-		ID:           post.ID,
-		CreatedAt:    post.CreatedAt.Format("2006-01-02 15:04:05.999999999 -0700 MST"),
-		UserID:       post.UserID,
-		Nickname:     post.Nickname,
-		Username:     post.Username,
-		ParentID:     post.ParentID,
-		Quote:        post.Quote,
-		Body:         post.Body,
-		RepostsCount: post.RepostsCount,
-		LikesCount:   post.LikesCount,
-		IsRepost:     post.IsRepost,
-		ParentPost:   parentPost,
-	}
+	return mappers.ProcessPost(post)
 }
 
 func EnlistUsers(arrayOfUsers []mappers.Response) []string {
@@ -0,0 +1,76 @@
+package user
+
+import (
+	"testing"
+	"time"
+	"x-clone/server/models"
+	"x-clone/server/testdb"
+)
+
+func TestRemovePostWithReplyRepostAndQuote(t *testing.T) {
+	db := testdb.Open(t)
+	alice := testdb.CreateUser(t, db, "alice")
+	bob := testdb.CreateUser(t, db, "bob")
+
+	post, err := CreatePost(db, alice.ID, alice.Nickname, alice.Username, models.KindOriginal, nil, "Hello",
+		models.ReplyEveryone, nil, nil)
+	if err != nil {
+		t.Fatalf("CreatePost() error = %v", err)
+	}
+	reply, err := CreatePost(db, bob.ID, bob.Nickname, bob.Username, models.KindReply, &post.ID, "Hi",
+		models.ReplyEveryone, nil, nil)
+	if err != nil {
+		t.Fatalf("CreatePost(reply) error = %v", err)
+	}
+	quote, err := CreatePost(db, bob.ID, bob.Nickname, bob.Username, models.KindQuote, &post.ID, "Look",
+		models.ReplyEveryone, nil, nil)
+	if err != nil {
+		t.Fatalf("CreatePost(quote) error = %v", err)
+	}
+	repost, _, err := Repost(db, bob.ID, bob.Nickname, bob.Username, post.ID)
+	if err != nil {
+		t.Fatalf("Repost() error = %v", err)
+	}
+	if err := LikePost(db, bob.ID, post.ID); err != nil {
+		t.Fatalf("LikePost() error = %v", err)
+	}
+	event := models.PostEvent{PostID: post.ID, Kind: models.EventImpression, ViewerKey: "u1", WindowStart: time.Now()}
+	if err := db.Create(&event).Error; err != nil {
+		t.Fatalf("failed to record an impression: %v", err)
+	}
+
+	if err := RemovePost(db, *post); err != nil {
+		t.Fatalf("RemovePost() error = %v", err)
+	}
+
+	var remaining int64
+	db.Model(&models.Post{}).Where("id IN ?", []uint{post.ID, repost.ID}).Count(&remaining)
+	if remaining != 0 {
+		t.Errorf("%d of the post and its repost are left, want both deleted", remaining)
+	}
+	var likes int64
+	db.Model(&models.Like{}).Where("post_id = ?", post.ID).Count(&likes)
+	if likes != 0 {
+		t.Errorf("%d likes of the deleted post are left, want none", likes)
+	}
+	var events int64
+	db.Model(&models.PostEvent{}).Where("post_id = ?", post.ID).Count(&events)
+	if events != 0 {
+		t.Errorf("%d events of the deleted post are left, want none", events)
+	}
+
+	var kept models.Post
+	if err := db.First(&kept, reply.ID).Error; err != nil {
+		t.Fatalf("the reply was deleted: %v", err)
+	}
+	if kept.ReplyToID != nil {
+		t.Errorf("the reply still answers post %d", *kept.ReplyToID)
+	}
+	kept = models.Post{}
+	if err := db.First(&kept, quote.ID).Error; err != nil {
+		t.Fatalf("the quote was deleted: %v", err)
+	}
+	if kept.QuotedPostID != nil {
+		t.Errorf("the quote still quotes post %d", *kept.QuotedPostID)
+	}
+}
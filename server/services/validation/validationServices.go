@@ -0,0 +1,257 @@
+package validation
+
+import (
+	"errors"
+	"fmt"
+	"golang.org/x/text/unicode/norm"
+	"gorm.io/gorm"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+	"x-clone/server/constants"
+	"x-clone/server/models"
+	"x-clone/server/text"
+)
+
+type Kind string
+
+const (
+	Post    Kind = "post"
+	Comment Kind = "comment"
+	Quote   Kind = "quote"
+	Message Kind = "message"
+)
+
+const (
+	CodeEmpty      = "empty"
+	CodeTooLong    = "too_long"
+	CodeBannedTerm = "banned_term"
+	CodeTooManyURL = "too_many_links"
+	CodeDuplicate  = "duplicate"
+)
+
+// Content is the text submitted by a user together with what the validation rules need to know about it.
+// Rules may rewrite Text, so later rules always see the normalized version.
+type Content struct {
+	Kind     Kind
+	AuthorID uint
+	// PostID is set when editing so the post is not reported as a duplicate of itself.
+	PostID uint
+	Text   string
+}
+
+// Error is a structured validation failure meant to be returned to the client as is.
+type Error struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+	Limit   int    `json:"limit,omitempty"`
+}
+
+func (e *Error) Error() string {
+	return e.Message
+}
+
+// Rule is a single step of a validation chain. It returns an *Error when the content is rejected
+// and may normalize content.Text in place.
+type Rule interface {
+	Apply(db *gorm.DB, content *Content) error
+}
+
+type Chain []Rule
+
+// Validate runs every rule in order, stopping at the first failure, and returns the normalized text.
+func (chain Chain) Validate(db *gorm.DB, content Content) (string, error) {
+	for _, rule := range chain {
+		if err := rule.Apply(db, &content); err != nil {
+			return constants.Empty, err
+		}
+	}
+	return content.Text, nil
+}
+
+var (
+	chainsOnce sync.Once
+	chains     map[Kind]Chain
+)
+
+// ForKind returns the chain shared by every endpoint accepting that kind of content. The chains are built once,
+// with the BANNED_TERMS of the environment.
+func ForKind(kind Kind) Chain {
+	chainsOnce.Do(func() {
+		banned := NewBannedTerms(bannedTermsFromEnv())
+		chains = make(map[Kind]Chain)
+		for _, k := range []Kind{Post, Comment, Quote, Message} {
+			chains[k] = buildChain(k, banned)
+		}
+	})
+	if chain, ok := chains[kind]; ok {
+		return chain
+	}
+	return buildChain(kind, BannedTerms{})
+}
+
+func buildChain(kind Kind, banned BannedTerms) Chain {
+	switch kind {
+	case Post, Comment:
+		return Chain{
+			Normalize{},
+			NotEmpty{},
+			MaxLength{Limit: constants.MaxPostLength},
+			banned,
+			MaxLinks{Limit: constants.MaxLinksPerPost},
+			NoDuplicate{Window: constants.DuplicatePostWindow},
+		}
+	case Quote:
+		return Chain{
+			Normalize{},
+			NotEmpty{},
+			MaxLength{Limit: constants.MaxPostLength},
+			banned,
+			MaxLinks{Limit: constants.MaxLinksPerPost},
+		}
+	case Message:
+		return Chain{
+			Normalize{},
+			NotEmpty{},
+			MaxLength{Limit: constants.MaxMessageLength},
+			banned,
+			MaxLinks{Limit: constants.MaxLinksPerMessage},
+		}
+	default:
+		return Chain{Normalize{}, NotEmpty{}}
+	}
+}
+
+// AsError extracts the structured error of a failed validation.
+func AsError(err error) (*Error, bool) {
+	var validationErr *Error
+	ok := errors.As(err, &validationErr)
+	return validationErr, ok
+}
+
+// zeroWidthJoiner is a format character that must be kept since it composes emoji sequences.
+const zeroWidthJoiner = '\u200d'
+
+// Normalize converts the text to Unicode NFC, strips control and invisible formatting characters
+// (keeping line breaks and tabs) and trims surrounding whitespace.
+type Normalize struct{}
+
+func (Normalize) Apply(_ *gorm.DB, content *Content) error {
+	normalized := norm.NFC.String(content.Text)
+	content.Text = strings.TrimSpace(strings.Map(func(r rune) rune {
+		if r == '\n' || r == '\t' {
+			return r
+		}
+		if unicode.IsControl(r) || (unicode.Is(unicode.Cf, r) && r != zeroWidthJoiner) {
+			return -1
+		}
+		return r
+	}, normalized))
+	return nil
+}
+
+type NotEmpty struct{}
+
+func (NotEmpty) Apply(_ *gorm.DB, content *Content) error {
+	if content.Text == constants.Empty {
+		return &Error{Code: CodeEmpty, Message: string(content.Kind) + " cannot be empty"}
+	}
+	return nil
+}
+
+// MaxLength limits the weighted length of the text, where every URL counts as a fixed-length link.
+type MaxLength struct {
+	Limit int
+}
+
+func (rule MaxLength) Apply(_ *gorm.DB, content *Content) error {
+	if text.WeightedLength(content.Text) > rule.Limit {
+		return &Error{
+			Code:    CodeTooLong,
+			Message: fmt.Sprintf("%s cannot exceed %d characters", content.Kind, rule.Limit),
+			Limit:   rule.Limit,
+		}
+	}
+	return nil
+}
+
+// BannedTerms rejects text containing any of its terms as a whole word, ignoring case.
+type BannedTerms struct {
+	pattern *regexp.Regexp
+}
+
+// NewBannedTerms compiles the terms into a single pattern, once for every text checked afterwards.
+func NewBannedTerms(terms []string) BannedTerms {
+	if len(terms) == 0 {
+		return BannedTerms{}
+	}
+	quoted := make([]string, len(terms))
+	for i, term := range terms {
+		quoted[i] = regexp.QuoteMeta(strings.ToLower(term))
+	}
+	return BannedTerms{pattern: regexp.MustCompile(
+		`(?:^|[^\p{L}\p{N}_])(?:` + strings.Join(quoted, "|") + `)(?:$|[^\p{L}\p{N}_])`)}
+}
+
+func (rule BannedTerms) Apply(_ *gorm.DB, content *Content) error {
+	if rule.pattern != nil && rule.pattern.MatchString(strings.ToLower(content.Text)) {
+		return &Error{Code: CodeBannedTerm, Message: string(content.Kind) + " contains a banned term"}
+	}
+	return nil
+}
+
+type MaxLinks struct {
+	Limit int
+}
+
+func (rule MaxLinks) Apply(_ *gorm.DB, content *Content) error {
+	if len(text.ExtractType(content.Text, text.URL)) > rule.Limit {
+		return &Error{
+			Code:    CodeTooManyURL,
+			Message: fmt.Sprintf("%s cannot contain more than %d links", content.Kind, rule.Limit),
+			Limit:   rule.Limit,
+		}
+	}
+	return nil
+}
+
+// NoDuplicate rejects text identical to another post of the same author published within the window.
+type NoDuplicate struct {
+	Window time.Duration
+}
+
+func (rule NoDuplicate) Apply(db *gorm.DB, content *Content) error {
+	var count int64
+	err := db.Model(&models.Post{}).
+		Where("user_id = ? AND id <> ?", content.AuthorID, content.PostID).
+		Where("created_at >= ?", time.Now().Add(-rule.Window)).
+		Where("LOWER(body) = LOWER(?)", content.Text).
+		Count(&count).Error
+	if err != nil {
+		return err
+	}
+	if count > 0 {
+		return &Error{Code: CodeDuplicate, Message: "you already posted this recently"}
+	}
+	return nil
+}
+
+var (
+	bannedTermsOnce sync.Once
+	bannedTerms     []string
+)
+
+// bannedTermsFromEnv reads the comma separated BANNED_TERMS list once.
+func bannedTermsFromEnv() []string {
+	bannedTermsOnce.Do(func() {
+		for _, term := range strings.Split(os.Getenv("BANNED_TERMS"), ",") {
+			if term = strings.TrimSpace(term); term != constants.Empty {
+				bannedTerms = append(bannedTerms, term)
+			}
+		}
+	})
+	return bannedTerms
+}
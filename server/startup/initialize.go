@@ -1,6 +1,7 @@
 package startup
 
 import (
+	"context"
 	"fmt"
 	"github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"
@@ -8,12 +9,16 @@ import (
 	"gorm.io/driver/postgres"
 	"gorm.io/gorm"
 	"log"
+	"net/http"
 	"os"
 	"time"
 	middleware "x-clone/server/authentication"
 	"x-clone/server/constants"
 	"x-clone/server/controllers"
 	"x-clone/server/models"
+	"x-clone/server/services/federation"
+	"x-clone/server/services/reconcile"
+	"x-clone/server/services/user"
 )
 
 func SetupRouter(db *gorm.DB) *gin.Engine {
@@ -29,6 +34,7 @@ func SetupRouter(db *gorm.DB) *gin.Engine {
 	}))
 
 	public := router.Group("/api")
+	public.Use(middleware.OptionalAuthMiddleware(db))
 	{
 		for _, endpoint := range controllers.PublicEndpoints {
 			public.Handle(endpoint.Method, endpoint.Path, endpoint.HandlerFunction(db))
@@ -43,11 +49,65 @@ func SetupRouter(db *gorm.DB) *gin.Engine {
 		}
 	}
 
+	for _, endpoint := range controllers.FederationEndpoints {
+		router.Handle(endpoint.Method, endpoint.Path, endpoint.HandlerFunction(db))
+	}
+
 	return router
 }
 
-func StartRoutes(db *gorm.DB) error {
-	return SetupRouter(db).Run()
+// StartRoutes serves the API on PORT (8080 by default) until ctx is done, then stops accepting requests and
+// waits up to ShutdownTimeout for the ones in progress.
+func StartRoutes(ctx context.Context, db *gorm.DB) error {
+	address := ":8080"
+	if port := os.Getenv("PORT"); port != constants.Empty {
+		address = ":" + port
+	}
+	server := &http.Server{Addr: address, Handler: SetupRouter(db)}
+
+	served := make(chan error, 1)
+	go func() {
+		served <- server.ListenAndServe()
+	}()
+
+	select {
+	case err := <-served:
+		return err
+	case <-ctx.Done():
+	}
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), constants.ShutdownTimeout)
+	defer cancel()
+	return server.Shutdown(shutdownCtx)
+}
+
+// StartReconciliation schedules the counter reconciliation job. RECONCILE_INTERVAL overrides the default
+// interval ("0" disables the job) and RECONCILE_FIX=true lets it fix the counters instead of only reporting.
+func StartReconciliation(db *gorm.DB) {
+	interval := constants.ReconcileDefaultInterval
+	if raw := os.Getenv("RECONCILE_INTERVAL"); raw != constants.Empty {
+		parsed, err := time.ParseDuration(raw)
+		if err != nil {
+			log.Printf("Invalid RECONCILE_INTERVAL %q, using %s", raw, interval)
+		} else {
+			interval = parsed
+		}
+	}
+	if interval <= 0 {
+		return
+	}
+
+	reconcile.Schedule(db, interval, reconcile.Options{
+		Fix:       os.Getenv("RECONCILE_FIX") == "true",
+		BatchSize: constants.ReconcileBatchSize,
+	})
+}
+
+// StartFederation starts sending the queued activities to other servers, when FEDERATION_URL is set.
+func StartFederation(db *gorm.DB) {
+	if federation.Enabled() {
+		federation.StartDelivery(db)
+	}
 }
 
 func StartDatabase() *gorm.DB {
@@ -89,14 +149,213 @@ func StartDatabase() *gorm.DB {
 }
 
 func migrateSchemas(db *gorm.DB) {
+	if err := dedupeLikes(db); err != nil {
+		log.Fatalf("failed to deduplicate likes: %v", err)
+	}
+
+	hadTimelines := db.Migrator().HasTable(&models.TimelineEntry{})
+	hadFannedOut := db.Migrator().HasColumn(&models.Post{}, "fanned_out")
+
 	err := db.AutoMigrate(&models.Post{},
 		&models.Follow{},
 		&models.Like{},
 		&models.User{},
 		&models.Conversation{},
 		&models.Message{},
+		&models.Hashtag{},
+		&models.PostHashtag{},
+		&models.Mention{},
+		&models.LinkCard{},
+		&models.BookmarkFolder{},
+		&models.Bookmark{},
+		&models.PostEvent{},
+		&models.PostLabel{},
+		&models.List{},
+		&models.ListMember{},
+		&models.ListSubscription{},
+		&models.Community{},
+		&models.CommunityRule{},
+		&models.CommunityMember{},
+		&models.TimelineEntry{},
+		&models.Block{},
+		&models.MutedAccount{},
+		&models.MutedWord{},
+		&models.MutedConversation{},
+		&models.ActorKey{},
+		&models.RemoteActor{},
+		&models.Delivery{},
 	)
 	if err != nil {
 		log.Fatalf("failed to migrate database: %v", err)
 	}
+
+	if err = migratePostKinds(db); err != nil {
+		log.Fatalf("failed to migrate post kinds: %v", err)
+	}
+
+	if err = uniqueReposts(db); err != nil {
+		log.Fatalf("failed to deduplicate reposts: %v", err)
+	}
+
+	if !hadFannedOut {
+		if err = markFannedOut(db); err != nil {
+			log.Fatalf("failed to mark fanned out posts: %v", err)
+		}
+	}
+
+	if !hadTimelines {
+		if err = backfillTimelines(db); err != nil {
+			log.Fatalf("failed to backfill home timelines: %v", err)
+		}
+	}
+}
+
+// markFannedOut flags the posts written before the flag existed, when posts were fanned out depending on the
+// current follower count of their author, as if they had been written now.
+func markFannedOut(db *gorm.DB) error {
+	return db.Exec(`UPDATE posts SET fanned_out = true FROM users
+		WHERE users.id = posts.user_id AND users.follower_count < ?`, constants.FanOutMaxFollowers).Error
+}
+
+// backfillTimelines fills the home timelines created after their posts with the latest posts of every user and
+// of the accounts they follow. Posts that were not fanned out only go to their author, since they are merged into
+// the timelines of the followers when those are read.
+func backfillTimelines(db *gorm.DB) error {
+	return db.Exec(`
+		WITH recent AS (
+			SELECT id, user_id, created_at, fanned_out,
+				ROW_NUMBER() OVER (PARTITION BY user_id ORDER BY id DESC) AS position
+			FROM posts
+		), readers AS (
+			SELECT id AS reader_id, id AS author_id FROM users WHERE deleted_at IS NULL
+			UNION
+			SELECT follower.id, followed.id
+			FROM follows
+			JOIN users follower ON follower.username = follows.following_username
+			JOIN users followed ON followed.username = follows.followed_username
+			WHERE follows.deleted_at IS NULL
+		)
+		INSERT INTO timeline_entries (user_id, post_id, author_id, created_at)
+		SELECT readers.reader_id, recent.id, recent.user_id, recent.created_at
+		FROM readers
+		JOIN recent ON recent.user_id = readers.author_id
+		WHERE recent.position <= @limit AND (recent.fanned_out OR readers.reader_id = readers.author_id)
+		ON CONFLICT DO NOTHING`,
+		map[string]interface{}{"limit": constants.TimelineBackfillSize}).Error
+}
+
+// migratePostKinds converts posts saved before kinds existed, when replies, reposts and quotes were all
+// told apart through parent_id, is_repost and quote. The text of a quote is appended to the body of its post,
+// replies included, and cleared so that running it again changes nothing. The legacy columns are kept until
+// DropLegacyPostColumns is run.
+func migratePostKinds(db *gorm.DB) error {
+	if !db.Migrator().HasColumn(&models.Post{}, "is_repost") {
+		return nil
+	}
+
+	return db.Transaction(func(tx *gorm.DB) error {
+		statements := []string{
+			`ALTER TABLE posts DROP CONSTRAINT IF EXISTS fk_posts_parent_post`,
+			`UPDATE posts SET body = CASE WHEN body = '' THEN quote ELSE body || E'\n\n' || quote END, quote = ''
+				WHERE COALESCE(quote, '') <> ''`,
+			`UPDATE posts SET kind = 'reply', reply_to_id = parent_id
+				WHERE kind = 'original' AND parent_id IS NOT NULL AND NOT COALESCE(is_repost, false)`,
+			`UPDATE posts SET kind = 'quote', quoted_post_id = parent_id
+				WHERE kind = 'original' AND parent_id IS NOT NULL AND COALESCE(is_repost, false) AND body <> ''`,
+			`UPDATE posts SET kind = 'repost', quoted_post_id = parent_id
+				WHERE kind = 'original' AND parent_id IS NOT NULL AND COALESCE(is_repost, false) AND body = ''`,
+		}
+		for _, statement := range statements {
+			if err := tx.Exec(statement).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// DropLegacyPostColumns removes parent_id, is_repost and quote once migratePostKinds has converted every post.
+// It is never run at start, only through the "drop-legacy-post-columns" subcommand, so that the old values stay
+// around until the migrated posts were checked.
+func DropLegacyPostColumns(db *gorm.DB) error {
+	if err := migratePostKinds(db); err != nil {
+		return err
+	}
+
+	return db.Transaction(func(tx *gorm.DB) error {
+		for _, column := range []string{"parent_id", "is_repost", "quote"} {
+			if !tx.Migrator().HasColumn(&models.Post{}, column) {
+				continue
+			}
+			if err := tx.Migrator().DropColumn(&models.Post{}, column); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// dedupeLikes prepares likes for their unique index. Likes used to be soft deleted, and concurrent requests
+// could store the same like twice, so the counters are recomputed from the remaining rows.
+func dedupeLikes(db *gorm.DB) error {
+	if !db.Migrator().HasColumn(&models.Like{}, "deleted_at") {
+		return nil
+	}
+
+	return db.Transaction(func(tx *gorm.DB) error {
+		statements := []string{
+			`DELETE FROM likes WHERE deleted_at IS NOT NULL`,
+			`DELETE FROM likes duplicate USING likes kept
+				WHERE duplicate.user_id = kept.user_id AND duplicate.post_id = kept.post_id AND duplicate.id > kept.id`,
+			`UPDATE posts SET likes_count = (SELECT COUNT(*) FROM likes WHERE likes.post_id = posts.id)`,
+		}
+		for _, statement := range statements {
+			if err := tx.Exec(statement).Error; err != nil {
+				return err
+			}
+		}
+
+		for _, column := range []string{"deleted_at", "updated_at"} {
+			if err := tx.Migrator().DropColumn(&models.Like{}, column); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// uniqueReposts adds the partial index allowing a single plain repost of a post per user, after removing the
+// duplicates concurrent requests could create and recomputing the repost counters. The duplicates are removed
+// like deleted posts, so that nothing is left pointing at them.
+func uniqueReposts(db *gorm.DB) error {
+	if db.Migrator().HasIndex(&models.Post{}, "idx_user_repost") {
+		return nil
+	}
+
+	return db.Transaction(func(tx *gorm.DB) error {
+		var duplicates []models.Post
+		if err := tx.Where(`kind = 'repost' AND EXISTS (SELECT 1 FROM posts kept
+			WHERE kept.kind = 'repost' AND kept.user_id = posts.user_id
+			AND kept.quoted_post_id = posts.quoted_post_id AND kept.id < posts.id)`).
+			Find(&duplicates).Error; err != nil {
+			return err
+		}
+		for _, duplicate := range duplicates {
+			if err := user.RemovePost(tx, duplicate); err != nil {
+				return err
+			}
+		}
+
+		statements := []string{
+			`UPDATE posts SET reposts_count = (SELECT COUNT(*) FROM posts shares
+				WHERE shares.quoted_post_id = posts.id AND shares.kind IN ('repost', 'quote'))`,
+			`CREATE UNIQUE INDEX idx_user_repost ON posts (user_id, quoted_post_id) WHERE kind = 'repost'`,
+		}
+		for _, statement := range statements {
+			if err := tx.Exec(statement).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
 }
@@ -0,0 +1,84 @@
+// Package testdb opens the PostgreSQL database used by the tests that need one, given by TEST_DATABASE_URL.
+// Those tests are skipped when it is not set.
+package testdb
+
+import (
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+	"os"
+	"strings"
+	"testing"
+	"x-clone/server/constants"
+	"x-clone/server/models"
+)
+
+// tables are the tables created by the server at startup.
+var tables = []interface{}{
+	&models.Post{},
+	&models.Follow{},
+	&models.Like{},
+	&models.User{},
+	&models.Conversation{},
+	&models.Message{},
+	&models.Hashtag{},
+	&models.PostHashtag{},
+	&models.Mention{},
+	&models.LinkCard{},
+	&models.BookmarkFolder{},
+	&models.Bookmark{},
+	&models.PostEvent{},
+	&models.PostLabel{},
+	&models.List{},
+	&models.ListMember{},
+	&models.ListSubscription{},
+	&models.Community{},
+	&models.CommunityRule{},
+	&models.CommunityMember{},
+	&models.TimelineEntry{},
+	&models.Block{},
+	&models.MutedAccount{},
+	&models.MutedWord{},
+	&models.MutedConversation{},
+	&models.ActorKey{},
+	&models.RemoteActor{},
+	&models.Delivery{},
+}
+
+// Open connects to the test database, creates the tables and empties them.
+func Open(t *testing.T) *gorm.DB {
+	t.Helper()
+	dsn := os.Getenv("TEST_DATABASE_URL")
+	if dsn == constants.Empty {
+		t.Skip("TEST_DATABASE_URL is not set")
+	}
+	db, err := gorm.Open(postgres.Open(dsn), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("failed to connect to the test database: %v", err)
+	}
+	if err := db.AutoMigrate(tables...); err != nil {
+		t.Fatalf("failed to migrate the test database: %v", err)
+	}
+
+	names := make([]string, len(tables))
+	for i, table := range tables {
+		statement := &gorm.Statement{DB: db}
+		if err := statement.Parse(table); err != nil {
+			t.Fatalf("failed to parse %T: %v", table, err)
+		}
+		names[i] = statement.Table
+	}
+	if err := db.Exec("TRUNCATE " + strings.Join(names, ", ") + " RESTART IDENTITY CASCADE").Error; err != nil {
+		t.Fatalf("failed to empty the test database: %v", err)
+	}
+	return db
+}
+
+// CreateUser stores a local user named username.
+func CreateUser(t *testing.T, db *gorm.DB, username string) models.User {
+	t.Helper()
+	user := models.User{Username: username, Nickname: username, Mail: username + "@x-clone.example"}
+	if err := db.Create(&user).Error; err != nil {
+		t.Fatalf("failed to create %s: %v", username, err)
+	}
+	return user
+}
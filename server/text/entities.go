@@ -0,0 +1,217 @@
+package text
+
+import (
+	"regexp"
+	"sort"
+	"strings"
+	"unicode/utf8"
+	"x-clone/server/constants"
+)
+
+type Type string
+
+const (
+	URL     Type = "url"
+	Hashtag Type = "hashtag"
+	Mention Type = "mention"
+	Cashtag Type = "cashtag"
+)
+
+// Hashtags, mentions and cashtags must start the body or follow a character that cannot be part of a word,
+// so "a#b", "mail@host.com" or "US$5" are left alone. Mentions of accounts on other servers carry their domain,
+// as in "@alice@mastodon.social".
+var (
+	urlPattern     = regexp.MustCompile(`(?i)\b(?:https?://|www\.)[^\s<>"]+`)
+	hashtagPattern = regexp.MustCompile(`(?:^|[^\p{L}\p{N}_&/#＃])([#＃][\p{L}\p{M}\p{N}_]+)`)
+	mentionPattern = regexp.MustCompile(
+		`(?:^|[^\p{L}\p{N}_@.])(@[\p{L}\p{N}_]+(?:@[\p{L}\p{N}-]+(?:\.[\p{L}\p{N}-]+)+)?)`)
+	cashtagPattern = regexp.MustCompile(`(?:^|[^\p{L}\p{N}_$])(\$[A-Za-z]{1,6}(?:[._][A-Za-z]{1,2})?)\b`)
+)
+
+// Entity is a typed span of a body. Start and End are rune offsets, StartUTF16 and EndUTF16 are UTF-16 code unit
+// offsets as used by JavaScript clients; both ends are exclusive. Text is the span as written and Value its
+// canonical form: the full link for URLs, the lowercased tag for hashtags, the username for mentions, with the
+// domain of remote accounts, and the uppercased symbol for cashtags.
+type Entity struct {
+	Type       Type
+	Text       string
+	Value      string
+	Start      int
+	End        int
+	StartUTF16 int
+	EndUTF16   int
+}
+
+type match struct {
+	entityType Type
+	start      int
+	end        int
+}
+
+// Extract returns the non-overlapping entities of a body ordered by position. URLs win over any hashtag,
+// mention or cashtag found inside them.
+func Extract(body string) []Entity {
+	matches := findURLs(body)
+	for _, candidate := range findPrefixed(body) {
+		if !overlaps(candidate, matches) {
+			matches = append(matches, candidate)
+		}
+	}
+
+	sort.Slice(matches, func(i, j int) bool { return matches[i].start < matches[j].start })
+
+	runeOffsets, utf16Offsets := offsetTables(body)
+	entities := make([]Entity, len(matches))
+	for i, m := range matches {
+		text := body[m.start:m.end]
+		entities[i] = Entity{
+			Type:       m.entityType,
+			Text:       text,
+			Value:      canonicalValue(m.entityType, text),
+			Start:      runeOffsets[m.start],
+			End:        runeOffsets[m.end],
+			StartUTF16: utf16Offsets[m.start],
+			EndUTF16:   utf16Offsets[m.end],
+		}
+	}
+
+	return entities
+}
+
+// ExtractType returns only the entities of the given type.
+func ExtractType(body string, entityType Type) []Entity {
+	var filtered []Entity
+	for _, e := range Extract(body) {
+		if e.Type == entityType {
+			filtered = append(filtered, e)
+		}
+	}
+	return filtered
+}
+
+// WeightedLength counts a body the way post limits are enforced: one per character,
+// with every URL weighted as a fixed-length shortened link whatever its real length.
+func WeightedLength(body string) int {
+	length := utf8.RuneCountInString(body)
+	for _, e := range ExtractType(body, URL) {
+		length += constants.URLWeightedLength - (e.End - e.Start)
+	}
+	return length
+}
+
+func findURLs(body string) []match {
+	var matches []match
+	for _, loc := range urlPattern.FindAllStringIndex(body, -1) {
+		end := loc[0] + len(trimURL(body[loc[0]:loc[1]]))
+		if end > loc[0] {
+			matches = append(matches, match{entityType: URL, start: loc[0], end: end})
+		}
+	}
+	return matches
+}
+
+func findPrefixed(body string) []match {
+	patterns := []struct {
+		entityType Type
+		pattern    *regexp.Regexp
+	}{
+		{Hashtag, hashtagPattern},
+		{Mention, mentionPattern},
+		{Cashtag, cashtagPattern},
+	}
+
+	var matches []match
+	for _, p := range patterns {
+		for _, loc := range p.pattern.FindAllStringSubmatchIndex(body, -1) {
+			// loc[2] and loc[3] delimit the captured entity, without the preceding boundary character.
+			candidate := match{entityType: p.entityType, start: loc[2], end: loc[3]}
+			if p.entityType == Hashtag && isNumericTag(body[loc[2]:loc[3]]) {
+				continue
+			}
+			// A handle whose domain could not be read is not a mention of the local user of the same name.
+			if p.entityType == Mention && strings.HasPrefix(body[loc[3]:], "@") {
+				continue
+			}
+			matches = append(matches, candidate)
+		}
+	}
+	return matches
+}
+
+// trimURL drops trailing punctuation that usually ends the sentence rather than the link,
+// keeping a closing parenthesis when the link itself opened one.
+func trimURL(url string) string {
+	for url != constants.Empty {
+		last := url[len(url)-1]
+		switch {
+		case strings.ContainsRune(".,;:!?'\"]}", rune(last)):
+			url = url[:len(url)-1]
+		case last == ')' && strings.Count(url, "(") < strings.Count(url, ")"):
+			url = url[:len(url)-1]
+		default:
+			return url
+		}
+	}
+	return url
+}
+
+func overlaps(candidate match, matches []match) bool {
+	for _, m := range matches {
+		if candidate.start < m.end && m.start < candidate.end {
+			return true
+		}
+	}
+	return false
+}
+
+func isNumericTag(tag string) bool {
+	for _, r := range strings.TrimLeft(tag, "#＃") {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+func canonicalValue(entityType Type, text string) string {
+	switch entityType {
+	case URL:
+		if strings.HasPrefix(strings.ToLower(text), "www.") {
+			return "http://" + text
+		}
+		return text
+	case Hashtag:
+		return strings.ToLower(strings.TrimLeft(text, "#＃"))
+	case Mention:
+		return strings.TrimPrefix(text, "@")
+	case Cashtag:
+		return strings.ToUpper(strings.TrimPrefix(text, "$"))
+	default:
+		return text
+	}
+}
+
+// offsetTables maps every rune boundary byte offset of body (plus its length) to its rune and UTF-16 offsets.
+func offsetTables(body string) (map[int]int, map[int]int) {
+	runeOffsets := make(map[int]int, len(body)+1)
+	utf16Offsets := make(map[int]int, len(body)+1)
+
+	runeIndex, utf16Index := 0, 0
+	for byteIndex, r := range body {
+		runeOffsets[byteIndex] = runeIndex
+		utf16Offsets[byteIndex] = utf16Index
+		runeIndex++
+		utf16Index += utf16Len(r)
+	}
+	runeOffsets[len(body)] = runeIndex
+	utf16Offsets[len(body)] = utf16Index
+
+	return runeOffsets, utf16Offsets
+}
+
+func utf16Len(r rune) int {
+	if r >= constants.UTF16SurrogateThreshold {
+		return 2
+	}
+	return 1
+}
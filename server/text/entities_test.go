@@ -0,0 +1,148 @@
+package text
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"x-clone/server/constants"
+)
+
+func TestExtract(t *testing.T) {
+	cases := []struct {
+		name string
+		body string
+		want []Entity
+	}{
+		{
+			name: "plain text",
+			body: "nothing to see here",
+			want: []Entity{},
+		},
+		{
+			name: "every type",
+			body: "Hi @bob, #Go and $AAPL at https://go.dev",
+			want: []Entity{
+				{Type: Mention, Text: "@bob", Value: "bob", Start: 3, End: 7, StartUTF16: 3, EndUTF16: 7},
+				{Type: Hashtag, Text: "#Go", Value: "go", Start: 9, End: 12, StartUTF16: 9, EndUTF16: 12},
+				{Type: Cashtag, Text: "$AAPL", Value: "AAPL", Start: 17, End: 22, StartUTF16: 17, EndUTF16: 22},
+				{Type: URL, Text: "https://go.dev", Value: "https://go.dev", Start: 26, End: 40, StartUTF16: 26,
+					EndUTF16: 40},
+			},
+		},
+		{
+			name: "surrogate pairs shift UTF-16 offsets only",
+			body: "😀 #tag",
+			want: []Entity{
+				{Type: Hashtag, Text: "#tag", Value: "tag", Start: 2, End: 6, StartUTF16: 3, EndUTF16: 7},
+			},
+		},
+		{
+			name: "full-width hash",
+			body: "＃Gopher",
+			want: []Entity{
+				{Type: Hashtag, Text: "＃Gopher", Value: "gopher", Start: 0, End: 7, StartUTF16: 0, EndUTF16: 7},
+			},
+		},
+		{
+			name: "accented hashtag",
+			body: "#Café",
+			want: []Entity{
+				{Type: Hashtag, Text: "#Café", Value: "café", Start: 0, End: 5, StartUTF16: 0, EndUTF16: 5},
+			},
+		},
+		{
+			name: "numeric hashtags are not tags",
+			body: "#123 #1a",
+			want: []Entity{
+				{Type: Hashtag, Text: "#1a", Value: "1a", Start: 5, End: 8, StartUTF16: 5, EndUTF16: 8},
+			},
+		},
+		{
+			name: "prefixes inside words are ignored",
+			body: "a#b mail@host.com US$5",
+			want: []Entity{},
+		},
+		{
+			name: "remote handles keep their domain",
+			body: "cc @alice@mastodon.social.",
+			want: []Entity{
+				{Type: Mention, Text: "@alice@mastodon.social", Value: "alice@mastodon.social", Start: 3, End: 25,
+					StartUTF16: 3, EndUTF16: 25},
+			},
+		},
+		{
+			name: "handles without a readable domain are not local mentions",
+			body: "@alice@localhost @bob@",
+			want: []Entity{},
+		},
+		{
+			name: "www links get a scheme",
+			body: "see www.example.com.",
+			want: []Entity{
+				{Type: URL, Text: "www.example.com", Value: "http://www.example.com", Start: 4, End: 19,
+					StartUTF16: 4, EndUTF16: 19},
+			},
+		},
+		{
+			name: "URLs win over what they contain",
+			body: "https://example.com/#frag?u=@bob",
+			want: []Entity{
+				{Type: URL, Text: "https://example.com/#frag?u=@bob", Value: "https://example.com/#frag?u=@bob",
+					Start: 0, End: 32, StartUTF16: 0, EndUTF16: 32},
+			},
+		},
+	}
+
+	for _, tc := range cases {
+		if got := Extract(tc.body); !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("%s: Extract(%q) = %+v, want %+v", tc.name, tc.body, got, tc.want)
+		}
+	}
+}
+
+func TestExtractTrimsURLs(t *testing.T) {
+	cases := map[string]string{
+		"https://example.com.":                           "https://example.com",
+		"https://example.com/path?!":                     "https://example.com/path",
+		"(see https://example.com)":                      "https://example.com",
+		"https://en.wikipedia.org/wiki/Go_(language)":    "https://en.wikipedia.org/wiki/Go_(language)",
+		"(https://en.wikipedia.org/wiki/Go_(language)).": "https://en.wikipedia.org/wiki/Go_(language)",
+		`"https://example.com/a"`:                        "https://example.com/a",
+		"[https://example.com/list]":                     "https://example.com/list",
+		"https://example.com/x'":                         "https://example.com/x",
+	}
+	for body, want := range cases {
+		urls := ExtractType(body, URL)
+		if len(urls) != 1 || urls[0].Text != want {
+			t.Errorf("ExtractType(%q, URL) = %+v, want one URL %q", body, urls, want)
+		}
+	}
+}
+
+func TestExtractType(t *testing.T) {
+	got := ExtractType("#one @two #three", Hashtag)
+	if len(got) != 2 || got[0].Value != "one" || got[1].Value != "three" {
+		t.Errorf("ExtractType(Hashtag) = %+v, want #one and #three", got)
+	}
+	if got := ExtractType("#one", Mention); got != nil {
+		t.Errorf("ExtractType(Mention) = %+v, want nothing", got)
+	}
+}
+
+func TestWeightedLength(t *testing.T) {
+	longURL := "https://example.com/" + strings.Repeat("a", 100)
+	cases := map[string]int{
+		constants.Empty:      0,
+		"hello":              5,
+		"😀😀":                 2,
+		"café":               4,
+		longURL:              constants.URLWeightedLength,
+		"go " + longURL:      3 + constants.URLWeightedLength,
+		"www.a.co and x.com": constants.URLWeightedLength + len(" and x.com"),
+	}
+	for body, want := range cases {
+		if got := WeightedLength(body); got != want {
+			t.Errorf("WeightedLength(%q) = %d, want %d", body, got, want)
+		}
+	}
+}